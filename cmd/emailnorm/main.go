@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	emailaddr "github.com/1abobik1/Single-Sign-On/internal/lib/email"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+	"github.com/1abobik1/Single-Sign-On/internal/storage/postgresql"
+)
+
+// Нормализация email с интернационализированными доменами.
+//
+// Миграция 4 приводит email к нижнему регистру, но не переводит домен в punycode,
+// как email.Normalize при входе и регистрации, поэтому такие адреса перестают
+// находиться. Команда нормализует их так же; адреса, которые после нормализации
+// совпали с чужими или некорректны, выводятся и не меняются.
+func main() {
+	var storagePath string
+	var dryRun bool
+
+	flag.StringVar(&storagePath, "storage-path", "", "PostgreSQL connection URL")
+	flag.BoolVar(&dryRun, "dry-run", false, "print changes without applying them")
+	flag.Parse()
+
+	if storagePath == "" {
+		panic("storage-path is required")
+	}
+
+	// Команда не работает с приложениями, ключи секретов не нужны
+	db, err := postgresql.New(storagePath, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Stop()
+
+	ctx := context.Background()
+
+	users, err := db.UsersWithNonASCIIEmail(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	var updated, skipped int
+	for _, user := range users {
+		normalized, err := emailaddr.Normalize(user.Email)
+		if err != nil {
+			fmt.Printf("user %d: %q: %v\n", user.ID, user.Email, err)
+			skipped++
+			continue
+		}
+		if normalized == user.Email {
+			continue
+		}
+
+		fmt.Printf("user %d: %q -> %q\n", user.ID, user.Email, normalized)
+		if dryRun {
+			updated++
+			continue
+		}
+
+		if err := db.UpdateUserEmail(ctx, user.ID, normalized); err != nil {
+			if errors.Is(err, storage.ErrUserExists) {
+				fmt.Printf("user %d: %q is taken by another user, merge the accounts manually\n", user.ID, normalized)
+				skipped++
+				continue
+			}
+			panic(err)
+		}
+		updated++
+	}
+
+	fmt.Printf("updated: %d, skipped: %d\n", updated, skipped)
+}
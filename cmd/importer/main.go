@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	emailaddr "github.com/1abobik1/Single-Sign-On/internal/lib/email"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/password"
+	"github.com/1abobik1/Single-Sign-On/internal/storage/postgresql"
+)
+
+// record — пользователь из файла импорта.
+type record struct {
+	Line         int    `json:"-"`
+	Invalid      string `json:"-"`
+	Email        string `json:"email"`
+	PasswordHash string `json:"password_hash"`
+	HashFormat   string `json:"hash_format"`
+	Salt         string `json:"salt"`
+	SaltPosition string `json:"salt_position"`
+}
+
+// Импорт пользователей с готовыми хешами паролей из других систем.
+//
+// Входной файл — CSV с заголовком (email,password_hash[,hash_format,salt,salt_position])
+// или JSON Lines с теми же ключами. Поддерживаемые форматы хешей описаны в password.ImportHash.
+// Отклоненные записи и дубликаты пишутся в отчет в формате CSV: line,email,reason.
+func main() {
+	var storagePath, inputPath, format, reportPath string
+	var batchSize int
+
+	flag.StringVar(&storagePath, "storage-path", "", "PostgreSQL connection URL")
+	flag.StringVar(&inputPath, "input", "", "path to import file, - for stdin")
+	flag.StringVar(&format, "format", "csv", "input format: csv or jsonl")
+	flag.IntVar(&batchSize, "batch-size", 1000, "users per insert batch")
+	flag.StringVar(&reportPath, "report", "", "path to report file, stderr by default")
+	flag.Parse()
+
+	if storagePath == "" || inputPath == "" {
+		panic("storage-path and input are required")
+	}
+	if batchSize <= 0 {
+		panic("batch-size must be positive")
+	}
+
+	var in io.Reader = os.Stdin
+	if inputPath != "-" {
+		f, err := os.Open(inputPath)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var report io.Writer = os.Stderr
+	if reportPath != "" {
+		f, err := os.Create(reportPath)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		report = f
+	}
+
+	var next func() (record, error)
+	switch format {
+	case "csv":
+		r, err := newCSVReader(in)
+		if err != nil {
+			panic(err)
+		}
+		next = r
+	case "jsonl":
+		next = newJSONLReader(in)
+	default:
+		panic("format must be csv or jsonl")
+	}
+
+	// Импорт не работает с приложениями, ключи секретов не нужны
+	storage, err := postgresql.New(storagePath, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer storage.Stop()
+
+	imp := &importer{
+		storage:   storage,
+		report:    csv.NewWriter(report),
+		batchSize: batchSize,
+	}
+	if err := imp.run(context.Background(), next); err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("imported: %d, duplicates: %d, rejected: %d\n", imp.imported, imp.duplicates, imp.rejected)
+}
+
+type importer struct {
+	storage   *postgresql.Storage
+	report    *csv.Writer
+	batchSize int
+
+	imported   int
+	duplicates int
+	rejected   int
+}
+
+func (imp *importer) run(ctx context.Context, next func() (record, error)) error {
+	defer imp.report.Flush()
+
+	batch := make([]models.User, 0, imp.batchSize)
+	// lines[i] — строка входного файла, из которой прочитан batch[i]
+	lines := make([]int, 0, imp.batchSize)
+
+	for {
+		rec, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if rec.Invalid != "" {
+			imp.rejected++
+			imp.writeReport(rec.Line, rec.Email, rec.Invalid)
+			continue
+		}
+
+		user, err := toUser(rec)
+		if err != nil {
+			imp.rejected++
+			imp.writeReport(rec.Line, rec.Email, err.Error())
+			continue
+		}
+
+		batch = append(batch, user)
+		lines = append(lines, rec.Line)
+
+		if len(batch) == imp.batchSize {
+			if err := imp.flush(ctx, batch, lines); err != nil {
+				return err
+			}
+			batch = batch[:0]
+			lines = lines[:0]
+		}
+	}
+
+	return imp.flush(ctx, batch, lines)
+}
+
+func (imp *importer) flush(ctx context.Context, batch []models.User, lines []int) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	duplicates, err := imp.storage.SaveImportedUsers(ctx, batch)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range duplicates {
+		imp.writeReport(lines[i], batch[i].Email, "duplicate")
+	}
+	imp.duplicates += len(duplicates)
+	imp.imported += len(batch) - len(duplicates)
+
+	return nil
+}
+
+func (imp *importer) writeReport(line int, email string, reason string) {
+	_ = imp.report.Write([]string{fmt.Sprint(line), email, reason})
+}
+
+func toUser(rec record) (models.User, error) {
+	email, err := emailaddr.Normalize(rec.Email)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	passHash, err := password.ImportHash(rec.HashFormat, rec.PasswordHash, rec.Salt, rec.SaltPosition)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return models.User{Email: email, PassHash: passHash}, nil
+}
+
+func newCSVReader(in io.Reader) (func() (record, error), error) {
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %v", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, errors.New("csv header must contain email column")
+	}
+	if _, ok := columns["password_hash"]; !ok {
+		return nil, errors.New("csv header must contain password_hash column")
+	}
+
+	field := func(row []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return row[i]
+	}
+
+	return func() (record, error) {
+		row, err := r.Read()
+		if err != nil {
+			return record{}, err
+		}
+		line, _ := r.FieldPos(0)
+
+		return record{
+			Line:         line,
+			Email:        field(row, "email"),
+			PasswordHash: field(row, "password_hash"),
+			HashFormat:   field(row, "hash_format"),
+			Salt:         field(row, "salt"),
+			SaltPosition: field(row, "salt_position"),
+		}, nil
+	}, nil
+}
+
+func newJSONLReader(in io.Reader) func() (record, error) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+
+	return func() (record, error) {
+		for scanner.Scan() {
+			line++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+
+			var rec record
+			if err := json.Unmarshal([]byte(text), &rec); err != nil {
+				return record{Line: line, Invalid: "invalid json"}, nil
+			}
+			rec.Line = line
+
+			return rec, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return record{}, err
+		}
+
+		return record{}, io.EOF
+	}
+}
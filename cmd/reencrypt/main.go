@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/1abobik1/Single-Sign-On/internal/config"
+	"github.com/1abobik1/Single-Sign-On/internal/storage/postgresql"
+)
+
+// Перешифрование секретов приложений и TOTP текущим мастер-ключом.
+//
+// Смена мастер-ключа: добавить новый ключ в secrets.keys, указать его в
+// secrets.current_key_id, перезапустить сервер и выполнить команду с тем же
+// конфигом. После этого старый ключ можно удалить из конфигурации. Секреты,
+// сохраненные до включения шифрования, сервер шифрует сам при запуске.
+func main() {
+	cfg := config.MustLoad()
+
+	keyring, err := config.NewSecretsKeyring(cfg.Secrets)
+	if err != nil {
+		panic(err)
+	}
+
+	storage, err := postgresql.New(cfg.StoragePath, keyring)
+	if err != nil {
+		panic(err)
+	}
+	defer storage.Stop()
+
+	n, err := storage.ReencryptAppSecrets(context.Background())
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("re-encrypted app secrets: %d\n", n)
+
+	n, err = storage.ReencryptTOTPSecrets(context.Background())
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("re-encrypted TOTP secrets: %d\n", n)
+}
@@ -25,7 +25,7 @@ func main() {
 
 	log.Info("starting app...")
 
-	application := app.New(log, cfg.GRPC.Port, cfg.StoragePath, cfg.AcessTokenTTL, cfg.RefreshTokenTTL)
+	application := app.New(log, cfg)
 
 	go application.GRPCSrv.MustRun()
 
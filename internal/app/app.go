@@ -1,27 +1,243 @@
 package app
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"log/slog"
-	"time"
+	"os"
 
 	grpcapp "github.com/1abobik1/Single-Sign-On/internal/app/grpc"
+	"github.com/1abobik1/Single-Sign-On/internal/config"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/notify"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/password"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/policy"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/webauthn"
 	"github.com/1abobik1/Single-Sign-On/internal/services/auth"
 	"github.com/1abobik1/Single-Sign-On/internal/storage/postgresql"
+	"google.golang.org/grpc/credentials"
 )
 
+// envLocal — окружение разработчика: сообщения пользователям можно писать в лог,
+// а gRPC сервер может работать без TLS.
+const envLocal = "local"
+
 type App struct {
 	GRPCSrv *grpcapp.App
 }
 
-func New(log *slog.Logger, grpcPort int, storagePath string, AcessTokenTTL time.Duration, RefreshTokenTTL time.Duration) *App {
-	storage, err := postgresql.New(storagePath)
+func New(log *slog.Logger, cfg *config.Config) *App {
+	secretsKeyring, err := config.NewSecretsKeyring(cfg.Secrets)
+	if err != nil {
+		panic(err)
+	}
+
+	storage, err := postgresql.New(cfg.StoragePath, secretsKeyring)
+	if err != nil {
+		panic(err)
+	}
+
+	encrypted, err := storage.EncryptPlaintextSecrets(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	if encrypted > 0 {
+		log.Info("encrypted plaintext secrets", slog.Int("count", encrypted))
+	}
+
+	passPolicy, err := password.NewPolicy(
+		cfg.PasswordPolicy.MinLength,
+		cfg.PasswordPolicy.MaxLength,
+		cfg.PasswordPolicy.RequireUpper,
+		cfg.PasswordPolicy.RequireLower,
+		cfg.PasswordPolicy.RequireDigit,
+		cfg.PasswordPolicy.RequireSymbol,
+		cfg.PasswordPolicy.DenylistPath,
+		cfg.PasswordPolicy.BreachedPath,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	passwordHash := cfg.PasswordHash
+	hasher, err := password.NewHasher(password.Algorithm(passwordHash.Algorithm), password.Argon2Params{
+		Time:    passwordHash.Argon2Time,
+		Memory:  passwordHash.Argon2Memory,
+		Threads: passwordHash.Argon2Threads,
+		KeyLen:  passwordHash.Argon2KeyLen,
+		SaltLen: passwordHash.Argon2SaltLen,
+	}, passwordHash.BcryptCost)
+	if err != nil {
+		panic(err)
+	}
+
+	pepperKeys, err := config.PepperKeys(cfg.Pepper)
+	if err != nil {
+		panic(err)
+	}
+
+	pepperedHasher, err := password.NewPepperedHasher(hasher, cfg.Pepper.CurrentKeyID, pepperKeys)
+	if err != nil {
+		panic(err)
+	}
+
+	sender, err := newSender(log, cfg.Env, cfg.Notify)
+	if err != nil {
+		panic(err)
+	}
+
+	var policies []policy.Policy
+	if cfg.Authorization.PolicyPath != "" {
+		policies, err = policy.Load(cfg.Authorization.PolicyPath)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	authservice := auth.New(log, auth.Deps{
+		Storage:        storage,
+		PasswordPolicy: passPolicy,
+		Hasher:         pepperedHasher,
+		Sender:         sender,
+	}, auth.Config{
+		AccessTokenTTL:  cfg.AcessTokenTTL,
+		RefreshTokenTTL: cfg.RefreshTokenTTL,
+		Lockout: auth.LockoutPolicy{
+			MaxAttempts:  cfg.Lockout.MaxAttempts,
+			BaseDuration: cfg.Lockout.BaseDuration,
+			MaxDuration:  cfg.Lockout.MaxDuration,
+		},
+		MFA: auth.MFAPolicy{
+			Issuer:           cfg.MFA.Issuer,
+			ChallengeTTL:     cfg.MFA.ChallengeTTL,
+			RecoveryCodes:    cfg.MFA.RecoveryCodes,
+			RecoveryCodesLow: cfg.MFA.RecoveryCodesLow,
+			TrustedDeviceTTL: cfg.MFA.TrustedDeviceTTL,
+		},
+		WebAuthn: auth.WebAuthnPolicy{
+			RP: webauthn.RelyingParty{
+				ID:      cfg.WebAuthn.RPID,
+				Name:    cfg.WebAuthn.RPName,
+				Origins: cfg.WebAuthn.Origins,
+			},
+			ChallengeTTL: cfg.WebAuthn.ChallengeTTL,
+		},
+		Passwordless: auth.PasswordlessPolicy{
+			CodeTTL:       cfg.Passwordless.CodeTTL,
+			MaxAttempts:   cfg.Passwordless.MaxAttempts,
+			MaxRequests:   cfg.Passwordless.MaxRequests,
+			RequestWindow: cfg.Passwordless.RequestWindow,
+			LinkURL:       cfg.Passwordless.LinkURL,
+		},
+		Authorization: auth.AuthorizationPolicy{
+			DecisionTTL: cfg.Authorization.DecisionTTL,
+			Policies:    policies,
+		},
+		Invitation: auth.InvitationPolicy{
+			TTL:     cfg.Invitation.TTL,
+			LinkURL: cfg.Invitation.LinkURL,
+		},
+		ClientAuth: auth.ClientAuthPolicy{
+			CertificateApps: cfg.ClientAuth.CertificateApps,
+		},
+	})
+
+	creds, err := loadTLSCredentials(cfg.GRPC.TLS)
 	if err != nil {
 		panic(err)
 	}
-	authservice := auth.New(log, storage, AcessTokenTTL, RefreshTokenTTL)
-	grpcApp := grpcapp.New(log, authservice, grpcPort)
+	// Приложения передают свои секреты в метаданных запросов, а пользователи —
+	// пароли и токены, поэтому без TLS сервер запускается только локально
+	if creds == nil && cfg.Env != envLocal {
+		panic(fmt.Sprintf("grpc.tls.cert_file is required in env %q", cfg.Env))
+	}
+
+	grpcApp := grpcapp.New(log, authservice, authservice, creds, cfg.GRPC.Port)
 
 	return &App{
 		GRPCSrv: grpcApp,
 	}
 }
+
+// newSender выбирает отправителя для каждого канала по конфигурации. Вне
+// локального окружения сообщения не пишутся в лог: они содержат коды и ссылки
+// для входа, поэтому без SMTP сервер не запускается.
+func newSender(log *slog.Logger, env string, cfg config.NotifyConfig) (notify.Sender, error) {
+	const op = "app.newSender"
+
+	sender := notify.ChannelSender{}
+
+	if cfg.SMTP.Host != "" {
+		smtpSender, err := notify.NewSMTPSender(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.From)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		sender[notify.ChannelEmail] = smtpSender
+	}
+
+	if cfg.SMS.WebhookURL != "" {
+		smsSender, err := notify.NewWebhookSender(cfg.SMS.WebhookURL, cfg.SMS.Token)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		sender[notify.ChannelSMS] = smsSender
+	}
+
+	if env == envLocal {
+		logSender := notify.NewLogSender(log)
+		for _, channel := range []notify.Channel{notify.ChannelEmail, notify.ChannelSMS} {
+			if _, ok := sender[channel]; !ok {
+				sender[channel] = logSender
+			}
+		}
+		return sender, nil
+	}
+
+	if _, ok := sender[notify.ChannelEmail]; !ok {
+		return nil, fmt.Errorf("%s: notify.smtp is required in env %q", op, env)
+	}
+	if _, ok := sender[notify.ChannelSMS]; !ok {
+		log.Warn("sms webhook is not configured, phone numbers cannot be verified")
+	}
+
+	return sender, nil
+}
+
+// loadTLSCredentials загружает сертификат gRPC сервера и CA клиентских
+// сертификатов. Без сертификата возвращает nil — сервер работает без TLS,
+// что допустимо только в локальном окружении.
+func loadTLSCredentials(cfg config.TLSConfig) (credentials.TransportCredentials, error) {
+	const op = "app.loadTLSCredentials"
+
+	if cfg.CertFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates in %s", op, cfg.ClientCAFile)
+		}
+
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return credentials.NewTLS(tlsCfg), nil
+}
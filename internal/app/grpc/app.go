@@ -7,6 +7,7 @@ import (
 
 	grpcauth "github.com/1abobik1/Single-Sign-On/internal/grpc/auth"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 type App struct {
@@ -18,11 +19,21 @@ type App struct {
 func New(
 	log *slog.Logger,
 	authService grpcauth.Auth,
+	adminService grpcauth.Admin,
+	creds credentials.TransportCredentials,
 	port int,
 ) *App {
-	gRPCServer := grpc.NewServer()
+	opts := []grpc.ServerOption{grpc.ChainUnaryInterceptor(
+		grpcauth.AdminAuthInterceptor(adminService),
+	)}
+	if creds != nil {
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	gRPCServer := grpc.NewServer(opts...)
 
 	grpcauth.RegisterAuthServ(gRPCServer, authService)
+	grpcauth.RegisterAdminServ(gRPCServer, adminService)
 
 	return &App{
 		log:        log,
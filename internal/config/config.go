@@ -9,16 +9,181 @@ import (
 )
 
 type Config struct {
-	Env             string        `yaml:"env" env-default:"local"`
-	StoragePath     string        `yaml:"storage_path" env-required:"true"`
-	AcessTokenTTL   time.Duration `yaml:"access_token_ttl" env-required:"true"`
-	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env-required:"true"`
-	GRPC            GRPCConfig    `yaml:"grpc"`
+	Env             string               `yaml:"env" env-default:"local"`
+	StoragePath     string               `yaml:"storage_path" env-required:"true"`
+	AcessTokenTTL   time.Duration        `yaml:"access_token_ttl" env-required:"true"`
+	RefreshTokenTTL time.Duration        `yaml:"refresh_token_ttl" env-required:"true"`
+	GRPC            GRPCConfig           `yaml:"grpc"`
+	Lockout         LockoutConfig        `yaml:"lockout"`
+	PasswordPolicy  PasswordPolicyConfig `yaml:"password_policy"`
+	PasswordHash    PasswordHashConfig   `yaml:"password_hash"`
+	Pepper          PepperConfig         `yaml:"pepper"`
+	Secrets         SecretsConfig        `yaml:"secrets"`
+	MFA             MFAConfig            `yaml:"mfa"`
+	WebAuthn        WebAuthnConfig       `yaml:"webauthn"`
+	Passwordless    PasswordlessConfig   `yaml:"passwordless"`
+	Authorization   AuthorizationConfig  `yaml:"authorization"`
+	Invitation      InvitationConfig     `yaml:"invitation"`
+	ClientAuth      ClientAuthConfig     `yaml:"client_auth"`
+	Notify          NotifyConfig         `yaml:"notify"`
 }
 
 type GRPCConfig struct {
 	Port    int           `yaml:"port"`
 	TimeOut time.Duration `yaml:"timeout"`
+	TLS     TLSConfig     `yaml:"tls"`
+}
+
+// TLSConfig задает TLS для gRPC сервера. Без CertFile сервер работает без TLS;
+// это допустимо только в окружении local.
+// ClientCAFile включает проверку клиентских сертификатов (mTLS): сертификат
+// необязателен, но если он передан, то должен быть подписан этим CA.
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+// LockoutConfig задает временную блокировку входа после серии неудачных попыток.
+// MaxAttempts = 0 отключает блокировку.
+type LockoutConfig struct {
+	MaxAttempts  int           `yaml:"max_attempts" env-default:"5"`
+	BaseDuration time.Duration `yaml:"base_duration" env-default:"1m"`
+	MaxDuration  time.Duration `yaml:"max_duration" env-default:"1h"`
+}
+
+// PasswordPolicyConfig задает требования к паролям при регистрации.
+// MaxLength ограничен 72 байтами — дальше bcrypt пароль не учитывает.
+type PasswordPolicyConfig struct {
+	MinLength     int    `yaml:"min_length" env-default:"8"`
+	MaxLength     int    `yaml:"max_length" env-default:"72"`
+	RequireUpper  bool   `yaml:"require_upper"`
+	RequireLower  bool   `yaml:"require_lower"`
+	RequireDigit  bool   `yaml:"require_digit"`
+	RequireSymbol bool   `yaml:"require_symbol"`
+	DenylistPath  string `yaml:"denylist_path"`
+	BreachedPath  string `yaml:"breached_path"`
+}
+
+// PasswordHashConfig задает алгоритм и параметры хеширования паролей.
+// Хеши, построенные другим алгоритмом или с другими параметрами, пересчитываются при входе.
+type PasswordHashConfig struct {
+	Algorithm     string `yaml:"algorithm" env-default:"argon2id"`
+	Argon2Time    uint32 `yaml:"argon2_time" env-default:"2"`
+	Argon2Memory  uint32 `yaml:"argon2_memory_kib" env-default:"19456"`
+	Argon2Threads uint8  `yaml:"argon2_threads" env-default:"1"`
+	Argon2KeyLen  uint32 `yaml:"argon2_key_len" env-default:"32"`
+	Argon2SaltLen uint32 `yaml:"argon2_salt_len" env-default:"16"`
+	BcryptCost    int    `yaml:"bcrypt_cost" env-default:"10"`
+}
+
+// PepperConfig задает серверный секрет, добавляемый к паролям перед хешированием.
+// Новые хеши строятся с ключом CurrentKeyID, остальные ключи нужны для проверки
+// старых хешей до их пересчета. Пустой CurrentKeyID отключает pepper.
+type PepperConfig struct {
+	CurrentKeyID string            `yaml:"current_key_id" env:"PEPPER_CURRENT_KEY_ID"`
+	Keys         []PepperKeyConfig `yaml:"keys"`
+}
+
+// PepperKeyConfig — ключ pepper в base64: значение Key или путь к файлу File.
+type PepperKeyConfig struct {
+	ID   string `yaml:"id"`
+	Key  string `yaml:"key"`
+	File string `yaml:"file"`
+}
+
+// SecretsConfig задает мастер-ключи для шифрования секретов приложений и TOTP в БД.
+// Новые значения шифруются ключом CurrentKeyID; остальные ключи нужны для
+// расшифровки, пока значения не перешифрованы командой reencrypt.
+type SecretsConfig struct {
+	CurrentKeyID string            `yaml:"current_key_id" env:"SECRETS_CURRENT_KEY_ID"`
+	Keys         []SecretKeyConfig `yaml:"keys"`
+}
+
+// SecretKeyConfig — мастер-ключ (32 байта) в base64: значение Key или путь к файлу File.
+type SecretKeyConfig struct {
+	ID   string `yaml:"id"`
+	Key  string `yaml:"key"`
+	File string `yaml:"file"`
+}
+
+// MFAConfig задает параметры многофакторной аутентификации.
+type MFAConfig struct {
+	Issuer       string        `yaml:"issuer" env-default:"SSO"`
+	ChallengeTTL time.Duration `yaml:"challenge_ttl" env-default:"5m"`
+	// RecoveryCodes — число кодов восстановления, RecoveryCodesLow — остаток, при котором
+	// пользователь получает напоминание сгенерировать новые.
+	RecoveryCodes    int `yaml:"recovery_codes" env-default:"10"`
+	RecoveryCodesLow int `yaml:"recovery_codes_low" env-default:"3"`
+	// TrustedDeviceTTL — срок, на который устройство освобождается от второго фактора. 0 отключает.
+	TrustedDeviceTTL time.Duration `yaml:"trusted_device_ttl" env-default:"720h"`
+}
+
+// WebAuthnConfig задает relying party для WebAuthn. RPID — домен сайта, к которому
+// привязываются ключи, Origins — допустимые origin страниц входа.
+type WebAuthnConfig struct {
+	RPID         string        `yaml:"rp_id" env-default:"localhost"`
+	RPName       string        `yaml:"rp_name" env-default:"SSO"`
+	Origins      []string      `yaml:"origins" env-default:"http://localhost"`
+	ChallengeTTL time.Duration `yaml:"challenge_ttl" env-default:"5m"`
+}
+
+// PasswordlessConfig задает вход по одноразовому коду или ссылке из письма.
+// LinkURL — страница приложения, которая передает request_id и code из ссылки
+// в CompletePasswordlessLogin. Пустой LinkURL отключает ссылки.
+type PasswordlessConfig struct {
+	CodeTTL       time.Duration `yaml:"code_ttl" env-default:"10m"`
+	MaxAttempts   int           `yaml:"max_attempts" env-default:"5"`
+	MaxRequests   int           `yaml:"max_requests" env-default:"5"`
+	RequestWindow time.Duration `yaml:"request_window" env-default:"1h"`
+	LinkURL       string        `yaml:"link_url"`
+}
+
+// AuthorizationConfig задает параметры проверки разрешений для сервисов.
+// DecisionTTL — срок, на который вызывающие могут кешировать решения CheckPermission.
+// PolicyPath — JSON файл или каталог с файлами *.json политик доступа; необязателен.
+type AuthorizationConfig struct {
+	DecisionTTL time.Duration `yaml:"decision_ttl" env-default:"1m"`
+	PolicyPath  string        `yaml:"policy_path"`
+}
+
+// InvitationConfig задает приглашения в организации. LinkURL — страница приложения,
+// которая передает token из ссылки в AcceptInvitation. Пустой LinkURL — в письме
+// будет только токен.
+type InvitationConfig struct {
+	TTL     time.Duration `yaml:"ttl" env-default:"168h"`
+	LinkURL string        `yaml:"link_url"`
+}
+
+// ClientAuthConfig задает аутентификацию приложений, вызывающих внутренние RPC.
+// CertificateApps сопоставляет CN клиентского сертификата с ID приложения;
+// приложения без сертификата передают свой ID и секрет.
+type ClientAuthConfig struct {
+	CertificateApps map[string]int `yaml:"certificate_apps"`
+}
+
+// NotifyConfig задает доставку писем и SMS. Письма отправляются через SMTP,
+// SMS — HTTP шлюзу. Вне локального окружения SMTP обязателен; без SMS шлюза
+// номера телефонов нельзя подтвердить. В локальном окружении ненастроенные
+// каналы пишутся в лог.
+type NotifyConfig struct {
+	SMTP SMTPConfig `yaml:"smtp"`
+	SMS  SMSConfig  `yaml:"sms"`
+}
+
+// SMTPConfig — SMTP сервер с поддержкой STARTTLS. Пустой Host отключает отправку писем.
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port" env-default:"587"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+	From     string `yaml:"from"`
+}
+
+// SMSConfig — HTTPS адрес шлюза, принимающего SMS для отправки. Пустой URL отключает SMS.
+type SMSConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
+	Token      string `yaml:"token" env:"SMS_WEBHOOK_TOKEN"`
 }
 
 func MustLoad() *Config {
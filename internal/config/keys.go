@@ -0,0 +1,66 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/1abobik1/Single-Sign-On/internal/lib/envelope"
+)
+
+// NewSecretsKeyring создает Keyring для секретов в БД из мастер-ключей конфигурации.
+func NewSecretsKeyring(cfg SecretsConfig) (*envelope.Keyring, error) {
+	const op = "config.NewSecretsKeyring"
+
+	keys := make(map[string][]byte, len(cfg.Keys))
+	for _, k := range cfg.Keys {
+		key, err := decodeKey(k.Key, k.File)
+		if err != nil {
+			return nil, fmt.Errorf("%s: secrets key %q: %v", op, k.ID, err)
+		}
+		if _, ok := keys[k.ID]; ok {
+			return nil, fmt.Errorf("%s: duplicate secrets key %q", op, k.ID)
+		}
+		keys[k.ID] = key
+	}
+
+	keyring, err := envelope.NewKeyring(cfg.CurrentKeyID, keys)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return keyring, nil
+}
+
+// PepperKeys декодирует ключи pepper из конфига или файлов.
+func PepperKeys(cfg PepperConfig) (map[string][]byte, error) {
+	const op = "config.PepperKeys"
+
+	res := make(map[string][]byte, len(cfg.Keys))
+	for _, k := range cfg.Keys {
+		key, err := decodeKey(k.Key, k.File)
+		if err != nil {
+			return nil, fmt.Errorf("%s: pepper key %q: %v", op, k.ID, err)
+		}
+		if _, ok := res[k.ID]; ok {
+			return nil, fmt.Errorf("%s: duplicate pepper key %q", op, k.ID)
+		}
+		res[k.ID] = key
+	}
+
+	return res, nil
+}
+
+// decodeKey декодирует ключ в base64 из значения encoded или файла file.
+func decodeKey(encoded string, file string) ([]byte, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(data)
+	}
+
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+}
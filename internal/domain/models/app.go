@@ -4,4 +4,7 @@ type App struct {
 	ID     int
 	Name   string
 	Secret string
-}
\ No newline at end of file
+	// Trusted — приложение может проверять роли и разрешения пользователей в
+	// других приложениях и вызывать IsAdmin.
+	Trusted bool
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// TrustedDevice — устройство, на котором пользователь прошел второй фактор и
+// попросил не запрашивать его до ExpiresAt.
+type TrustedDevice struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
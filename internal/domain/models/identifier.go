@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type IdentifierKind string
+
+const (
+	IdentifierEmail    IdentifierKind = "email"
+	IdentifierUsername IdentifierKind = "username"
+	IdentifierPhone    IdentifierKind = "phone"
+)
+
+// Identifier — значение, по которому пользователь может войти в систему.
+// У пользователя может быть не больше одного идентификатора каждого вида.
+type Identifier struct {
+	ID         int64
+	UserID     int64
+	Kind       IdentifierKind
+	Value      string
+	VerifiedAt time.Time
+}
+
+func (i Identifier) Verified() bool {
+	return !i.VerifiedAt.IsZero()
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Invitation — приглашение в организацию, отправленное на email. Принимается
+// один раз до ExpiresAt.
+type Invitation struct {
+	ID         string
+	OrgID      int64
+	AppID      int
+	Email      string
+	Role       OrgRole
+	InvitedBy  int64
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	AcceptedAt time.Time
+	AcceptedBy int64
+}
+
+func (i Invitation) Accepted() bool {
+	return !i.AcceptedAt.IsZero()
+}
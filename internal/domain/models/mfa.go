@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// TOTP — секрет приложения-аутентификатора пользователя.
+// Пока ConfirmedAt нулевой, подключение не завершено и второй фактор не требуется.
+type TOTP struct {
+	UserID       int64
+	Secret       string
+	ConfirmedAt  time.Time
+	LastUsedStep int64
+}
+
+func (t TOTP) Confirmed() bool {
+	return !t.ConfirmedAt.IsZero()
+}
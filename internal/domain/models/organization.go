@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// OrgRole — роль участника в организации.
+type OrgRole string
+
+const (
+	OrgRoleOwner  OrgRole = "owner"
+	OrgRoleAdmin  OrgRole = "admin"
+	OrgRoleMember OrgRole = "member"
+)
+
+var orgRoleRanks = map[OrgRole]int{
+	OrgRoleMember: 1,
+	OrgRoleAdmin:  2,
+	OrgRoleOwner:  3,
+}
+
+// Valid сообщает, является ли роль одной из известных.
+func (r OrgRole) Valid() bool {
+	_, ok := orgRoleRanks[r]
+	return ok
+}
+
+// AtLeast сообщает, дает ли роль r права не меньше, чем min.
+func (r OrgRole) AtLeast(min OrgRole) bool {
+	return orgRoleRanks[r] >= orgRoleRanks[min]
+}
+
+// Organization — клиент-организация, объединяющая пользователей.
+type Organization struct {
+	ID        int64
+	Name      string
+	Slug      string
+	CreatedAt time.Time
+}
+
+// OrgMember — участник организации.
+type OrgMember struct {
+	OrgID     int64
+	UserID    int64
+	Email     string
+	Role      OrgRole
+	CreatedAt time.Time
+}
+
+// Membership — организация, в которой состоит пользователь, и его роль в ней.
+type Membership struct {
+	Organization Organization
+	Role         OrgRole
+	JoinedAt     time.Time
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// PasswordlessLogin — запрос входа без пароля: код и ссылка отправлены пользователю
+// на email и действуют до ExpiresAt.
+type PasswordlessLogin struct {
+	ID        string
+	UserID    int64
+	AppID     int
+	ExpiresAt time.Time
+}
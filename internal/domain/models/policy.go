@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Policy — политика доступа приложения, хранимая в БД. Document — JSON
+// в формате internal/lib/policy; ID политики в нем совпадает с Name.
+type Policy struct {
+	ID        int64
+	AppID     int
+	Name      string
+	Document  []byte
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
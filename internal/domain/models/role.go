@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Role — набор разрешений в рамках приложения. AppID = 0 — глобальная роль,
+// действующая во всех приложениях.
+type Role struct {
+	ID          int64
+	AppID       int
+	Name        string
+	Description string
+	Permissions []string
+	CreatedAt   time.Time
+}
+
+func (r Role) Global() bool {
+	return r.AppID == 0
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Scope — область доступа OAuth, определенная приложением AppID.
+// Другие приложения получают ее в токенах, если она есть в их разрешенных scope.
+type Scope struct {
+	ID          int64
+	AppID       int
+	Name        string
+	Description string
+	CreatedAt   time.Time
+}
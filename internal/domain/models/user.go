@@ -1,8 +1,63 @@
 package models
 
+import "time"
+
 type User struct {
 	ID           int64
 	Email        string
 	PassHash     []byte
 	RefreshToken string
+
+	FailedLoginAttempts int
+	LockoutCount        int
+	LockedUntil         time.Time
+
+	Profile
+	// Attributes — атрибуты пользователя для политик доступа (отдел, должность и т.п.).
+	Attributes map[string]string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+
+	Status          UserStatus
+	SuspendedUntil  time.Time
+	StatusReason    string
+	StatusChangedAt time.Time
+}
+
+type UserStatus string
+
+const (
+	UserActive          UserStatus = "active"
+	UserDisabled        UserStatus = "disabled"
+	UserSuspended       UserStatus = "suspended"
+	UserPendingApproval UserStatus = "pending_approval"
+)
+
+// EffectiveStatus возвращает статус с учетом истечения приостановки.
+func (u User) EffectiveStatus(now time.Time) UserStatus {
+	if u.Status == UserSuspended && !u.SuspendedUntil.IsZero() && !u.SuspendedUntil.After(now) {
+		return UserActive
+	}
+
+	return u.Status
+}
+
+// UserFilter — условия выборки пользователей для администрирования.
+// Пустые поля выборку не ограничивают.
+type UserFilter struct {
+	EmailPrefix   string
+	Status        UserStatus
+	RoleID        int64
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+// Profile — данные пользователя, которые он может менять сам.
+type Profile struct {
+	DisplayName string
+	GivenName   string
+	FamilyName  string
+	Locale      string
+	Timezone    string
+	AvatarURL   string
 }
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// WebAuthnCredential — ключ WebAuthn (passkey или аппаратный токен) пользователя.
+type WebAuthnCredential struct {
+	ID           int64
+	UserID       int64
+	CredentialID []byte
+	// PublicKey — открытый ключ в формате COSE_Key.
+	PublicKey  []byte
+	SignCount  uint32
+	Name       string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+// Виды церемоний WebAuthn.
+const (
+	WebAuthnRegistration = "registration"
+	WebAuthnLogin        = "login"
+	WebAuthnMFA          = "mfa"
+)
+
+// WebAuthnChallenge — выданный клиенту challenge незавершенной церемонии.
+// UserID нулевой при входе без указания логина.
+type WebAuthnChallenge struct {
+	Challenge []byte
+	Kind      string
+	UserID    int64
+	AppID     int
+	ExpiresAt time.Time
+}
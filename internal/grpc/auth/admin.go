@@ -0,0 +1,353 @@
+package grpcauth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/services/auth"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+	sso "github.com/1abobik1/Single-Sign-On/protos/gen/go/sso"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Admin — операции администрирования пользователей. Каждый метод сам проверяет,
+// что вызывающий — администратор; AdminAuthInterceptor дополнительно закрывает
+// весь сервис для токенов без разрешения администратора.
+type Admin interface {
+	ClientAuthenticator
+
+	AuthorizeAdmin(ctx context.Context, client models.App, accessToken string) (adminID int64, err error)
+
+	ListUsers(ctx context.Context, accessToken string, filter models.UserFilter, pageToken string, pageSize int) (users []models.User, nextPageToken string, err error)
+	GetUser(ctx context.Context, accessToken string, userID int64) (models.User, error)
+	SetUserStatus(ctx context.Context, accessToken string, userID int64, status models.UserStatus, suspendedUntil time.Time, reason string) (models.User, error)
+	SetRoles(ctx context.Context, accessToken string, userID int64, appID int, roleIDs []int64) ([]models.Role, error)
+	ResetMFA(ctx context.Context, accessToken string, userID int64) error
+	ForceLogout(ctx context.Context, accessToken string, userID int64) error
+
+	CreateApp(ctx context.Context, accessToken string, app models.App) (models.App, error)
+	GetApp(ctx context.Context, accessToken string, appID int) (models.App, error)
+	ListApps(ctx context.Context, accessToken string) ([]models.App, error)
+	UpdateApp(ctx context.Context, accessToken string, appID int, update auth.AppUpdate) (models.App, error)
+	DeleteApp(ctx context.Context, accessToken string, appID int) error
+	RotateAppSecret(ctx context.Context, accessToken string, appID int) (secret string, err error)
+}
+
+type adminAPI struct {
+	sso.UnimplementedAdminServer
+	admin Admin
+}
+
+func RegisterAdminServ(gRPC *grpc.Server, admin Admin) {
+	sso.RegisterAdminServer(gRPC, &adminAPI{admin: admin})
+}
+
+// AdminAuthInterceptor пропускает вызовы сервиса Admin только от доверенного
+// приложения (клиентский сертификат mTLS или заголовок "authorization: Basic")
+// с access токеном администратора, выданным этому приложению. Вызовы других
+// сервисов не проверяются.
+func AdminAuthInterceptor(admin Admin) grpc.UnaryServerInterceptor {
+	prefix := "/" + sso.Admin_ServiceDesc.ServiceName + "/"
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !strings.HasPrefix(info.FullMethod, prefix) {
+			return handler(ctx, req)
+		}
+
+		client, err := authenticateClient(ctx, admin)
+		if err != nil {
+			return nil, err
+		}
+
+		accessToken, err := bearerToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := admin.AuthorizeAdmin(ctx, client, accessToken); err != nil {
+			if errors.Is(err, auth.ErrPermissionDenied) {
+				return nil, status.Error(codes.PermissionDenied, "admin access token is required")
+			}
+			return nil, callerError(err)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (s *adminAPI) ListUsers(ctx context.Context, req *sso.ListUsersRequest) (*sso.ListUsersResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := models.UserFilter{
+		EmailPrefix: req.GetEmailPrefix(),
+		Status:      models.UserStatus(req.GetStatus()),
+		RoleID:      req.GetRoleId(),
+	}
+	if req.GetCreatedAfter() != nil {
+		filter.CreatedAfter = req.GetCreatedAfter().AsTime()
+	}
+	if req.GetCreatedBefore() != nil {
+		filter.CreatedBefore = req.GetCreatedBefore().AsTime()
+	}
+
+	users, next, err := s.admin.ListUsers(ctx, accessToken, filter, req.GetPageToken(), int(req.GetPageSize()))
+	if err != nil {
+		return nil, roleError(err)
+	}
+
+	resp := &sso.ListUsersResponse{NextPageToken: next}
+	for _, user := range users {
+		resp.Users = append(resp.Users, toUser(user))
+	}
+
+	return resp, nil
+}
+
+func (s *adminAPI) GetUser(ctx context.Context, req *sso.GetUserRequest) (*sso.User, error) {
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.admin.GetUser(ctx, accessToken, req.GetUserId())
+	if err != nil {
+		return nil, roleError(err)
+	}
+
+	return toUser(user), nil
+}
+
+func (s *adminAPI) SetUserStatus(ctx context.Context, req *sso.SetUserStatusRequest) (*sso.SetUserStatusResponse, error) {
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if req.GetStatus() == "" {
+		return nil, status.Error(codes.InvalidArgument, "status is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var suspendedUntil time.Time
+	if req.GetSuspendedUntil() != nil {
+		suspendedUntil = req.GetSuspendedUntil().AsTime()
+	}
+
+	user, err := s.admin.SetUserStatus(ctx, accessToken, req.GetUserId(), models.UserStatus(req.GetStatus()), suspendedUntil, req.GetReason())
+	if err != nil {
+		return nil, roleError(err)
+	}
+
+	return &sso.SetUserStatusResponse{User: toUser(user)}, nil
+}
+
+func (s *adminAPI) SetRoles(ctx context.Context, req *sso.SetRolesRequest) (*sso.SetRolesResponse, error) {
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.admin.SetRoles(ctx, accessToken, req.GetUserId(), int(req.GetAppId()), req.GetRoleIds())
+	if err != nil {
+		return nil, roleError(err)
+	}
+
+	resp := &sso.SetRolesResponse{}
+	for _, role := range roles {
+		resp.Roles = append(resp.Roles, toRole(role))
+	}
+
+	return resp, nil
+}
+
+func (s *adminAPI) ResetMFA(ctx context.Context, req *sso.ResetMFARequest) (*sso.ResetMFAResponse, error) {
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.admin.ResetMFA(ctx, accessToken, req.GetUserId()); err != nil {
+		return nil, roleError(err)
+	}
+
+	return &sso.ResetMFAResponse{}, nil
+}
+
+func (s *adminAPI) ForceLogout(ctx context.Context, req *sso.ForceLogoutRequest) (*sso.ForceLogoutResponse, error) {
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.admin.ForceLogout(ctx, accessToken, req.GetUserId()); err != nil {
+		return nil, roleError(err)
+	}
+
+	return &sso.ForceLogoutResponse{}, nil
+}
+
+// CreateApp возвращает секрет нового приложения. Повторно его получить нельзя,
+// только сгенерировать новый через RotateAppSecret.
+func (s *adminAPI) CreateApp(ctx context.Context, req *sso.CreateAppRequest) (*sso.CreateAppResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := s.admin.CreateApp(ctx, accessToken, models.App{
+		Name:    req.GetName(),
+		Trusted: req.GetTrusted(),
+	})
+	if err != nil {
+		return nil, appError(err)
+	}
+
+	return &sso.CreateAppResponse{App: toApp(app), Secret: app.Secret}, nil
+}
+
+func (s *adminAPI) GetApp(ctx context.Context, req *sso.GetAppRequest) (*sso.App, error) {
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := s.admin.GetApp(ctx, accessToken, int(req.GetAppId()))
+	if err != nil {
+		return nil, appError(err)
+	}
+
+	return toApp(app), nil
+}
+
+func (s *adminAPI) ListApps(ctx context.Context, req *sso.ListAppsRequest) (*sso.ListAppsResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	apps, err := s.admin.ListApps(ctx, accessToken)
+	if err != nil {
+		return nil, appError(err)
+	}
+
+	resp := &sso.ListAppsResponse{}
+	for _, app := range apps {
+		resp.Apps = append(resp.Apps, toApp(app))
+	}
+
+	return resp, nil
+}
+
+func (s *adminAPI) UpdateApp(ctx context.Context, req *sso.UpdateAppRequest) (*sso.App, error) {
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := s.admin.UpdateApp(ctx, accessToken, int(req.GetAppId()), auth.AppUpdate{
+		Name:    req.Name,
+		Trusted: req.Trusted,
+	})
+	if err != nil {
+		return nil, appError(err)
+	}
+
+	return toApp(app), nil
+}
+
+func (s *adminAPI) DeleteApp(ctx context.Context, req *sso.DeleteAppRequest) (*sso.DeleteAppResponse, error) {
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.admin.DeleteApp(ctx, accessToken, int(req.GetAppId())); err != nil {
+		return nil, appError(err)
+	}
+
+	return &sso.DeleteAppResponse{}, nil
+}
+
+func (s *adminAPI) RotateAppSecret(ctx context.Context, req *sso.RotateAppSecretRequest) (*sso.RotateAppSecretResponse, error) {
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := s.admin.RotateAppSecret(ctx, accessToken, int(req.GetAppId()))
+	if err != nil {
+		return nil, appError(err)
+	}
+
+	return &sso.RotateAppSecretResponse{Secret: secret}, nil
+}
+
+func appError(err error) error {
+	var validationErr *auth.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationStatus(validationErr)
+	}
+
+	switch {
+	case errors.Is(err, auth.ErrAppExists):
+		return status.Error(codes.AlreadyExists, "app name is taken")
+	case errors.Is(err, storage.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	}
+
+	return callerError(err)
+}
+
+// toApp не передает секрет приложения: он возвращается отдельным полем только
+// при создании и ротации.
+func toApp(app models.App) *sso.App {
+	return &sso.App{
+		Id:      int32(app.ID),
+		Name:    app.Name,
+		Trusted: app.Trusted,
+	}
+}
@@ -2,22 +2,114 @@ package grpcauth
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
 	"github.com/1abobik1/Single-Sign-On/internal/services/auth"
 	"github.com/1abobik1/Single-Sign-On/internal/storage"
+	sso "github.com/1abobik1/Single-Sign-On/protos/gen/go/sso"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// ClientAuthenticator проверяет учетные данные приложения, вызывающего внутренние RPC.
+type ClientAuthenticator interface {
+	AuthenticateClient(ctx context.Context, appID int, secret string) (models.App, error)
+	AuthenticateClientCertificate(ctx context.Context, commonName string) (models.App, error)
+}
+
 type Auth interface {
-	Login(ctx context.Context, email string, password string, appID int) (acceess_token string, refresh_token string, err error)
+	ClientAuthenticator
+
+	Login(ctx context.Context, login string, password string, appID int, req auth.AuthRequirements, deviceToken string) (acceess_token string, refresh_token string, err error)
+
+	RefreshAccessToken(ctx context.Context, refreshToken string, appID int, req auth.AuthRequirements) (acceess_token string, err error)
+
+	RegisterNewUser(ctx context.Context, email string, password string, appID int) (UserID int64, acceess_token string, refresh_token string, err error)
+
+	IsAdmin(ctx context.Context, client models.App, UserID int64) (bool, error)
+
+	UnlockUser(ctx context.Context, accessToken string, userID int64) error
+
+	ListIdentifiers(ctx context.Context, accessToken string) ([]models.Identifier, error)
+	AddIdentifier(ctx context.Context, accessToken string, kind models.IdentifierKind, value string) (models.Identifier, error)
+	VerifyIdentifier(ctx context.Context, accessToken string, kind models.IdentifierKind, code string) error
+	RemoveIdentifier(ctx context.Context, accessToken string, kind models.IdentifierKind) error
+
+	GetMe(ctx context.Context, accessToken string) (models.User, error)
+	UpdateMe(ctx context.Context, accessToken string, update auth.ProfileUpdate) (models.User, error)
+
+	SetUserStatus(ctx context.Context, accessToken string, userID int64, status models.UserStatus, suspendedUntil time.Time, reason string) (models.User, error)
+
+	EnrollTOTP(ctx context.Context, accessToken string) (secret string, uri string, err error)
+	ConfirmTOTP(ctx context.Context, accessToken string, code string) (recoveryCodes []string, err error)
+	RegenerateRecoveryCodes(ctx context.Context, accessToken string, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, accessToken string, code string) error
+	VerifyMFA(ctx context.Context, challengeToken string, code string) (acceess_token string, refresh_token string, err error)
+
+	BeginWebAuthnRegistration(ctx context.Context, accessToken string) (optionsJSON []byte, err error)
+	FinishWebAuthnRegistration(ctx context.Context, accessToken string, name string, response []byte) (models.WebAuthnCredential, error)
+	ListWebAuthnCredentials(ctx context.Context, accessToken string) ([]models.WebAuthnCredential, error)
+	RemoveWebAuthnCredential(ctx context.Context, accessToken string, credentialID int64) error
+	BeginWebAuthnLogin(ctx context.Context, login string, appID int) (optionsJSON []byte, err error)
+	FinishWebAuthnLogin(ctx context.Context, response []byte, appID int, req auth.AuthRequirements) (acceess_token string, refresh_token string, err error)
+	BeginWebAuthnMFA(ctx context.Context, challengeToken string) (optionsJSON []byte, err error)
+	FinishWebAuthnMFA(ctx context.Context, challengeToken string, response []byte) (acceess_token string, refresh_token string, err error)
+
+	StartPasswordlessLogin(ctx context.Context, email string, appID int) (requestID string, err error)
+	CompletePasswordlessLogin(ctx context.Context, requestID string, code string, appID int, req auth.AuthRequirements) (acceess_token string, refresh_token string, err error)
+
+	TrustDevice(ctx context.Context, accessToken string, name string) (device models.TrustedDevice, deviceToken string, err error)
+	ListTrustedDevices(ctx context.Context, accessToken string) ([]models.TrustedDevice, error)
+	RevokeTrustedDevice(ctx context.Context, accessToken string, deviceID int64) error
+	RevokeAllTrustedDevices(ctx context.Context, accessToken string) error
+
+	CreateRole(ctx context.Context, accessToken string, role models.Role) (models.Role, error)
+	DeleteRole(ctx context.Context, accessToken string, roleID int64) error
+	ListRoles(ctx context.Context, accessToken string, appID int) ([]models.Role, error)
+	AssignRole(ctx context.Context, accessToken string, userID int64, roleID int64) error
+	UnassignRole(ctx context.Context, accessToken string, userID int64, roleID int64) error
+	ListUserRoles(ctx context.Context, accessToken string, userID int64, appID int) ([]models.Role, error)
+
+	DefineScope(ctx context.Context, accessToken string, scope models.Scope) (models.Scope, error)
+	DeleteScope(ctx context.Context, accessToken string, appID int, name string) error
+	ListScopes(ctx context.Context, accessToken string, appID int) ([]models.Scope, error)
+	SetAllowedScopes(ctx context.Context, accessToken string, appID int, names []string) ([]models.Scope, error)
+	ListAllowedScopes(ctx context.Context, accessToken string, appID int) ([]models.Scope, error)
 
-	RegisterNewUser(ctx context.Context, email string, password string) (UserID int64, acceess_token string, refresh_token string, err error)
+	CreateOrganization(ctx context.Context, accessToken string, name string, slug string) (models.Organization, error)
+	ListOrganizations(ctx context.Context, accessToken string) ([]models.Membership, error)
+	ListOrgMembers(ctx context.Context, accessToken string, orgID int64) ([]models.OrgMember, error)
+	AddOrgMember(ctx context.Context, accessToken string, orgID int64, userID int64, role models.OrgRole) (models.OrgMember, error)
+	UpdateOrgMemberRole(ctx context.Context, accessToken string, orgID int64, userID int64, role models.OrgRole) (models.OrgMember, error)
+	RemoveOrgMember(ctx context.Context, accessToken string, orgID int64, userID int64) error
+	SwitchOrganization(ctx context.Context, refreshToken string, appID int, orgID int64) (acceess_token string, refresh_token string, err error)
+	InviteOrgMember(ctx context.Context, accessToken string, orgID int64, email string, role models.OrgRole) (models.Invitation, error)
+	ListInvitations(ctx context.Context, accessToken string, orgID int64) ([]models.Invitation, error)
+	RevokeInvitation(ctx context.Context, accessToken string, orgID int64, invitationID string) error
+	AcceptInvitation(ctx context.Context, accessToken string, invitationToken string) (models.OrgMember, error)
+	AcceptInvitationWithRegistration(ctx context.Context, invitationToken string, password string) (member models.OrgMember, acceess_token string, refresh_token string, err error)
 
-	IsAdmin(ctx context.Context, UserID int64) (bool, error)
+	CheckPermission(ctx context.Context, client models.App, userID int64, appID int, check auth.PermissionCheck, opts auth.CheckOptions) (decision auth.PermissionDecision, cacheTTL time.Duration, err error)
+	CheckPermissions(ctx context.Context, client models.App, userID int64, appID int, checks []auth.PermissionCheck, opts auth.CheckOptions) (decisions []auth.PermissionDecision, cacheTTL time.Duration, err error)
+
+	PutPolicy(ctx context.Context, accessToken string, appID int, document []byte) (models.Policy, error)
+	DeletePolicy(ctx context.Context, accessToken string, appID int, name string) error
+	ListPolicies(ctx context.Context, accessToken string, appID int) ([]models.Policy, error)
+	SetUserAttributes(ctx context.Context, accessToken string, userID int64, attributes map[string]string) (models.User, error)
 }
 
 type serverAPI struct {
@@ -30,8 +122,13 @@ func RegisterAuthServ(gRPC *grpc.Server, auth Auth) {
 }
 
 func (s *serverAPI) Login(ctx context.Context, req *sso.LoginRequest) (*sso.LoginResponse, error) {
-	if req.GetEmail() == "" {
-		return nil, status.Error(codes.InvalidArgument, "email is required")
+	// identifier — email, имя пользователя или телефон; email оставлен для старых клиентов
+	login := req.GetIdentifier()
+	if login == "" {
+		login = req.GetEmail()
+	}
+	if login == "" {
+		return nil, status.Error(codes.InvalidArgument, "identifier is required")
 	}
 
 	if req.GetPassword() == "" {
@@ -42,16 +139,95 @@ func (s *serverAPI) Login(ctx context.Context, req *sso.LoginRequest) (*sso.Logi
 		return nil, status.Error(codes.InvalidArgument, "app_id is required")
 	}
 
-	acceess_token, refresh_token, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()))
+	acceess_token, refresh_token, err := s.auth.Login(ctx, login, req.GetPassword(), int(req.GetAppId()), authRequirements(req.GetAcrValues(), req.GetMaxAge(), req.GetScope()), req.GetDeviceToken())
 	if err != nil {
 		if errors.Is(err, auth.ErrInvalidCredentials) {
 			return nil, status.Error(codes.InvalidArgument, "invalid email or password")
 		}
 
+		var mfaErr *auth.MFARequiredError
+		if errors.As(err, &mfaErr) {
+			return &sso.LoginResponse{
+				MfaRequired:       true,
+				MfaChallengeToken: mfaErr.ChallengeToken,
+				MfaMethods:        mfaErr.Methods,
+			}, nil
+		}
+
+		var validationErr *auth.ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, validationStatus(validationErr)
+		}
+
+		var lockedErr *auth.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(ctx, lockedErr)
+		}
+
+		if st, ok := accountStatusError(err); ok {
+			return nil, st
+		}
+
+		if st, ok := stepUpError(err); ok {
+			return nil, st
+		}
+
+		if st, ok := scopeError(err); ok {
+			return nil, st
+		}
+
 		return nil, status.Error(codes.Internal, "failed to login")
 	}
 
-	return &sso.LoginResponse{acceess_token: acceess_token, refresh_token: refresh_token}, nil
+	return &sso.LoginResponse{AccessToken: acceess_token, RefreshToken: refresh_token}, nil
+}
+
+func (s *serverAPI) Refresh(ctx context.Context, req *sso.RefreshRequest) (*sso.LoginResponse, error) {
+	if req.GetRefreshToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "refresh_token is required")
+	}
+
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	accessToken, err := s.auth.RefreshAccessToken(ctx, req.GetRefreshToken(), int(req.GetAppId()), authRequirements(req.GetAcrValues(), req.GetMaxAge(), req.GetScope()))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) || errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+		}
+
+		// Уровня сессии недостаточно: клиент проходит второй фактор через VerifyMFA
+		var mfaErr *auth.MFARequiredError
+		if errors.As(err, &mfaErr) {
+			return &sso.LoginResponse{
+				MfaRequired:       true,
+				MfaChallengeToken: mfaErr.ChallengeToken,
+				MfaMethods:        mfaErr.Methods,
+			}, nil
+		}
+
+		var validationErr *auth.ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, validationStatus(validationErr)
+		}
+
+		if st, ok := accountStatusError(err); ok {
+			return nil, st
+		}
+
+		if st, ok := stepUpError(err); ok {
+			return nil, st
+		}
+
+		if st, ok := scopeError(err); ok {
+			return nil, st
+		}
+
+		return nil, status.Error(codes.Internal, "failed to refresh token")
+	}
+
+	return &sso.LoginResponse{AccessToken: accessToken}, nil
 }
 
 func (s *serverAPI) Register(ctx context.Context, req *sso.RegisterRequest) (*sso.RegisterResponse, error) {
@@ -64,17 +240,32 @@ func (s *serverAPI) Register(ctx context.Context, req *sso.RegisterRequest) (*ss
 		return nil, status.Error(codes.InvalidArgument, "password is required")
 	}
 
-	user_id, err := s.auth.RegisterNewUser(ctx, req.GetEmail(), req.GetPassword())
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	user_id, acceess_token, refresh_token, err := s.auth.RegisterNewUser(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()))
 	if err != nil {
 		if errors.Is(err, storage.ErrUserExists) {
 			return nil, status.Error(codes.AlreadyExists, "user already exists")
 		}
 
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+
+		var validationErr *auth.ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, validationStatus(validationErr)
+		}
+
 		return nil, status.Error(codes.Internal, "internal server error")
 	}
 
 	return &sso.RegisterResponse{
-		UserId: user_id,
+		UserId:       user_id,
+		AccessToken:  acceess_token,
+		RefreshToken: refresh_token,
 	}, nil
 }
 
@@ -83,10 +274,15 @@ func (s *serverAPI) IsAdmin(ctx context.Context, req *sso.IsAdminRequest) (*sso.
 		return nil, status.Error(codes.InvalidArgument, "user_id is requuired")
 	}
 
-	is_admin, err := s.auth.IsAdmin(ctx, req.GetUserId())
+	client, err := authenticateClient(ctx, s.auth)
 	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
-			return nil, status.Error(codes.NotFound, "user not found")
+		return nil, err
+	}
+
+	is_admin, err := s.auth.IsAdmin(ctx, client, req.GetUserId())
+	if err != nil {
+		if errors.Is(err, auth.ErrPermissionDenied) {
+			return nil, status.Error(codes.PermissionDenied, "app is not allowed to query admin status")
 		}
 
 		return nil, status.Error(codes.Internal, "internal server error")
@@ -96,3 +292,1748 @@ func (s *serverAPI) IsAdmin(ctx context.Context, req *sso.IsAdminRequest) (*sso.
 		IsAdmin: is_admin,
 	}, nil
 }
+
+// CheckPermission с explain возвращает вместе с решением объяснение: какие роли
+// и политики на него повлияли.
+func (s *serverAPI) CheckPermission(ctx context.Context, req *sso.CheckPermissionRequest) (*sso.CheckPermissionResponse, error) {
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	client, err := authenticateClient(ctx, s.auth)
+	if err != nil {
+		return nil, err
+	}
+
+	decision, ttl, err := s.auth.CheckPermission(ctx, client, req.GetUserId(), int(req.GetAppId()), auth.PermissionCheck{
+		Permission:         req.GetPermission(),
+		Resource:           req.GetResource(),
+		ResourceAttributes: req.GetResourceAttributes(),
+	}, auth.CheckOptions{Context: req.GetContext(), Explain: req.GetExplain()})
+	if err != nil {
+		return nil, permissionCheckError(err)
+	}
+
+	return &sso.CheckPermissionResponse{
+		Allowed:  decision.Allowed,
+		CacheTtl: durationpb.New(ttl),
+		Trace:    toDecisionTrace(decision.Trace),
+	}, nil
+}
+
+func (s *serverAPI) CheckPermissions(ctx context.Context, req *sso.CheckPermissionsRequest) (*sso.CheckPermissionsResponse, error) {
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	checks := make([]auth.PermissionCheck, 0, len(req.GetChecks()))
+	for _, check := range req.GetChecks() {
+		checks = append(checks, auth.PermissionCheck{
+			Permission:         check.GetPermission(),
+			Resource:           check.GetResource(),
+			ResourceAttributes: check.GetResourceAttributes(),
+		})
+	}
+
+	client, err := authenticateClient(ctx, s.auth)
+	if err != nil {
+		return nil, err
+	}
+
+	decisions, ttl, err := s.auth.CheckPermissions(ctx, client, req.GetUserId(), int(req.GetAppId()), checks, auth.CheckOptions{
+		Context: req.GetContext(),
+		Explain: req.GetExplain(),
+	})
+	if err != nil {
+		return nil, permissionCheckError(err)
+	}
+
+	resp := &sso.CheckPermissionsResponse{CacheTtl: durationpb.New(ttl)}
+	for i, check := range checks {
+		resp.Results = append(resp.Results, &sso.PermissionResult{
+			Permission: check.Permission,
+			Resource:   check.Resource,
+			Allowed:    decisions[i].Allowed,
+			Trace:      toDecisionTrace(decisions[i].Trace),
+		})
+	}
+
+	return resp, nil
+}
+
+func toDecisionTrace(trace []auth.DecisionStep) []*sso.DecisionStep {
+	if len(trace) == 0 {
+		return nil
+	}
+
+	out := make([]*sso.DecisionStep, 0, len(trace))
+	for _, step := range trace {
+		out = append(out, &sso.DecisionStep{
+			Source:  step.Source,
+			Name:    step.Name,
+			Effect:  string(step.Effect),
+			Matched: step.Matched,
+			Reason:  step.Reason,
+		})
+	}
+
+	return out
+}
+
+// permissionCheckError переводит ошибки проверки разрешений в gRPC статусы.
+func permissionCheckError(err error) error {
+	var validationErr *auth.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationStatus(validationErr)
+	}
+
+	switch {
+	case errors.Is(err, auth.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, "app is not allowed to check permissions of another app")
+	case errors.Is(err, storage.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	}
+
+	return status.Error(codes.Internal, "internal server error")
+}
+
+func (s *serverAPI) UnlockUser(ctx context.Context, req *sso.UnlockUserRequest) (*sso.UnlockUserResponse, error) {
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.UnlockUser(ctx, accessToken, req.GetUserId()); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+
+		return nil, callerError(err)
+	}
+
+	return &sso.UnlockUserResponse{}, nil
+}
+
+func (s *serverAPI) ListIdentifiers(ctx context.Context, req *sso.ListIdentifiersRequest) (*sso.ListIdentifiersResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	idents, err := s.auth.ListIdentifiers(ctx, accessToken)
+	if err != nil {
+		return nil, callerError(err)
+	}
+
+	resp := &sso.ListIdentifiersResponse{}
+	for _, ident := range idents {
+		resp.Identifiers = append(resp.Identifiers, toIdentifier(ident))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) AddIdentifier(ctx context.Context, req *sso.AddIdentifierRequest) (*sso.AddIdentifierResponse, error) {
+	kind, err := identifierKind(req.GetKind())
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetValue() == "" {
+		return nil, status.Error(codes.InvalidArgument, "value is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ident, err := s.auth.AddIdentifier(ctx, accessToken, kind, req.GetValue())
+	if err != nil {
+		return nil, identifierError(err)
+	}
+
+	return &sso.AddIdentifierResponse{Identifier: toIdentifier(ident)}, nil
+}
+
+func (s *serverAPI) VerifyIdentifier(ctx context.Context, req *sso.VerifyIdentifierRequest) (*sso.VerifyIdentifierResponse, error) {
+	kind, err := identifierKind(req.GetKind())
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.VerifyIdentifier(ctx, accessToken, kind, req.GetCode()); err != nil {
+		return nil, identifierError(err)
+	}
+
+	return &sso.VerifyIdentifierResponse{}, nil
+}
+
+func (s *serverAPI) RemoveIdentifier(ctx context.Context, req *sso.RemoveIdentifierRequest) (*sso.RemoveIdentifierResponse, error) {
+	kind, err := identifierKind(req.GetKind())
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.RemoveIdentifier(ctx, accessToken, kind); err != nil {
+		return nil, identifierError(err)
+	}
+
+	return &sso.RemoveIdentifierResponse{}, nil
+}
+
+func identifierKind(kind string) (models.IdentifierKind, error) {
+	switch k := models.IdentifierKind(kind); k {
+	case models.IdentifierEmail, models.IdentifierUsername, models.IdentifierPhone:
+		return k, nil
+	case "":
+		return "", status.Error(codes.InvalidArgument, "kind is required")
+	}
+
+	return "", status.Error(codes.InvalidArgument, "kind must be one of email, username, phone")
+}
+
+func toIdentifier(ident models.Identifier) *sso.Identifier {
+	return &sso.Identifier{
+		Kind:     string(ident.Kind),
+		Value:    ident.Value,
+		Verified: ident.Verified(),
+	}
+}
+
+// identifierError переводит ошибки операций с идентификаторами в gRPC статусы.
+func identifierError(err error) error {
+	var validationErr *auth.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return validationStatus(validationErr)
+	case errors.Is(err, auth.ErrIdentifierExists):
+		return status.Error(codes.AlreadyExists, "identifier already in use")
+	case errors.Is(err, auth.ErrIdentifierNotFound):
+		return status.Error(codes.NotFound, "identifier not found")
+	case errors.Is(err, auth.ErrInvalidCode):
+		return status.Error(codes.InvalidArgument, "invalid or expired verification code")
+	case errors.Is(err, auth.ErrPrimaryIdentifier):
+		return status.Error(codes.FailedPrecondition, "email identifier cannot be changed")
+	case errors.Is(err, auth.ErrTooManyRequests):
+		return status.Error(codes.ResourceExhausted, "too many verification codes requested, try again later")
+	}
+
+	return callerError(err)
+}
+
+func (s *serverAPI) GetMe(ctx context.Context, req *sso.GetMeRequest) (*sso.GetMeResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.auth.GetMe(ctx, accessToken)
+	if err != nil {
+		return nil, callerError(err)
+	}
+
+	return &sso.GetMeResponse{User: toUser(user)}, nil
+}
+
+func (s *serverAPI) UpdateMe(ctx context.Context, req *sso.UpdateMeRequest) (*sso.UpdateMeResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.auth.UpdateMe(ctx, accessToken, auth.ProfileUpdate{
+		DisplayName: req.DisplayName,
+		GivenName:   req.GivenName,
+		FamilyName:  req.FamilyName,
+		Locale:      req.Locale,
+		Timezone:    req.Timezone,
+		AvatarURL:   req.AvatarUrl,
+	})
+	if err != nil {
+		var validationErr *auth.ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, validationStatus(validationErr)
+		}
+
+		return nil, callerError(err)
+	}
+
+	return &sso.UpdateMeResponse{User: toUser(user)}, nil
+}
+
+func (s *serverAPI) SetUserStatus(ctx context.Context, req *sso.SetUserStatusRequest) (*sso.SetUserStatusResponse, error) {
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if req.GetStatus() == "" {
+		return nil, status.Error(codes.InvalidArgument, "status is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var suspendedUntil time.Time
+	if req.GetSuspendedUntil() != nil {
+		suspendedUntil = req.GetSuspendedUntil().AsTime()
+	}
+
+	user, err := s.auth.SetUserStatus(ctx, accessToken, req.GetUserId(), models.UserStatus(req.GetStatus()), suspendedUntil, req.GetReason())
+	if err != nil {
+		var validationErr *auth.ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, validationStatus(validationErr)
+		}
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+
+		return nil, callerError(err)
+	}
+
+	return &sso.SetUserStatusResponse{User: toUser(user)}, nil
+}
+
+func (s *serverAPI) EnrollTOTP(ctx context.Context, req *sso.EnrollTOTPRequest) (*sso.EnrollTOTPResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, uri, err := s.auth.EnrollTOTP(ctx, accessToken)
+	if err != nil {
+		return nil, mfaError(err)
+	}
+
+	return &sso.EnrollTOTPResponse{Secret: secret, OtpauthUri: uri}, nil
+}
+
+func (s *serverAPI) ConfirmTOTP(ctx context.Context, req *sso.ConfirmTOTPRequest) (*sso.ConfirmTOTPResponse, error) {
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := s.auth.ConfirmTOTP(ctx, accessToken, req.GetCode())
+	if err != nil {
+		return nil, mfaError(err)
+	}
+
+	return &sso.ConfirmTOTPResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (s *serverAPI) RegenerateRecoveryCodes(ctx context.Context, req *sso.RegenerateRecoveryCodesRequest) (*sso.RegenerateRecoveryCodesResponse, error) {
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := s.auth.RegenerateRecoveryCodes(ctx, accessToken, req.GetCode())
+	if err != nil {
+		var lockedErr *auth.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(ctx, lockedErr)
+		}
+
+		return nil, mfaError(err)
+	}
+
+	return &sso.RegenerateRecoveryCodesResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (s *serverAPI) DisableTOTP(ctx context.Context, req *sso.DisableTOTPRequest) (*sso.DisableTOTPResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.DisableTOTP(ctx, accessToken, req.GetCode()); err != nil {
+		var lockedErr *auth.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(ctx, lockedErr)
+		}
+
+		return nil, mfaError(err)
+	}
+
+	return &sso.DisableTOTPResponse{}, nil
+}
+
+func (s *serverAPI) VerifyMFA(ctx context.Context, req *sso.VerifyMFARequest) (*sso.LoginResponse, error) {
+	if req.GetChallengeToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "challenge_token is required")
+	}
+
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	accessToken, refreshToken, err := s.auth.VerifyMFA(ctx, req.GetChallengeToken(), req.GetCode())
+	if err != nil {
+		var lockedErr *auth.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(ctx, lockedErr)
+		}
+
+		if st, ok := accountStatusError(err); ok {
+			return nil, st
+		}
+
+		return nil, mfaError(err)
+	}
+
+	return &sso.LoginResponse{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+func (s *serverAPI) BeginWebAuthnRegistration(ctx context.Context, req *sso.BeginWebAuthnRegistrationRequest) (*sso.WebAuthnOptionsResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := s.auth.BeginWebAuthnRegistration(ctx, accessToken)
+	if err != nil {
+		return nil, webAuthnError(err)
+	}
+
+	return &sso.WebAuthnOptionsResponse{OptionsJson: string(options)}, nil
+}
+
+func (s *serverAPI) FinishWebAuthnRegistration(ctx context.Context, req *sso.FinishWebAuthnRegistrationRequest) (*sso.WebAuthnCredential, error) {
+	if req.GetResponseJson() == "" {
+		return nil, status.Error(codes.InvalidArgument, "response_json is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := s.auth.FinishWebAuthnRegistration(ctx, accessToken, req.GetName(), []byte(req.GetResponseJson()))
+	if err != nil {
+		var validationErr *auth.ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, validationStatus(validationErr)
+		}
+
+		return nil, webAuthnError(err)
+	}
+
+	return toWebAuthnCredential(cred), nil
+}
+
+func (s *serverAPI) ListWebAuthnCredentials(ctx context.Context, req *sso.ListWebAuthnCredentialsRequest) (*sso.ListWebAuthnCredentialsResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := s.auth.ListWebAuthnCredentials(ctx, accessToken)
+	if err != nil {
+		return nil, webAuthnError(err)
+	}
+
+	resp := &sso.ListWebAuthnCredentialsResponse{}
+	for _, cred := range creds {
+		resp.Credentials = append(resp.Credentials, toWebAuthnCredential(cred))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) RemoveWebAuthnCredential(ctx context.Context, req *sso.RemoveWebAuthnCredentialRequest) (*sso.RemoveWebAuthnCredentialResponse, error) {
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.RemoveWebAuthnCredential(ctx, accessToken, req.GetId()); err != nil {
+		return nil, webAuthnError(err)
+	}
+
+	return &sso.RemoveWebAuthnCredentialResponse{}, nil
+}
+
+func (s *serverAPI) BeginWebAuthnLogin(ctx context.Context, req *sso.BeginWebAuthnLoginRequest) (*sso.WebAuthnOptionsResponse, error) {
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	options, err := s.auth.BeginWebAuthnLogin(ctx, req.GetIdentifier(), int(req.GetAppId()))
+	if err != nil {
+		var validationErr *auth.ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, validationStatus(validationErr)
+		}
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+
+		return nil, webAuthnError(err)
+	}
+
+	return &sso.WebAuthnOptionsResponse{OptionsJson: string(options)}, nil
+}
+
+func (s *serverAPI) FinishWebAuthnLogin(ctx context.Context, req *sso.FinishWebAuthnLoginRequest) (*sso.LoginResponse, error) {
+	if req.GetResponseJson() == "" {
+		return nil, status.Error(codes.InvalidArgument, "response_json is required")
+	}
+
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	accessToken, refreshToken, err := s.auth.FinishWebAuthnLogin(ctx, []byte(req.GetResponseJson()), int(req.GetAppId()), authRequirements("", 0, req.GetScope()))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, status.Error(codes.Unauthenticated, "invalid credential")
+		}
+
+		var validationErr *auth.ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, validationStatus(validationErr)
+		}
+
+		if st, ok := scopeError(err); ok {
+			return nil, st
+		}
+
+		var lockedErr *auth.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(ctx, lockedErr)
+		}
+
+		if st, ok := accountStatusError(err); ok {
+			return nil, st
+		}
+
+		return nil, webAuthnError(err)
+	}
+
+	return &sso.LoginResponse{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+func (s *serverAPI) BeginWebAuthnMFA(ctx context.Context, req *sso.BeginWebAuthnMFARequest) (*sso.WebAuthnOptionsResponse, error) {
+	if req.GetChallengeToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "challenge_token is required")
+	}
+
+	options, err := s.auth.BeginWebAuthnMFA(ctx, req.GetChallengeToken())
+	if err != nil {
+		var lockedErr *auth.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(ctx, lockedErr)
+		}
+
+		if st, ok := accountStatusError(err); ok {
+			return nil, st
+		}
+
+		return nil, webAuthnError(err)
+	}
+
+	return &sso.WebAuthnOptionsResponse{OptionsJson: string(options)}, nil
+}
+
+func (s *serverAPI) FinishWebAuthnMFA(ctx context.Context, req *sso.FinishWebAuthnMFARequest) (*sso.LoginResponse, error) {
+	if req.GetChallengeToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "challenge_token is required")
+	}
+
+	if req.GetResponseJson() == "" {
+		return nil, status.Error(codes.InvalidArgument, "response_json is required")
+	}
+
+	accessToken, refreshToken, err := s.auth.FinishWebAuthnMFA(ctx, req.GetChallengeToken(), []byte(req.GetResponseJson()))
+	if err != nil {
+		var lockedErr *auth.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(ctx, lockedErr)
+		}
+
+		if st, ok := accountStatusError(err); ok {
+			return nil, st
+		}
+
+		return nil, webAuthnError(err)
+	}
+
+	return &sso.LoginResponse{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+func (s *serverAPI) StartPasswordlessLogin(ctx context.Context, req *sso.StartPasswordlessLoginRequest) (*sso.StartPasswordlessLoginResponse, error) {
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	requestID, err := s.auth.StartPasswordlessLogin(ctx, req.GetEmail(), int(req.GetAppId()))
+	if err != nil {
+		var validationErr *auth.ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, validationStatus(validationErr)
+		}
+
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+
+		return nil, status.Error(codes.Internal, "failed to start login")
+	}
+
+	return &sso.StartPasswordlessLoginResponse{RequestId: requestID}, nil
+}
+
+func (s *serverAPI) CompletePasswordlessLogin(ctx context.Context, req *sso.CompletePasswordlessLoginRequest) (*sso.LoginResponse, error) {
+	if req.GetRequestId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "request_id is required")
+	}
+
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	accessToken, refreshToken, err := s.auth.CompletePasswordlessLogin(ctx, req.GetRequestId(), req.GetCode(), int(req.GetAppId()), authRequirements(req.GetAcrValues(), req.GetMaxAge(), req.GetScope()))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCode) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired code")
+		}
+
+		var validationErr *auth.ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, validationStatus(validationErr)
+		}
+
+		if st, ok := stepUpError(err); ok {
+			return nil, st
+		}
+
+		if st, ok := scopeError(err); ok {
+			return nil, st
+		}
+
+		var mfaErr *auth.MFARequiredError
+		if errors.As(err, &mfaErr) {
+			return &sso.LoginResponse{
+				MfaRequired:       true,
+				MfaChallengeToken: mfaErr.ChallengeToken,
+				MfaMethods:        mfaErr.Methods,
+			}, nil
+		}
+
+		var lockedErr *auth.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(ctx, lockedErr)
+		}
+
+		if st, ok := accountStatusError(err); ok {
+			return nil, st
+		}
+
+		return nil, status.Error(codes.Internal, "failed to login")
+	}
+
+	return &sso.LoginResponse{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+func (s *serverAPI) TrustDevice(ctx context.Context, req *sso.TrustDeviceRequest) (*sso.TrustDeviceResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	device, deviceToken, err := s.auth.TrustDevice(ctx, accessToken, req.GetName())
+	if err != nil {
+		var validationErr *auth.ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, validationStatus(validationErr)
+		}
+
+		return nil, deviceError(err)
+	}
+
+	return &sso.TrustDeviceResponse{DeviceToken: deviceToken, Device: toTrustedDevice(device)}, nil
+}
+
+func (s *serverAPI) ListTrustedDevices(ctx context.Context, req *sso.ListTrustedDevicesRequest) (*sso.ListTrustedDevicesResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := s.auth.ListTrustedDevices(ctx, accessToken)
+	if err != nil {
+		return nil, deviceError(err)
+	}
+
+	resp := &sso.ListTrustedDevicesResponse{}
+	for _, device := range devices {
+		resp.Devices = append(resp.Devices, toTrustedDevice(device))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) RevokeTrustedDevice(ctx context.Context, req *sso.RevokeTrustedDeviceRequest) (*sso.RevokeTrustedDeviceResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Без id отзываются все устройства
+	if req.GetId() == 0 {
+		err = s.auth.RevokeAllTrustedDevices(ctx, accessToken)
+	} else {
+		err = s.auth.RevokeTrustedDevice(ctx, accessToken, req.GetId())
+	}
+	if err != nil {
+		return nil, deviceError(err)
+	}
+
+	return &sso.RevokeTrustedDeviceResponse{}, nil
+}
+
+func (s *serverAPI) CreateRole(ctx context.Context, req *sso.CreateRoleRequest) (*sso.Role, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.auth.CreateRole(ctx, accessToken, models.Role{
+		AppID:       int(req.GetAppId()),
+		Name:        req.GetName(),
+		Description: req.GetDescription(),
+		Permissions: req.GetPermissions(),
+	})
+	if err != nil {
+		return nil, roleError(err)
+	}
+
+	return toRole(role), nil
+}
+
+func (s *serverAPI) DeleteRole(ctx context.Context, req *sso.DeleteRoleRequest) (*sso.DeleteRoleResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.DeleteRole(ctx, accessToken, req.GetRoleId()); err != nil {
+		return nil, roleError(err)
+	}
+
+	return &sso.DeleteRoleResponse{}, nil
+}
+
+func (s *serverAPI) ListRoles(ctx context.Context, req *sso.ListRolesRequest) (*sso.ListRolesResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.auth.ListRoles(ctx, accessToken, int(req.GetAppId()))
+	if err != nil {
+		return nil, roleError(err)
+	}
+
+	resp := &sso.ListRolesResponse{}
+	for _, role := range roles {
+		resp.Roles = append(resp.Roles, toRole(role))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) AssignRole(ctx context.Context, req *sso.AssignRoleRequest) (*sso.AssignRoleResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.AssignRole(ctx, accessToken, req.GetUserId(), req.GetRoleId()); err != nil {
+		return nil, roleError(err)
+	}
+
+	return &sso.AssignRoleResponse{}, nil
+}
+
+func (s *serverAPI) UnassignRole(ctx context.Context, req *sso.UnassignRoleRequest) (*sso.UnassignRoleResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.UnassignRole(ctx, accessToken, req.GetUserId(), req.GetRoleId()); err != nil {
+		return nil, roleError(err)
+	}
+
+	return &sso.UnassignRoleResponse{}, nil
+}
+
+func (s *serverAPI) ListUserRoles(ctx context.Context, req *sso.ListUserRolesRequest) (*sso.ListRolesResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.auth.ListUserRoles(ctx, accessToken, req.GetUserId(), int(req.GetAppId()))
+	if err != nil {
+		return nil, roleError(err)
+	}
+
+	resp := &sso.ListRolesResponse{}
+	for _, role := range roles {
+		resp.Roles = append(resp.Roles, toRole(role))
+	}
+
+	return resp, nil
+}
+
+// roleError переводит ошибки управления ролями в gRPC статусы.
+func roleError(err error) error {
+	var validationErr *auth.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationStatus(validationErr)
+	}
+
+	switch {
+	case errors.Is(err, auth.ErrRoleExists):
+		return status.Error(codes.AlreadyExists, "role already exists")
+	case errors.Is(err, auth.ErrRoleNotFound):
+		return status.Error(codes.NotFound, "role not found")
+	case errors.Is(err, storage.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, storage.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	}
+
+	return callerError(err)
+}
+
+func toRole(role models.Role) *sso.Role {
+	return &sso.Role{
+		Id:          role.ID,
+		AppId:       int32(role.AppID),
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: role.Permissions,
+		CreatedAt:   timestamppb.New(role.CreatedAt),
+	}
+}
+
+func (s *serverAPI) DefineScope(ctx context.Context, req *sso.DefineScopeRequest) (*sso.Scope, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	scope, err := s.auth.DefineScope(ctx, accessToken, models.Scope{
+		AppID:       int(req.GetAppId()),
+		Name:        req.GetName(),
+		Description: req.GetDescription(),
+	})
+	if err != nil {
+		return nil, scopeManagementError(err)
+	}
+
+	return toScope(scope), nil
+}
+
+func (s *serverAPI) DeleteScope(ctx context.Context, req *sso.DeleteScopeRequest) (*sso.DeleteScopeResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	if err := s.auth.DeleteScope(ctx, accessToken, int(req.GetAppId()), req.GetName()); err != nil {
+		return nil, scopeManagementError(err)
+	}
+
+	return &sso.DeleteScopeResponse{}, nil
+}
+
+func (s *serverAPI) ListScopes(ctx context.Context, req *sso.ListScopesRequest) (*sso.ListScopesResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	scopes, err := s.auth.ListScopes(ctx, accessToken, int(req.GetAppId()))
+	if err != nil {
+		return nil, scopeManagementError(err)
+	}
+
+	return toScopes(scopes), nil
+}
+
+func (s *serverAPI) SetAllowedScopes(ctx context.Context, req *sso.SetAllowedScopesRequest) (*sso.ListScopesResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	scopes, err := s.auth.SetAllowedScopes(ctx, accessToken, int(req.GetAppId()), req.GetScopes())
+	if err != nil {
+		return nil, scopeManagementError(err)
+	}
+
+	return toScopes(scopes), nil
+}
+
+func (s *serverAPI) ListAllowedScopes(ctx context.Context, req *sso.ListAllowedScopesRequest) (*sso.ListScopesResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	scopes, err := s.auth.ListAllowedScopes(ctx, accessToken, int(req.GetAppId()))
+	if err != nil {
+		return nil, scopeManagementError(err)
+	}
+
+	return toScopes(scopes), nil
+}
+
+// scopeManagementError переводит ошибки управления scope в gRPC статусы.
+func scopeManagementError(err error) error {
+	var validationErr *auth.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationStatus(validationErr)
+	}
+
+	switch {
+	case errors.Is(err, auth.ErrScopeExists):
+		return status.Error(codes.AlreadyExists, "scope is defined by another app")
+	case errors.Is(err, auth.ErrScopeNotFound):
+		return status.Error(codes.NotFound, "scope not found")
+	case errors.Is(err, storage.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	}
+
+	return callerError(err)
+}
+
+func (s *serverAPI) PutPolicy(ctx context.Context, req *sso.PutPolicyRequest) (*sso.Policy, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetDocument() == "" {
+		return nil, status.Error(codes.InvalidArgument, "document is required")
+	}
+
+	p, err := s.auth.PutPolicy(ctx, accessToken, int(req.GetAppId()), []byte(req.GetDocument()))
+	if err != nil {
+		return nil, policyError(err)
+	}
+
+	return toPolicy(p), nil
+}
+
+func (s *serverAPI) DeletePolicy(ctx context.Context, req *sso.DeletePolicyRequest) (*sso.DeletePolicyResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	if err := s.auth.DeletePolicy(ctx, accessToken, int(req.GetAppId()), req.GetName()); err != nil {
+		return nil, policyError(err)
+	}
+
+	return &sso.DeletePolicyResponse{}, nil
+}
+
+func (s *serverAPI) ListPolicies(ctx context.Context, req *sso.ListPoliciesRequest) (*sso.ListPoliciesResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	policies, err := s.auth.ListPolicies(ctx, accessToken, int(req.GetAppId()))
+	if err != nil {
+		return nil, policyError(err)
+	}
+
+	resp := &sso.ListPoliciesResponse{}
+	for _, p := range policies {
+		resp.Policies = append(resp.Policies, toPolicy(p))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) SetUserAttributes(ctx context.Context, req *sso.SetUserAttributesRequest) (*sso.SetUserAttributesResponse, error) {
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.auth.SetUserAttributes(ctx, accessToken, req.GetUserId(), req.GetAttributes())
+	if err != nil {
+		return nil, policyError(err)
+	}
+
+	return &sso.SetUserAttributesResponse{User: toUser(user)}, nil
+}
+
+// policyError переводит ошибки политик доступа и атрибутов в gRPC статусы.
+func policyError(err error) error {
+	var validationErr *auth.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationStatus(validationErr)
+	}
+
+	switch {
+	case errors.Is(err, auth.ErrPolicyNotFound):
+		return status.Error(codes.NotFound, "policy not found")
+	case errors.Is(err, storage.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, storage.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	}
+
+	return callerError(err)
+}
+
+func toPolicy(p models.Policy) *sso.Policy {
+	return &sso.Policy{
+		Name:      p.Name,
+		AppId:     int32(p.AppID),
+		Document:  string(p.Document),
+		CreatedAt: timestamppb.New(p.CreatedAt),
+		UpdatedAt: timestamppb.New(p.UpdatedAt),
+	}
+}
+
+func toScope(scope models.Scope) *sso.Scope {
+	return &sso.Scope{
+		Name:        scope.Name,
+		AppId:       int32(scope.AppID),
+		Description: scope.Description,
+		CreatedAt:   timestamppb.New(scope.CreatedAt),
+	}
+}
+
+func toScopes(scopes []models.Scope) *sso.ListScopesResponse {
+	resp := &sso.ListScopesResponse{}
+	for _, scope := range scopes {
+		resp.Scopes = append(resp.Scopes, toScope(scope))
+	}
+
+	return resp
+}
+
+func (s *serverAPI) CreateOrganization(ctx context.Context, req *sso.CreateOrganizationRequest) (*sso.Organization, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	org, err := s.auth.CreateOrganization(ctx, accessToken, req.GetName(), req.GetSlug())
+	if err != nil {
+		return nil, orgError(err)
+	}
+
+	return toOrganization(org), nil
+}
+
+func (s *serverAPI) ListOrganizations(ctx context.Context, req *sso.ListOrganizationsRequest) (*sso.ListOrganizationsResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, err := s.auth.ListOrganizations(ctx, accessToken)
+	if err != nil {
+		return nil, orgError(err)
+	}
+
+	resp := &sso.ListOrganizationsResponse{}
+	for _, m := range memberships {
+		resp.Memberships = append(resp.Memberships, &sso.Membership{
+			Organization: toOrganization(m.Organization),
+			Role:         string(m.Role),
+			JoinedAt:     timestamppb.New(m.JoinedAt),
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) ListOrgMembers(ctx context.Context, req *sso.ListOrgMembersRequest) (*sso.ListOrgMembersResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetOrgId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "org_id is required")
+	}
+
+	members, err := s.auth.ListOrgMembers(ctx, accessToken, req.GetOrgId())
+	if err != nil {
+		return nil, orgError(err)
+	}
+
+	resp := &sso.ListOrgMembersResponse{}
+	for _, member := range members {
+		resp.Members = append(resp.Members, toOrgMember(member))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) AddOrgMember(ctx context.Context, req *sso.AddOrgMemberRequest) (*sso.OrgMember, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetOrgId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "org_id is required")
+	}
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	// Без роли пользователь добавляется обычным участником
+	role := models.OrgRole(req.GetRole())
+	if role == "" {
+		role = models.OrgRoleMember
+	}
+
+	member, err := s.auth.AddOrgMember(ctx, accessToken, req.GetOrgId(), req.GetUserId(), role)
+	if err != nil {
+		return nil, orgError(err)
+	}
+
+	return toOrgMember(member), nil
+}
+
+func (s *serverAPI) UpdateOrgMemberRole(ctx context.Context, req *sso.UpdateOrgMemberRoleRequest) (*sso.OrgMember, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetOrgId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "org_id is required")
+	}
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	member, err := s.auth.UpdateOrgMemberRole(ctx, accessToken, req.GetOrgId(), req.GetUserId(), models.OrgRole(req.GetRole()))
+	if err != nil {
+		return nil, orgError(err)
+	}
+
+	return toOrgMember(member), nil
+}
+
+func (s *serverAPI) RemoveOrgMember(ctx context.Context, req *sso.RemoveOrgMemberRequest) (*sso.RemoveOrgMemberResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetOrgId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "org_id is required")
+	}
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if err := s.auth.RemoveOrgMember(ctx, accessToken, req.GetOrgId(), req.GetUserId()); err != nil {
+		return nil, orgError(err)
+	}
+
+	return &sso.RemoveOrgMemberResponse{}, nil
+}
+
+func (s *serverAPI) SwitchOrganization(ctx context.Context, req *sso.SwitchOrganizationRequest) (*sso.LoginResponse, error) {
+	if req.GetRefreshToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "refresh_token is required")
+	}
+
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	accessToken, refreshToken, err := s.auth.SwitchOrganization(ctx, req.GetRefreshToken(), int(req.GetAppId()), req.GetOrgId())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) || errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+		}
+
+		if st, ok := accountStatusError(err); ok {
+			return nil, st
+		}
+
+		return nil, orgError(err)
+	}
+
+	return &sso.LoginResponse{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// orgError переводит ошибки организаций в gRPC статусы.
+func orgError(err error) error {
+	var validationErr *auth.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationStatus(validationErr)
+	}
+
+	switch {
+	case errors.Is(err, auth.ErrOrgExists):
+		return status.Error(codes.AlreadyExists, "organization slug is taken")
+	case errors.Is(err, auth.ErrOrgNotFound):
+		return status.Error(codes.NotFound, "organization not found")
+	case errors.Is(err, auth.ErrMemberExists):
+		return status.Error(codes.AlreadyExists, "user is already a member of the organization")
+	case errors.Is(err, auth.ErrNotOrgMember):
+		return status.Error(codes.NotFound, "user is not a member of the organization")
+	case errors.Is(err, auth.ErrLastOrgOwner):
+		return status.Error(codes.FailedPrecondition, "organization must keep at least one owner")
+	case errors.Is(err, storage.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, storage.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	}
+
+	return callerError(err)
+}
+
+func toOrganization(org models.Organization) *sso.Organization {
+	return &sso.Organization{
+		Id:        org.ID,
+		Name:      org.Name,
+		Slug:      org.Slug,
+		CreatedAt: timestamppb.New(org.CreatedAt),
+	}
+}
+
+func toOrgMember(member models.OrgMember) *sso.OrgMember {
+	return &sso.OrgMember{
+		OrgId:     member.OrgID,
+		UserId:    member.UserID,
+		Email:     member.Email,
+		Role:      string(member.Role),
+		CreatedAt: timestamppb.New(member.CreatedAt),
+	}
+}
+
+func (s *serverAPI) InviteOrgMember(ctx context.Context, req *sso.InviteOrgMemberRequest) (*sso.Invitation, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetOrgId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "org_id is required")
+	}
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	// Без роли приглашенный становится обычным участником
+	role := models.OrgRole(req.GetRole())
+	if role == "" {
+		role = models.OrgRoleMember
+	}
+
+	inv, err := s.auth.InviteOrgMember(ctx, accessToken, req.GetOrgId(), req.GetEmail(), role)
+	if err != nil {
+		return nil, invitationError(err)
+	}
+
+	return toInvitation(inv), nil
+}
+
+func (s *serverAPI) ListInvitations(ctx context.Context, req *sso.ListInvitationsRequest) (*sso.ListInvitationsResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetOrgId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "org_id is required")
+	}
+
+	invitations, err := s.auth.ListInvitations(ctx, accessToken, req.GetOrgId())
+	if err != nil {
+		return nil, invitationError(err)
+	}
+
+	resp := &sso.ListInvitationsResponse{}
+	for _, inv := range invitations {
+		resp.Invitations = append(resp.Invitations, toInvitation(inv))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) RevokeInvitation(ctx context.Context, req *sso.RevokeInvitationRequest) (*sso.RevokeInvitationResponse, error) {
+	accessToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetOrgId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "org_id is required")
+	}
+	if req.GetInvitationId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "invitation_id is required")
+	}
+
+	if err := s.auth.RevokeInvitation(ctx, accessToken, req.GetOrgId(), req.GetInvitationId()); err != nil {
+		return nil, invitationError(err)
+	}
+
+	return &sso.RevokeInvitationResponse{}, nil
+}
+
+// AcceptInvitation с заголовком authorization добавляет в организацию вошедшего
+// пользователя, без него — регистрирует аккаунт на email приглашения с паролем
+// из запроса и возвращает его токены.
+func (s *serverAPI) AcceptInvitation(ctx context.Context, req *sso.AcceptInvitationRequest) (*sso.AcceptInvitationResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	if hasAuthorization(ctx) {
+		accessToken, err := bearerToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		member, err := s.auth.AcceptInvitation(ctx, accessToken, req.GetToken())
+		if err != nil {
+			return nil, invitationError(err)
+		}
+
+		return &sso.AcceptInvitationResponse{Member: toOrgMember(member)}, nil
+	}
+
+	if req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "password is required to register, or log in to accept the invitation")
+	}
+
+	member, accessToken, refreshToken, err := s.auth.AcceptInvitationWithRegistration(ctx, req.GetToken(), req.GetPassword())
+	if err != nil {
+		return nil, invitationError(err)
+	}
+
+	return &sso.AcceptInvitationResponse{
+		Member:       toOrgMember(member),
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// invitationError переводит ошибки приглашений в gRPC статусы.
+func invitationError(err error) error {
+	if st, ok := accountStatusError(err); ok {
+		return st
+	}
+
+	switch {
+	case errors.Is(err, auth.ErrInvitationNotFound):
+		return status.Error(codes.NotFound, "invitation not found or expired")
+	case errors.Is(err, auth.ErrLoginRequired):
+		return status.Error(codes.FailedPrecondition, "account already exists, log in to accept the invitation")
+	case errors.Is(err, auth.ErrInvitationEmail):
+		return status.Error(codes.PermissionDenied, "invitation was sent to another email")
+	}
+
+	return orgError(err)
+}
+
+func toInvitation(inv models.Invitation) *sso.Invitation {
+	return &sso.Invitation{
+		Id:        inv.ID,
+		OrgId:     inv.OrgID,
+		Email:     inv.Email,
+		Role:      string(inv.Role),
+		InvitedBy: inv.InvitedBy,
+		ExpiresAt: timestamppb.New(inv.ExpiresAt),
+		CreatedAt: timestamppb.New(inv.CreatedAt),
+	}
+}
+
+// deviceError переводит ошибки доверенных устройств в gRPC статусы.
+func deviceError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrDeviceNotFound):
+		return status.Error(codes.NotFound, "trusted device not found")
+	case errors.Is(err, auth.ErrDeviceTrustDisabled):
+		return status.Error(codes.FailedPrecondition, "trusted devices are disabled")
+	}
+
+	if st, ok := stepUpError(err); ok {
+		return st
+	}
+
+	return callerError(err)
+}
+
+func toTrustedDevice(device models.TrustedDevice) *sso.TrustedDevice {
+	res := &sso.TrustedDevice{
+		Id:        device.ID,
+		Name:      device.Name,
+		CreatedAt: timestamppb.New(device.CreatedAt),
+		ExpiresAt: timestamppb.New(device.ExpiresAt),
+	}
+	if !device.LastUsedAt.IsZero() {
+		res.LastUsedAt = timestamppb.New(device.LastUsedAt)
+	}
+
+	return res
+}
+
+// webAuthnError переводит ошибки WebAuthn в gRPC статусы.
+func webAuthnError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidWebAuthnResponse):
+		return status.Error(codes.InvalidArgument, "invalid webauthn response")
+	case errors.Is(err, auth.ErrWebAuthnCredentialExists):
+		return status.Error(codes.AlreadyExists, "credential already registered")
+	case errors.Is(err, auth.ErrWebAuthnNotFound):
+		return status.Error(codes.NotFound, "credential not found")
+	}
+
+	return mfaError(err)
+}
+
+func toWebAuthnCredential(cred models.WebAuthnCredential) *sso.WebAuthnCredential {
+	res := &sso.WebAuthnCredential{
+		Id:        cred.ID,
+		Name:      cred.Name,
+		CreatedAt: timestamppb.New(cred.CreatedAt),
+	}
+	if !cred.LastUsedAt.IsZero() {
+		res.LastUsedAt = timestamppb.New(cred.LastUsedAt)
+	}
+
+	return res
+}
+
+// mfaError переводит ошибки второго фактора в gRPC статусы.
+func mfaError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidMFACode):
+		return status.Error(codes.InvalidArgument, "invalid code")
+	case errors.Is(err, auth.ErrMFAAlreadyEnabled):
+		return status.Error(codes.AlreadyExists, "mfa already enabled")
+	case errors.Is(err, auth.ErrMFANotEnabled):
+		return status.Error(codes.FailedPrecondition, "mfa not enabled")
+	}
+
+	if st, ok := stepUpError(err); ok {
+		return st
+	}
+
+	return callerError(err)
+}
+
+func toUser(user models.User) *sso.User {
+	return &sso.User{
+		Id:          user.ID,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		GivenName:   user.GivenName,
+		FamilyName:  user.FamilyName,
+		Locale:      user.Locale,
+		Timezone:    user.Timezone,
+		AvatarUrl:   user.AvatarURL,
+		CreatedAt:   timestamppb.New(user.CreatedAt),
+		UpdatedAt:   timestamppb.New(user.UpdatedAt),
+		Status:      string(user.EffectiveStatus(time.Now())),
+		Attributes:  user.Attributes,
+	}
+}
+
+// accountStatusError переводит отказ по статусу аккаунта в gRPC статус.
+func accountStatusError(err error) (error, bool) {
+	var suspendedErr *auth.SuspendedError
+	switch {
+	case errors.Is(err, auth.ErrAccountDisabled):
+		return status.Error(codes.PermissionDenied, "account disabled"), true
+	case errors.As(err, &suspendedErr):
+		if suspendedErr.Until.IsZero() {
+			return status.Error(codes.PermissionDenied, "account suspended"), true
+		}
+		return status.Errorf(codes.PermissionDenied, "account suspended until %s", suspendedErr.Until.UTC().Format(time.RFC3339)), true
+	case errors.Is(err, auth.ErrAccountPending):
+		return status.Error(codes.FailedPrecondition, "account pending approval"), true
+	}
+
+	return nil, false
+}
+
+// stepUpError переводит отказ по требованиям к уровню аутентификации в gRPC статус.
+func stepUpError(err error) (error, bool) {
+	switch {
+	case errors.Is(err, auth.ErrReauthenticationRequired):
+		return status.Error(codes.Unauthenticated, "re-authentication required"), true
+	case errors.Is(err, auth.ErrInsufficientACR):
+		return status.Error(codes.FailedPrecondition, "required authentication level not available"), true
+	}
+
+	return nil, false
+}
+
+// authRequirements собирает требования приложения из acr_values, max_age (в секундах)
+// и scope — списка значений через пробел, как в OAuth.
+func authRequirements(acrValues string, maxAge int64, scope string) auth.AuthRequirements {
+	return auth.AuthRequirements{
+		MinACR: strings.TrimSpace(acrValues),
+		MaxAge: time.Duration(maxAge) * time.Second,
+		Scope:  strings.Fields(scope),
+	}
+}
+
+// scopeError переводит отказ в запрошенных scope в gRPC статус.
+func scopeError(err error) (error, bool) {
+	var scopeErr *auth.ScopeError
+	if errors.As(err, &scopeErr) {
+		return status.Errorf(codes.InvalidArgument, "requested scope is not allowed: %s", strings.Join(scopeErr.Denied, " ")), true
+	}
+
+	return nil, false
+}
+
+// lockedStatus возвращает статус заблокированного аккаунта и передает клиенту
+// время до разблокировки в заголовке retry-after (в секундах).
+func lockedStatus(ctx context.Context, lockedErr *auth.LockedError) error {
+	retryAfter := int64(math.Ceil(lockedErr.RetryAfter.Seconds()))
+	_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.FormatInt(retryAfter, 10)))
+
+	return status.Errorf(codes.ResourceExhausted, "account temporarily locked, retry after %d seconds", retryAfter)
+}
+
+// hasAuthorization сообщает, передан ли заголовок authorization.
+func hasAuthorization(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	return ok && len(md.Get("authorization")) > 0
+}
+
+// bearerToken извлекает access токен из заголовка authorization.
+func bearerToken(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "authorization header is required")
+	}
+
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", status.Error(codes.Unauthenticated, "authorization header is required")
+	}
+
+	// Вызовы Admin передают и токен, и учетные данные приложения двумя заголовками authorization
+	token, found := authorizationValue(values, "Bearer ")
+	if !found || token == "" {
+		return "", status.Error(codes.Unauthenticated, "authorization header must be a bearer token")
+	}
+
+	return token, nil
+}
+
+// authenticateClient определяет приложение, вызывающее внутренние RPC: по
+// проверенному клиентскому сертификату mTLS или по заголовку
+// "authorization: Basic base64(app_id:secret)".
+func authenticateClient(ctx context.Context, clients ClientAuthenticator) (models.App, error) {
+	var (
+		client models.App
+		err    error
+	)
+
+	if cn, ok := clientCertificateName(ctx); ok {
+		client, err = clients.AuthenticateClientCertificate(ctx, cn)
+	} else {
+		appID, secret, credErr := clientCredentials(ctx)
+		if credErr != nil {
+			return models.App{}, credErr
+		}
+		client, err = clients.AuthenticateClient(ctx, appID, secret)
+	}
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidClient) {
+			return models.App{}, status.Error(codes.Unauthenticated, "invalid client credentials")
+		}
+		return models.App{}, status.Error(codes.Internal, "internal server error")
+	}
+
+	return client, nil
+}
+
+// clientCertificateName возвращает CN клиентского сертификата, проверенного при установке TLS соединения.
+func clientCertificateName(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+
+	return tlsInfo.State.VerifiedChains[0][0].Subject.CommonName, true
+}
+
+func clientCredentials(ctx context.Context) (int, string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get("authorization")) == 0 {
+		return 0, "", status.Error(codes.Unauthenticated, "client credentials are required")
+	}
+
+	encoded, found := authorizationValue(md.Get("authorization"), "Basic ")
+	if !found {
+		return 0, "", status.Error(codes.Unauthenticated, "authorization header must be basic client credentials")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, "", status.Error(codes.Unauthenticated, "invalid client credentials")
+	}
+
+	id, secret, found := strings.Cut(string(raw), ":")
+	appID, err := strconv.Atoi(id)
+	if !found || err != nil || appID <= 0 {
+		return 0, "", status.Error(codes.Unauthenticated, "invalid client credentials")
+	}
+
+	return appID, secret, nil
+}
+
+// authorizationValue возвращает значение первого заголовка authorization со схемой scheme.
+func authorizationValue(values []string, scheme string) (string, bool) {
+	for _, v := range values {
+		if value, found := strings.CutPrefix(v, scheme); found {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// callerError переводит ошибки проверки вызывающего в gRPC статусы.
+func callerError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidToken):
+		return status.Error(codes.Unauthenticated, "invalid access token")
+	case errors.Is(err, auth.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, "permission denied")
+	}
+
+	return status.Error(codes.Internal, "internal server error")
+}
+
+// validationStatus возвращает InvalidArgument с нарушениями по полям в деталях BadRequest.
+func validationStatus(validationErr *auth.ValidationError) error {
+	st := status.New(codes.InvalidArgument, validationErr.Error())
+
+	badRequest := &errdetails.BadRequest{}
+	for _, v := range validationErr.Violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.Description,
+		})
+	}
+
+	detailed, err := st.WithDetails(badRequest)
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
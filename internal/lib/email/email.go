@@ -0,0 +1,69 @@
+package email
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	maxLocalLength   = 64
+	maxAddressLength = 254
+)
+
+var (
+	ErrInvalidEmail = errors.New("invalid email")
+)
+
+// Normalize приводит email к каноническому виду: обрезает пробелы, переводит в нижний
+// регистр и кодирует интернационализированный домен в punycode. Суффикс "+tag"
+// сохраняется: пользователи общие для всех приложений, и его удаление сделало бы
+// один и тот же адрес разными аккаунтами в зависимости от приложения.
+func Normalize(raw string) (string, error) {
+	addr := strings.ToLower(strings.TrimSpace(raw))
+
+	at := strings.LastIndexByte(addr, '@')
+	if at <= 0 || at == len(addr)-1 {
+		return "", ErrInvalidEmail
+	}
+	local, domain := addr[:at], addr[at+1:]
+
+	if !validLocal(local) {
+		return "", ErrInvalidEmail
+	}
+
+	domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(domain, "."))
+	if err != nil || !strings.Contains(domain, ".") {
+		return "", ErrInvalidEmail
+	}
+
+	addr = local + "@" + domain
+	if len(addr) > maxAddressLength {
+		return "", ErrInvalidEmail
+	}
+
+	return addr, nil
+}
+
+// validLocal проверяет локальную часть по правилам dot-atom из RFC 5322.
+// Кавычки в локальной части не поддерживаются.
+func validLocal(local string) bool {
+	if local == "" || len(local) > maxLocalLength {
+		return false
+	}
+	if local[0] == '.' || local[len(local)-1] == '.' || strings.Contains(local, "..") {
+		return false
+	}
+
+	for _, r := range local {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case strings.ContainsRune(".!#$%&'*+/=?^_`{|}~-", r):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,71 @@
+package email
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{name: "trim and lower case", raw: "  John.Doe@Example.COM ", want: "john.doe@example.com"},
+		{name: "plus tag is kept", raw: "user+news@example.com", want: "user+news@example.com"},
+		{name: "trailing dot in domain", raw: "user@example.com.", want: "user@example.com"},
+		{name: "idn domain", raw: "user@пример.рф", want: "user@xn--e1afmkfd.xn--p1ai"},
+		{name: "idn domain upper case", raw: "user@ПРИМЕР.РФ", want: "user@xn--e1afmkfd.xn--p1ai"},
+		{name: "punycode domain", raw: "user@xn--e1afmkfd.xn--p1ai", want: "user@xn--e1afmkfd.xn--p1ai"},
+		{name: "invalid idn domain", raw: "user@exa_mple.com", wantErr: true},
+		{name: "domain without dot", raw: "user@localhost", wantErr: true},
+		{name: "no at", raw: "user.example.com", wantErr: true},
+		{name: "empty local part", raw: "@example.com", wantErr: true},
+		{name: "empty domain", raw: "user@", wantErr: true},
+		{name: "dot-atom specials", raw: "a!#$%&'*/=?^_`{|}~-b@example.com", want: "a!#$%&'*/=?^_`{|}~-b@example.com"},
+		{name: "leading dot", raw: ".user@example.com", wantErr: true},
+		{name: "trailing dot", raw: "user.@example.com", wantErr: true},
+		{name: "double dot", raw: "us..er@example.com", wantErr: true},
+		{name: "quoted local part", raw: `"user"@example.com`, wantErr: true},
+		{name: "space in local part", raw: "us er@example.com", wantErr: true},
+		{name: "non-ascii local part", raw: "пользователь@example.com", wantErr: true},
+		{name: "local part of 64", raw: strings.Repeat("a", 64) + "@example.com", want: strings.Repeat("a", 64) + "@example.com"},
+		{name: "local part of 65", raw: strings.Repeat("a", 65) + "@example.com", wantErr: true},
+		{name: "address of 254", raw: address(254), want: address(254)},
+		{name: "address of 255", raw: address(255), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.raw)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidEmail) {
+					t.Errorf("Normalize(%q) = %q, %v; want %v", tt.raw, got, err, ErrInvalidEmail)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Normalize(%q) = %q, %v; want %q", tt.raw, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// address возвращает корректный адрес длиной n символов с метками домена по 63 символа.
+func address(n int) string {
+	const local = "user@"
+
+	var labels []string
+	for rest := n - len(local); rest > 0; rest -= 64 {
+		labels = append(labels, strings.Repeat("a", min(rest, 63)))
+	}
+
+	addr := local + strings.Join(labels, ".")
+	if len(addr) != n {
+		panic("address: unexpected length")
+	}
+
+	return addr
+}
@@ -0,0 +1,169 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/1abobik1/Single-Sign-On/internal/lib/secret"
+)
+
+const (
+	prefix = "$env$"
+	// KeySize — длина мастер-ключа и ключа данных: AES-256.
+	KeySize = 32
+)
+
+var (
+	ErrUnknownKey       = errors.New("unknown master key")
+	ErrInvalidEnvelope  = errors.New("invalid envelope")
+	ErrNoCurrentKey     = errors.New("current master key is not set")
+	ErrDecryptionFailed = errors.New("decryption failed")
+)
+
+// Keyring шифрует значения конвертом: каждое значение шифруется своим
+// случайным ключом данных (AES-256-GCM), а ключ данных — мастер-ключом.
+// Мастер-ключи хранятся вне базы данных, поэтому выгрузки таблицы
+// недостаточно для получения значений.
+//
+// Результат — строка "$env$<id ключа>$<ключ данных>$<значение>" (base64url):
+// ID ключа позволяет менять мастер-ключ — старые ключи остаются для
+// расшифровки, пока значения не перешифрованы текущим.
+type Keyring struct {
+	currentID string
+	keys      map[string][]byte
+}
+
+// NewKeyring создает Keyring. Новые значения шифруются ключом currentID.
+func NewKeyring(currentID string, keys map[string][]byte) (*Keyring, error) {
+	const op = "envelope.NewKeyring"
+
+	for id, key := range keys {
+		if !secret.ValidKeyID(id) {
+			return nil, fmt.Errorf("%s: invalid key id %q", op, id)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("%s: key %q must be %d bytes", op, id, KeySize)
+		}
+	}
+
+	if currentID == "" {
+		return nil, fmt.Errorf("%s: %v", op, ErrNoCurrentKey)
+	}
+	if _, ok := keys[currentID]; !ok {
+		return nil, fmt.Errorf("%s: %v %q", op, ErrUnknownKey, currentID)
+	}
+
+	return &Keyring{currentID: currentID, keys: keys}, nil
+}
+
+// Encrypt шифрует plaintext текущим мастер-ключом. aad — контекст значения
+// (например, таблица, столбец и ID строки): расшифровать значение можно
+// только с тем же aad, поэтому его нельзя подставить в другую строку.
+func (k *Keyring) Encrypt(plaintext []byte, aad string) (string, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	wrapped, err := seal(k.keys[k.currentID], dataKey, []byte(k.currentID))
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := seal(dataKey, plaintext, []byte(aad))
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + k.currentID + "$" +
+		base64.RawURLEncoding.EncodeToString(wrapped) + "$" +
+		base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt расшифровывает значение, зашифрованное Encrypt с тем же aad.
+func (k *Keyring) Decrypt(encoded string, aad string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(encoded, prefix), "$")
+	if !strings.HasPrefix(encoded, prefix) || len(parts) != 3 {
+		return nil, ErrInvalidEnvelope
+	}
+
+	key, ok := k.keys[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, parts[0])
+	}
+
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidEnvelope
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidEnvelope
+	}
+
+	dataKey, err := open(key, wrapped, []byte(parts[0]))
+	if err != nil {
+		return nil, err
+	}
+
+	return open(dataKey, sealed, []byte(aad))
+}
+
+// Encrypted сообщает, зашифровано ли значение. Значения без конверта
+// остались с момента, когда шифрование не было включено.
+func Encrypted(encoded string) bool {
+	return strings.HasPrefix(encoded, prefix)
+}
+
+// NeedsReencrypt сообщает, что значение не зашифровано или зашифровано не текущим ключом.
+func (k *Keyring) NeedsReencrypt(encoded string) bool {
+	id, _, _ := strings.Cut(strings.TrimPrefix(encoded, prefix), "$")
+	return !Encrypted(encoded) || id != k.currentID
+}
+
+// seal шифрует plaintext AES-256-GCM; случайный nonce записывается перед шифротекстом.
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrInvalidEnvelope
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,141 @@
+package envelope
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+var (
+	testKey1 = bytes.Repeat([]byte{1}, KeySize)
+	testKey2 = bytes.Repeat([]byte{2}, KeySize)
+)
+
+func mustKeyring(t *testing.T, currentID string, keys map[string][]byte) *Keyring {
+	t.Helper()
+
+	k, err := NewKeyring(currentID, keys)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+
+	return k
+}
+
+func mustEncrypt(t *testing.T, k *Keyring, plaintext, aad string) string {
+	t.Helper()
+
+	encoded, err := k.Encrypt([]byte(plaintext), aad)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	return encoded
+}
+
+func TestKeyringRoundTrip(t *testing.T) {
+	k := mustKeyring(t, "k1", map[string][]byte{"k1": testKey1})
+
+	encoded := mustEncrypt(t, k, "secret", "apps.secret:1")
+	if !Encrypted(encoded) {
+		t.Errorf("Encrypted(%q) = false, want true", encoded)
+	}
+	if k.NeedsReencrypt(encoded) {
+		t.Error("NeedsReencrypt() = true, want false for current key")
+	}
+
+	got, err := k.Decrypt(encoded, "apps.secret:1")
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if string(got) != "secret" {
+		t.Errorf("Decrypt() = %q, want %q", got, "secret")
+	}
+
+	// Каждый вызов берет новый ключ данных, поэтому шифртексты различаются
+	if again := mustEncrypt(t, k, "secret", "apps.secret:1"); again == encoded {
+		t.Error("Encrypt() returned the same envelope twice")
+	}
+}
+
+func TestKeyringDecryptRejects(t *testing.T) {
+	k := mustKeyring(t, "k1", map[string][]byte{"k1": testKey1})
+	other := mustKeyring(t, "k9", map[string][]byte{"k9": testKey2})
+
+	encoded := mustEncrypt(t, k, "secret", "apps.secret:1")
+
+	tests := []struct {
+		name    string
+		encoded string
+		aad     string
+		wantErr error
+	}{
+		{name: "wrong aad", encoded: encoded, aad: "apps.secret:2", wantErr: ErrDecryptionFailed},
+		{name: "unknown key id", encoded: mustEncrypt(t, other, "secret", "apps.secret:1"), aad: "apps.secret:1", wantErr: ErrUnknownKey},
+		{name: "plaintext", encoded: "secret", aad: "apps.secret:1", wantErr: ErrInvalidEnvelope},
+		{name: "truncated", encoded: encoded[:len("$env$k1$")], aad: "apps.secret:1", wantErr: ErrInvalidEnvelope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := k.Decrypt(tt.encoded, tt.aad); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Decrypt() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	keys := map[string][]byte{"k1": testKey1, "k2": testKey2}
+
+	old := mustEncrypt(t, mustKeyring(t, "k1", keys), "secret", "user_totp.secret:7")
+	k := mustKeyring(t, "k2", keys)
+
+	if !k.NeedsReencrypt(old) {
+		t.Error("NeedsReencrypt(old key) = false, want true")
+	}
+	if !k.NeedsReencrypt("secret") {
+		t.Error("NeedsReencrypt(plaintext) = false, want true")
+	}
+
+	got, err := k.Decrypt(old, "user_totp.secret:7")
+	if err != nil {
+		t.Fatalf("Decrypt(old key): %v", err)
+	}
+
+	reencrypted := mustEncrypt(t, k, string(got), "user_totp.secret:7")
+	if k.NeedsReencrypt(reencrypted) {
+		t.Error("NeedsReencrypt(reencrypted) = true, want false")
+	}
+
+	// После удаления старого ключа перешифрованное значение читается,
+	// а оставшееся на старом ключе — нет
+	current := mustKeyring(t, "k2", map[string][]byte{"k2": testKey2})
+	if _, err := current.Decrypt(reencrypted, "user_totp.secret:7"); err != nil {
+		t.Errorf("Decrypt(reencrypted) error = %v, want nil", err)
+	}
+	if _, err := current.Decrypt(old, "user_totp.secret:7"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt(removed key) error = %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestNewKeyringValidatesKeys(t *testing.T) {
+	tests := []struct {
+		name      string
+		currentID string
+		keys      map[string][]byte
+	}{
+		{name: "no current key", currentID: "", keys: map[string][]byte{"k1": testKey1}},
+		{name: "unknown current key", currentID: "k2", keys: map[string][]byte{"k1": testKey1}},
+		{name: "short key", currentID: "k1", keys: map[string][]byte{"k1": testKey1[:16]}},
+		{name: "invalid key id", currentID: "k1", keys: map[string][]byte{"k1": testKey1, "k$2": testKey2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeyring(tt.currentID, tt.keys); err == nil {
+				t.Error("NewKeyring() error = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package identifier
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+)
+
+const (
+	minUsernameLength = 3
+	maxUsernameLength = 32
+
+	// E.164: до 15 цифр вместе с кодом страны.
+	minPhoneDigits = 8
+	maxPhoneDigits = 15
+)
+
+var (
+	ErrInvalidUsername = errors.New("invalid username")
+	ErrInvalidPhone    = errors.New("invalid phone number")
+)
+
+// Detect определяет вид идентификатора по введенному значению:
+// строка с "@" — email, строка из цифр (возможно, с "+" и разделителями) — телефон,
+// все остальное — имя пользователя.
+func Detect(raw string) models.IdentifierKind {
+	raw = strings.TrimSpace(raw)
+
+	if strings.Contains(raw, "@") {
+		return models.IdentifierEmail
+	}
+
+	digits := 0
+	for i, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '+' && i == 0:
+		case r == ' ', r == '-', r == '(', r == ')', r == '.':
+		default:
+			return models.IdentifierUsername
+		}
+	}
+	if digits > 0 {
+		return models.IdentifierPhone
+	}
+
+	return models.IdentifierUsername
+}
+
+// NormalizeUsername приводит имя пользователя к нижнему регистру и проверяет его:
+// 3–32 символа из латинских букв, цифр, "." , "_" и "-", начиная с буквы.
+func NormalizeUsername(raw string) (string, error) {
+	username := strings.ToLower(strings.TrimSpace(raw))
+
+	if len(username) < minUsernameLength || len(username) > maxUsernameLength {
+		return "", ErrInvalidUsername
+	}
+	if username[0] < 'a' || username[0] > 'z' {
+		return "", ErrInvalidUsername
+	}
+
+	for _, r := range username {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+		default:
+			return "", ErrInvalidUsername
+		}
+	}
+
+	return username, nil
+}
+
+// NormalizePhone приводит номер телефона к формату E.164 ("+" и цифры).
+// Номер должен быть указан с кодом страны; пробелы, дефисы, точки и скобки отбрасываются.
+func NormalizePhone(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.HasPrefix(raw, "+") {
+		return "", ErrInvalidPhone
+	}
+
+	var b strings.Builder
+	b.WriteByte('+')
+	for _, r := range raw[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ', r == '-', r == '(', r == ')', r == '.':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+
+	phone := b.String()
+	digits := len(phone) - 1
+	if digits < minPhoneDigits || digits > maxPhoneDigits || phone[1] == '0' {
+		return "", ErrInvalidPhone
+	}
+
+	return phone, nil
+}
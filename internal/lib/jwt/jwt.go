@@ -1,14 +1,83 @@
 package jwt
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/thanhpk/randstr"
 )
 
-func NewAccessToken(user models.User, app models.App, duration time.Duration) (string, error) {
+// Значения claim typ, по которому токены разных назначений нельзя подменить друг другом.
+// Токены, выпущенные до появления typ, его не содержат; из них принимаются только
+// refresh токены (см. parse).
+const (
+	TypeAccess       = "access"
+	TypeRefresh      = "refresh"
+	TypeMFAChallenge = "mfa_challenge"
+	TypeMagicLink    = "magic_link"
+	TypeInvitation   = "invitation"
+)
+
+// AuthInfo — сведения о прошедшей аутентификации, которые переносятся в токены.
+type AuthInfo struct {
+	// AMR — методы аутентификации (RFC 8176): "pwd", "otp" и т.д.
+	AMR []string
+	// AuthTime — время последней интерактивной аутентификации пользователя.
+	AuthTime time.Time
+	// ACR — достигнутый уровень аутентификации.
+	ACR string
+	// Scope — выданные приложению scope OAuth. Переносится вместе с аутентификацией
+	// из токена MFA-проверки и refresh токена в новые токены.
+	Scope []string
+	// OrgID — активная организация пользователя. 0 — без организации.
+	OrgID int64
+}
+
+func (i AuthInfo) apply(claims jwt.MapClaims) {
+	if len(i.AMR) > 0 {
+		claims["amr"] = i.AMR
+	}
+	if !i.AuthTime.IsZero() {
+		claims["auth_time"] = i.AuthTime.Unix()
+	}
+	if i.ACR != "" {
+		claims["acr"] = i.ACR
+	}
+	if len(i.Scope) > 0 {
+		// RFC 8693: scope — строка значений через пробел
+		claims["scope"] = strings.Join(i.Scope, " ")
+	}
+	if i.OrgID != 0 {
+		claims["org_id"] = i.OrgID
+	}
+}
+
+// Grants — роли пользователя и их разрешения, действующие в приложении токена,
+// и его роль в активной организации.
+type Grants struct {
+	Roles       []string
+	Permissions []string
+	OrgRole     string
+}
+
+func (g Grants) apply(claims jwt.MapClaims) {
+	if len(g.Roles) > 0 {
+		claims["roles"] = g.Roles
+	}
+	if len(g.Permissions) > 0 {
+		claims["permissions"] = g.Permissions
+	}
+	if g.OrgRole != "" {
+		claims["org_role"] = g.OrgRole
+	}
+}
+
+func NewAccessToken(user models.User, app models.App, duration time.Duration, auth AuthInfo, grants Grants) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 
 	claims := token.Claims.(jwt.MapClaims)
@@ -16,6 +85,9 @@ func NewAccessToken(user models.User, app models.App, duration time.Duration) (s
 	claims["email"] = user.Email
 	claims["exp"] = time.Now().Add(duration).Unix()
 	claims["app_id"] = app.ID
+	claims["typ"] = TypeAccess
+	auth.apply(claims)
+	grants.apply(claims)
 
 	tokenString, err := token.SignedString([]byte(app.Secret))
 	if err != nil {
@@ -25,7 +97,7 @@ func NewAccessToken(user models.User, app models.App, duration time.Duration) (s
 	return tokenString, nil
 }
 
-func NewRefreshToken(user models.User, app models.App, duration time.Duration) (string, error) {
+func NewRefreshToken(user models.User, app models.App, duration time.Duration, auth AuthInfo) (string, error) {
 	refreshToken := jwt.New(jwt.SigningMethodHS256)
 
 	claims := refreshToken.Claims.(jwt.MapClaims)
@@ -33,6 +105,10 @@ func NewRefreshToken(user models.User, app models.App, duration time.Duration) (
 	claims["email"] = user.Email
 	claims["exp"] = time.Now().Add(duration).Unix() // e.g., 25 days expiration for refresh token 25 * 24 * time.Hour
 	claims["app_id"] = app.ID
+	claims["typ"] = TypeRefresh
+	// Уникальный ID, чтобы повторный вход выдавал новый токен даже в ту же секунду
+	claims["jti"] = randstr.Hex(16)
+	auth.apply(claims)
 
 	refreshTokenString, err := refreshToken.SignedString([]byte(app.Secret))
 	if err != nil {
@@ -41,3 +117,216 @@ func NewRefreshToken(user models.User, app models.App, duration time.Duration) (
 
 	return refreshTokenString, nil
 }
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// AppProvider возвращает приложение, секретом которого подписан токен.
+type AppProvider interface {
+	App(ctx context.Context, appID int) (models.App, error)
+}
+
+// ParseRefreshToken проверяет подпись и срок действия refresh токена, выданного приложению appID.
+func ParseRefreshToken(ctx context.Context, tokenString string, appProvider AppProvider, appID int) (jwt.MapClaims, error) {
+	app, err := appProvider.App(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := parse(tokenString, app.Secret, TypeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenAppID, err := AppID(claims)
+	if err != nil || tokenAppID != appID {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// ParseAccessToken проверяет подпись и срок действия access токена.
+// Секрет приложения определяется по claim app_id.
+func ParseAccessToken(ctx context.Context, tokenString string, appProvider AppProvider) (jwt.MapClaims, error) {
+	return parseForApp(ctx, tokenString, appProvider, TypeAccess)
+}
+
+// NewMFAChallengeToken выпускает короткоживущий токен, подтверждающий, что пользователь
+// прошел первый фактор и должен пройти второй. requiredACR — уровень, которого нужно
+// достичь вторым фактором; пустое значение означает любой второй фактор.
+func NewMFAChallengeToken(user models.User, app models.App, duration time.Duration, auth AuthInfo, requiredACR string) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+
+	claims := token.Claims.(jwt.MapClaims)
+	claims["uid"] = user.ID
+	claims["exp"] = time.Now().Add(duration).Unix()
+	claims["app_id"] = app.ID
+	claims["typ"] = TypeMFAChallenge
+	if requiredACR != "" {
+		claims["req_acr"] = requiredACR
+	}
+	auth.apply(claims)
+
+	return token.SignedString([]byte(app.Secret))
+}
+
+// ParseMFAChallengeToken проверяет токен, выпущенный NewMFAChallengeToken.
+func ParseMFAChallengeToken(ctx context.Context, tokenString string, appProvider AppProvider) (jwt.MapClaims, error) {
+	return parseForApp(ctx, tokenString, appProvider, TypeMFAChallenge)
+}
+
+// NewMagicLinkToken выпускает подписанный токен для ссылки входа без пароля.
+// jti связывает токен с запросом входа, который погашается при первом использовании.
+func NewMagicLinkToken(user models.User, app models.App, duration time.Duration, requestID string) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+
+	claims := token.Claims.(jwt.MapClaims)
+	claims["uid"] = user.ID
+	claims["exp"] = time.Now().Add(duration).Unix()
+	claims["app_id"] = app.ID
+	claims["typ"] = TypeMagicLink
+	claims["jti"] = requestID
+
+	return token.SignedString([]byte(app.Secret))
+}
+
+// ParseMagicLinkToken проверяет токен, выпущенный NewMagicLinkToken.
+func ParseMagicLinkToken(ctx context.Context, tokenString string, appProvider AppProvider) (jwt.MapClaims, error) {
+	return parseForApp(ctx, tokenString, appProvider, TypeMagicLink)
+}
+
+// NewInvitationToken выпускает подписанный токен приглашения в организацию.
+// jti — ID приглашения; uid нет, так как приглашенного аккаунта может еще не быть.
+func NewInvitationToken(app models.App, invitationID string, expiresAt time.Time) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+
+	claims := token.Claims.(jwt.MapClaims)
+	claims["exp"] = expiresAt.Unix()
+	claims["app_id"] = app.ID
+	claims["typ"] = TypeInvitation
+	claims["jti"] = invitationID
+
+	return token.SignedString([]byte(app.Secret))
+}
+
+// ParseInvitationToken проверяет токен, выпущенный NewInvitationToken.
+func ParseInvitationToken(ctx context.Context, tokenString string, appProvider AppProvider) (jwt.MapClaims, error) {
+	return parseForApp(ctx, tokenString, appProvider, TypeInvitation)
+}
+
+// Auth извлекает из claims сведения об аутентификации.
+func Auth(claims jwt.MapClaims) AuthInfo {
+	var info AuthInfo
+
+	info.AMR = stringList(claims["amr"])
+
+	if authTime, ok := claims["auth_time"].(float64); ok {
+		info.AuthTime = time.Unix(int64(authTime), 0)
+	}
+	if acr, ok := claims["acr"].(string); ok {
+		info.ACR = acr
+	}
+	if scope, ok := claims["scope"].(string); ok {
+		info.Scope = strings.Fields(scope)
+	}
+	if orgID, ok := claims["org_id"].(float64); ok {
+		info.OrgID = int64(orgID)
+	}
+
+	return info
+}
+
+// AccessGrants извлекает из access токена роли и разрешения.
+func AccessGrants(claims jwt.MapClaims) Grants {
+	grants := Grants{
+		Roles:       stringList(claims["roles"]),
+		Permissions: stringList(claims["permissions"]),
+	}
+	grants.OrgRole, _ = claims["org_role"].(string)
+
+	return grants
+}
+
+// RequiredACR извлекает из токена MFA-проверки требуемый уровень аутентификации.
+func RequiredACR(claims jwt.MapClaims) string {
+	acr, _ := claims["req_acr"].(string)
+	return acr
+}
+
+// UserID извлекает claim uid. Числа в JWT декодируются как float64.
+func UserID(claims jwt.MapClaims) (int64, error) {
+	uid, ok := claims["uid"].(float64)
+	if !ok {
+		return 0, ErrInvalidToken
+	}
+
+	return int64(uid), nil
+}
+
+// AppID извлекает claim app_id.
+func AppID(claims jwt.MapClaims) (int, error) {
+	appID, ok := claims["app_id"].(float64)
+	if !ok {
+		return 0, ErrInvalidToken
+	}
+
+	return int(appID), nil
+}
+
+// stringList извлекает строки из claim-массива.
+func stringList(claim interface{}) []string {
+	values, _ := claim.([]interface{})
+
+	var out []string
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+// parseForApp проверяет токен секретом приложения из claim app_id.
+func parseForApp(ctx context.Context, tokenString string, appProvider AppProvider, typ string) (jwt.MapClaims, error) {
+	unverified := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, unverified); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	appID, err := AppID(unverified)
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := appProvider.App(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+
+	return parse(tokenString, app.Secret, typ)
+}
+
+// parse проверяет подпись и срок действия токена. Токен без claim typ
+// выпущен до его появления и принимается только как refresh токен: такой токен
+// еще и сверяется с сохраненным в БД, поэтому access токен без typ за него не
+// сойдет. Access токены без typ не принимаются — они короткоживущие и уже истекли.
+func parse(tokenString string, secret string, typ string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	tokenTyp, ok := claims["typ"]
+	if (ok && tokenTyp != typ) || (!ok && typ != TypeRefresh) {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+type Channel string
+
+const (
+	ChannelEmail Channel = "email"
+	ChannelSMS   Channel = "sms"
+)
+
+var (
+	ErrUnsupportedChannel = errors.New("unsupported message channel")
+	ErrInvalidRecipient   = errors.New("invalid message recipient")
+)
+
+// Message — сообщение пользователю: письмо или SMS.
+type Message struct {
+	Channel Channel
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender доставляет сообщения пользователям.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// ChannelSender передает сообщение отправителю его канала.
+type ChannelSender map[Channel]Sender
+
+func (s ChannelSender) Send(ctx context.Context, msg Message) error {
+	sender, ok := s[msg.Channel]
+	if !ok {
+		return fmt.Errorf("notify.ChannelSender.Send: %w: %s", ErrUnsupportedChannel, msg.Channel)
+	}
+
+	return sender.Send(ctx, msg)
+}
+
+// LogSender пишет сообщения в лог вместо отправки, вместе с кодами и ссылками
+// из тела. Допустим только в локальном окружении.
+type LogSender struct {
+	log *slog.Logger
+}
+
+func NewLogSender(log *slog.Logger) *LogSender {
+	return &LogSender{log: log}
+}
+
+func (s *LogSender) Send(_ context.Context, msg Message) error {
+	s.log.Info("message sent",
+		slog.String("channel", string(msg.Channel)),
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject),
+		slog.String("body", msg.Body),
+	)
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const smtpTimeout = 30 * time.Second
+
+// SMTPSender отправляет письма через SMTP сервер. Соединение всегда
+// переводится в TLS командой STARTTLS: коды и ссылки для входа нельзя
+// передавать открытым текстом.
+type SMTPSender struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPSender(host string, port int, username, password, from string) (*SMTPSender, error) {
+	const op = "notify.NewSMTPSender"
+
+	if host == "" || port <= 0 {
+		return nil, fmt.Errorf("%s: host and port are required", op)
+	}
+	if from == "" || strings.ContainsAny(from, "\r\n") {
+		return nil, fmt.Errorf("%s: invalid from address", op)
+	}
+
+	return &SMTPSender{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		host:     host,
+		username: username,
+		password: password,
+		from:     from,
+	}, nil
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	const op = "notify.SMTPSender.Send"
+
+	if msg.Channel != ChannelEmail {
+		return fmt.Errorf("%s: %w", op, ErrUnsupportedChannel)
+	}
+	if msg.To == "" || strings.ContainsAny(msg.To, "\r\n") {
+		return fmt.Errorf("%s: %w", op, ErrInvalidRecipient)
+	}
+
+	body, err := s.message(msg)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return fmt.Errorf("%s: %v", op, err)
+		}
+	}
+
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	defer c.Close()
+
+	if err := c.StartTLS(&tls.Config{ServerName: s.host, MinVersion: tls.VersionTLS12}); err != nil {
+		return fmt.Errorf("%s: starttls: %v", op, err)
+	}
+	if s.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return fmt.Errorf("%s: auth: %v", op, err)
+		}
+	}
+
+	if err := c.Mail(s.from); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := c.Quit(); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+// message собирает письмо в формате RFC 5322 с телом в quoted-printable.
+func (s *SMTPSender) message(msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "From: %s\r\n", s.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buf.WriteString("\r\n")
+
+	w := quotedprintable.NewWriter(&buf)
+	if _, err := w.Write([]byte(msg.Body)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// WebhookSender передает сообщения HTTP шлюзу (например, SMS провайдера)
+// POST запросом с JSON {"channel", "to", "subject", "body"}. Токен, если задан,
+// передается в заголовке Authorization: Bearer. Ответ вне 2xx считается ошибкой.
+type WebhookSender struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func NewWebhookSender(rawURL, token string) (*WebhookSender, error) {
+	const op = "notify.NewWebhookSender"
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%s: invalid url", op)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("%s: url must use https", op)
+	}
+
+	return &WebhookSender{
+		url:    rawURL,
+		token:  token,
+		client: &http.Client{Timeout: webhookTimeout},
+	}, nil
+}
+
+func (s *WebhookSender) Send(ctx context.Context, msg Message) error {
+	const op = "notify.WebhookSender.Send"
+
+	if msg.To == "" {
+		return fmt.Errorf("%s: %w", op, ErrInvalidRecipient)
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"channel": string(msg.Channel),
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"body":    msg.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: unexpected status %d", op, resp.StatusCode)
+	}
+
+	return nil
+}
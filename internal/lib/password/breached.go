@@ -0,0 +1,120 @@
+package password
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// BreachedList — локальный список утекших паролей в формате Have I Been Pwned
+// "ordered by hash": строки вида "<SHA-1 в верхнем регистре>:<количество>",
+// отсортированные по хешу. Поиск выполняется бинарным поиском по файлу,
+// поэтому файл не загружается в память.
+type BreachedList struct {
+	f    *os.File
+	size int64
+}
+
+// OpenBreachedList открывает файл со списком утекших паролей.
+func OpenBreachedList(path string) (*BreachedList, error) {
+	const op = "password.OpenBreachedList"
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return &BreachedList{f: f, size: info.Size()}, nil
+}
+
+// Close закрывает файл.
+func (b *BreachedList) Close() error {
+	return b.f.Close()
+}
+
+// Contains сообщает, есть ли пароль в списке.
+func (b *BreachedList) Contains(pass string) (bool, error) {
+	sum := sha1.Sum([]byte(pass))
+	target := []byte(strings.ToUpper(hex.EncodeToString(sum[:])))
+
+	// Инвариант: все строки, начинающиеся до lo, меньше target;
+	// строка, начинающаяся в hi или позже, не меньше target.
+	lo, hi := int64(0), b.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		start, line, err := b.lineAfter(mid)
+		if err != nil {
+			return false, err
+		}
+		if line == nil || bytes.Compare(line, target) >= 0 {
+			hi = mid
+			continue
+		}
+		lo = start + 1
+	}
+
+	_, line, err := b.lineAfter(lo)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(line, target), nil
+}
+
+// lineAfter возвращает хеш из первой строки, начинающейся не раньше offset,
+// и смещение ее начала. Для offset = 0 это первая строка файла.
+func (b *BreachedList) lineAfter(offset int64) (int64, []byte, error) {
+	const chunk = 128
+
+	start := offset
+	if offset > 0 {
+		// Строка начинается после ближайшего перевода строки перед или на offset-1.
+		buf := make([]byte, chunk)
+		pos := offset - 1
+		for {
+			n, err := b.f.ReadAt(buf, pos)
+			if n == 0 && err != nil {
+				if err == io.EOF {
+					return b.size, nil, nil
+				}
+				return 0, nil, err
+			}
+			if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+				start = pos + int64(i) + 1
+				break
+			}
+			pos += int64(n)
+		}
+	}
+
+	if start >= b.size {
+		return b.size, nil, nil
+	}
+
+	buf := make([]byte, chunk)
+	n, err := b.f.ReadAt(buf, start)
+	if n == 0 && err != nil && err != io.EOF {
+		return 0, nil, err
+	}
+
+	line := buf[:n]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	if i := bytes.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+
+	return start, bytes.ToUpper(bytes.TrimSpace(line)), nil
+}
@@ -0,0 +1,183 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Algorithm string
+
+const (
+	Argon2id Algorithm = "argon2id"
+	Bcrypt   Algorithm = "bcrypt"
+)
+
+var (
+	ErrUnknownHashFormat = errors.New("unknown password hash format")
+	ErrMismatch          = errors.New("password does not match")
+)
+
+// Argon2Params — параметры argon2id. Memory задается в КиБ.
+type Argon2Params struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+// Hasher хеширует пароли выбранным алгоритмом и проверяет хеши любого
+// поддерживаемого формата. Хеши самоописываемые: argon2id хранится в формате PHC
+// ("$argon2id$v=19$m=...,t=...,p=...$соль$хеш"), bcrypt — в собственном формате "$2a$...".
+type Hasher struct {
+	algorithm  Algorithm
+	argon2     Argon2Params
+	bcryptCost int
+}
+
+// NewHasher создает Hasher, который хеширует новые пароли алгоритмом algorithm.
+func NewHasher(algorithm Algorithm, argon2Params Argon2Params, bcryptCost int) (*Hasher, error) {
+	const op = "password.NewHasher"
+
+	switch algorithm {
+	case Argon2id:
+		// Хеши с параметрами выше границ decodeArgon2 нельзя было бы проверить
+		if !validArgon2Params(argon2Params) || argon2Params.KeyLen < 16 || argon2Params.SaltLen < 8 {
+			return nil, fmt.Errorf("%s: invalid argon2id parameters", op)
+		}
+	case Bcrypt:
+		if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("%s: bcrypt cost must be between %d and %d", op, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported algorithm %q", op, algorithm)
+	}
+
+	return &Hasher{algorithm: algorithm, argon2: argon2Params, bcryptCost: bcryptCost}, nil
+}
+
+// Hash хеширует пароль текущим алгоритмом с текущими параметрами.
+func (h *Hasher) Hash(pass string) ([]byte, error) {
+	if h.algorithm == Bcrypt {
+		return bcrypt.GenerateFromPassword([]byte(pass), h.bcryptCost)
+	}
+
+	salt := make([]byte, h.argon2.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(pass), salt, h.argon2.Time, h.argon2.Memory, h.argon2.Threads, h.argon2.KeyLen)
+
+	return []byte(encodeArgon2(h.argon2, salt, key)), nil
+}
+
+// Verify проверяет пароль по хешу. needsRehash сообщает, что хеш построен
+// другим алгоритмом или с другими параметрами и его стоит пересчитать.
+// При несовпадении пароля возвращается ErrMismatch.
+func (h *Hasher) Verify(hash []byte, pass string) (needsRehash bool, err error) {
+	encoded := string(hash)
+
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		params, salt, key, err := decodeArgon2(encoded, "argon2id")
+		if err != nil {
+			return false, err
+		}
+
+		actual := argon2.IDKey([]byte(pass), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(actual, key) != 1 {
+			return false, ErrMismatch
+		}
+
+		return h.algorithm != Argon2id || params != h.argon2, nil
+
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		if err := bcrypt.CompareHashAndPassword(hash, []byte(pass)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, ErrMismatch
+			}
+			return false, err
+		}
+
+		if h.algorithm != Bcrypt {
+			return true, nil
+		}
+		cost, err := bcrypt.Cost(hash)
+		if err != nil {
+			return false, err
+		}
+
+		return cost != h.bcryptCost, nil
+
+	case strings.HasPrefix(encoded, "$argon2i$"), strings.HasPrefix(encoded, "$pbkdf2-"), strings.HasPrefix(encoded, "$salted-"):
+		// Хеши, импортированные из других систем, всегда пересчитываются текущим алгоритмом
+		if err := verifyLegacy(encoded, pass); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	return false, ErrUnknownHashFormat
+}
+
+func encodeArgon2(p Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2(encoded string, variant string) (Argon2Params, []byte, []byte, error) {
+	// "", вариант, "v=19", "m=...,t=...,p=...", соль, хеш
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != variant {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+
+	var p Argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+
+	p.SaltLen = uint32(len(salt))
+	p.KeyLen = uint32(len(key))
+
+	if !validArgon2Params(p) {
+		return Argon2Params{}, nil, nil, fmt.Errorf("%w: argon2 parameters out of range", ErrUnknownHashFormat)
+	}
+
+	return p, salt, key, nil
+}
+
+// validArgon2Params проверяет, что параметры argon2 ненулевые и не превышают
+// границ: argon2 паникует при нулевых t и p, а большой m исчерпывает память.
+func validArgon2Params(p Argon2Params) bool {
+	return p.Memory > 0 && p.Memory <= maxArgon2Memory &&
+		p.Time > 0 && p.Time <= maxArgon2Time &&
+		p.Threads > 0 && p.Threads <= maxArgon2Threads &&
+		p.KeyLen > 0 && p.KeyLen <= maxKeyLen
+}
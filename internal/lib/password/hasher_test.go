@@ -0,0 +1,131 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testArgon2 = Argon2Params{Time: 1, Memory: 64, Threads: 1, KeyLen: 16, SaltLen: 8}
+
+func mustHasher(t *testing.T, algorithm Algorithm, params Argon2Params, bcryptCost int) *Hasher {
+	t.Helper()
+
+	h, err := NewHasher(algorithm, params, bcryptCost)
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+
+	return h
+}
+
+func mustHash(t *testing.T, h interface{ Hash(string) ([]byte, error) }, pass string) []byte {
+	t.Helper()
+
+	hash, err := h.Hash(pass)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	return hash
+}
+
+func TestHasherRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher *Hasher
+		prefix string
+	}{
+		{name: "argon2id", hasher: mustHasher(t, Argon2id, testArgon2, 0), prefix: "$argon2id$v=19$m=64,t=1,p=1$"},
+		{name: "bcrypt", hasher: mustHasher(t, Bcrypt, testArgon2, 4), prefix: "$2a$04$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash := mustHash(t, tt.hasher, "correct horse")
+			if !strings.HasPrefix(string(hash), tt.prefix) {
+				t.Errorf("hash = %q, want prefix %q", hash, tt.prefix)
+			}
+
+			needsRehash, err := tt.hasher.Verify(hash, "correct horse")
+			if err != nil || needsRehash {
+				t.Errorf("Verify(correct) = %v, %v; want false, nil", needsRehash, err)
+			}
+
+			if _, err := tt.hasher.Verify(hash, "wrong horse"); !errors.Is(err, ErrMismatch) {
+				t.Errorf("Verify(wrong) error = %v, want %v", err, ErrMismatch)
+			}
+		})
+	}
+}
+
+func TestHasherNeedsRehash(t *testing.T) {
+	argon2Hash := mustHash(t, mustHasher(t, Argon2id, testArgon2, 0), "secret")
+	bcryptHash := mustHash(t, mustHasher(t, Bcrypt, testArgon2, 4), "secret")
+
+	stronger := testArgon2
+	stronger.Time = 2
+
+	tests := []struct {
+		name   string
+		hasher *Hasher
+		hash   []byte
+		want   bool
+	}{
+		{name: "same argon2 params", hasher: mustHasher(t, Argon2id, testArgon2, 0), hash: argon2Hash, want: false},
+		{name: "other argon2 params", hasher: mustHasher(t, Argon2id, stronger, 0), hash: argon2Hash, want: true},
+		{name: "argon2 to bcrypt", hasher: mustHasher(t, Bcrypt, testArgon2, 4), hash: argon2Hash, want: true},
+		{name: "same bcrypt cost", hasher: mustHasher(t, Bcrypt, testArgon2, 4), hash: bcryptHash, want: false},
+		{name: "other bcrypt cost", hasher: mustHasher(t, Bcrypt, testArgon2, 5), hash: bcryptHash, want: true},
+		{name: "bcrypt to argon2", hasher: mustHasher(t, Argon2id, testArgon2, 0), hash: bcryptHash, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			needsRehash, err := tt.hasher.Verify(tt.hash, "secret")
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if needsRehash != tt.want {
+				t.Errorf("needsRehash = %v, want %v", needsRehash, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasherRejectsArgon2ParamsOutOfRange(t *testing.T) {
+	h := mustHasher(t, Argon2id, testArgon2, 0)
+
+	const saltAndKey = "$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5a2V5aw"
+
+	tests := []struct {
+		name   string
+		params string
+	}{
+		{name: "zero time", params: "m=64,t=0,p=1"},
+		{name: "zero threads", params: "m=64,t=1,p=0"},
+		{name: "zero memory", params: "m=0,t=1,p=1"},
+		{name: "huge memory", params: "m=4194304,t=1,p=1"},
+		{name: "huge time", params: "m=64,t=1000,p=1"},
+		{name: "too many threads", params: "m=64,t=1,p=64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash := "$argon2id$v=19$" + tt.params + saltAndKey
+
+			if _, err := h.Verify([]byte(hash), "secret"); !errors.Is(err, ErrUnknownHashFormat) {
+				t.Errorf("Verify() error = %v, want %v", err, ErrUnknownHashFormat)
+			}
+			if _, err := ImportHash(FormatArgon2, hash, "", ""); !errors.Is(err, ErrUnknownHashFormat) {
+				t.Errorf("ImportHash() error = %v, want %v", err, ErrUnknownHashFormat)
+			}
+		})
+	}
+
+	huge := testArgon2
+	huge.Memory = maxArgon2Memory + 1
+	if _, err := NewHasher(Argon2id, huge, 0); err == nil {
+		t.Error("NewHasher accepted argon2 memory above the verification bound")
+	}
+}
@@ -0,0 +1,276 @@
+package password
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Форматы хешей, которые можно импортировать из других систем.
+// Хеши хранятся в самоописываемом виде и пересчитываются текущим алгоритмом
+// при первом успешном входе:
+//
+//	$argon2i$v=19$m=...,t=...,p=...$<соль>$<хеш>      (PHC)
+//	$pbkdf2-<sha1|sha256|sha512>$i=<итерации>$<соль>$<хеш>
+//	$salted-<sha1|sha256|sha512>$<prefix|suffix>$<соль>$<хеш hex>
+//
+// Соль и хеш PBKDF2 и соль salted-SHA закодированы в base64 без выравнивания.
+// prefix означает sha(соль + пароль), suffix — sha(пароль + соль).
+const (
+	FormatBcrypt    = "bcrypt"
+	FormatArgon2    = "argon2"
+	FormatPBKDF2    = "pbkdf2"
+	FormatSaltedSHA = "salted-sha"
+)
+
+// Границы параметров хешей. Хеш с большими параметрами заставил бы каждую
+// попытку входа по этому email тратить гигабайты памяти или секунды CPU.
+// Границы argon2 проверяются и при импорте, и при разборе любого хеша.
+const (
+	maxImportBcryptCost = 16
+	maxArgon2Memory     = 256 * 1024 // КиБ
+	maxArgon2Time       = 16
+	maxArgon2Threads    = 16
+	maxImportPBKDF2Iter = 2_000_000
+	maxKeyLen           = 128
+)
+
+// ImportHash проверяет хеш из другой системы и приводит его к формату хранения.
+// format — FormatBcrypt, FormatArgon2, FormatPBKDF2, "salted-sha1", "salted-sha256"
+// или "salted-sha512"; пустой format определяется по виду хеша.
+// salt и saltPosition ("prefix" или "suffix") нужны только для salted-SHA.
+// PBKDF2 принимается в формате Django ("pbkdf2_sha256$<итерации>$<соль>$<хеш base64>")
+// или в формате хранения.
+func ImportHash(format string, encoded string, salt string, saltPosition string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+
+	if format == "" {
+		format = detectFormat(encoded)
+	}
+
+	switch {
+	case format == FormatBcrypt:
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnknownHashFormat, err)
+		}
+		if cost > maxImportBcryptCost {
+			return nil, fmt.Errorf("%w: bcrypt cost %d exceeds %d", ErrUnknownHashFormat, cost, maxImportBcryptCost)
+		}
+		return []byte(encoded), nil
+
+	case format == FormatArgon2:
+		variant := strings.SplitN(strings.TrimPrefix(encoded, "$"), "$", 2)[0]
+		if variant != "argon2id" && variant != "argon2i" {
+			return nil, ErrUnknownHashFormat
+		}
+		if _, _, _, err := decodeArgon2(encoded, variant); err != nil {
+			return nil, err
+		}
+		return []byte(encoded), nil
+
+	case format == FormatPBKDF2:
+		return importPBKDF2(encoded)
+
+	case strings.HasPrefix(format, FormatSaltedSHA):
+		algo := strings.TrimPrefix(format, "salted-")
+		if _, ok := shaFunc(algo); !ok {
+			return nil, fmt.Errorf("%w: unsupported digest %q", ErrUnknownHashFormat, algo)
+		}
+		if saltPosition != "prefix" && saltPosition != "suffix" {
+			return nil, fmt.Errorf("%w: salt position must be prefix or suffix", ErrUnknownHashFormat)
+		}
+		digest, err := hex.DecodeString(strings.ToLower(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("%w: digest must be hex", ErrUnknownHashFormat)
+		}
+		return []byte(fmt.Sprintf("$salted-%s$%s$%s$%s",
+			algo, saltPosition, base64.RawStdEncoding.EncodeToString([]byte(salt)), hex.EncodeToString(digest),
+		)), nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownHashFormat, format)
+}
+
+func detectFormat(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return FormatBcrypt
+	case strings.HasPrefix(encoded, "$argon2"):
+		return FormatArgon2
+	case strings.HasPrefix(encoded, "pbkdf2_"), strings.HasPrefix(encoded, "$pbkdf2-"):
+		return FormatPBKDF2
+	}
+
+	return ""
+}
+
+// importPBKDF2 принимает хеш в формате Django или в формате хранения.
+func importPBKDF2(encoded string) ([]byte, error) {
+	if strings.HasPrefix(encoded, "$pbkdf2-") {
+		_, iterations, _, key, err := decodePBKDF2(encoded)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkPBKDF2Params(iterations, key); err != nil {
+			return nil, err
+		}
+		return []byte(encoded), nil
+	}
+
+	// pbkdf2_sha256$<итерации>$<соль>$<хеш base64>
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || !strings.HasPrefix(parts[0], "pbkdf2_") {
+		return nil, ErrUnknownHashFormat
+	}
+
+	algo := strings.TrimPrefix(parts[0], "pbkdf2_")
+	if _, ok := shaFunc(algo); !ok {
+		return nil, fmt.Errorf("%w: unsupported digest %q", ErrUnknownHashFormat, algo)
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return nil, ErrUnknownHashFormat
+	}
+
+	key, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return nil, ErrUnknownHashFormat
+	}
+	if err := checkPBKDF2Params(iterations, key); err != nil {
+		return nil, err
+	}
+
+	return []byte(fmt.Sprintf("$pbkdf2-%s$i=%d$%s$%s",
+		algo, iterations,
+		base64.RawStdEncoding.EncodeToString([]byte(parts[2])),
+		base64.RawStdEncoding.EncodeToString(key),
+	)), nil
+}
+
+// checkPBKDF2Params ограничивает стоимость проверки импортируемого хеша PBKDF2:
+// длинный ключ умножает число итераций на число блоков.
+func checkPBKDF2Params(iterations int, key []byte) error {
+	if iterations > maxImportPBKDF2Iter || len(key) > maxKeyLen {
+		return fmt.Errorf("%w: pbkdf2 parameters out of range", ErrUnknownHashFormat)
+	}
+
+	return nil
+}
+
+func decodePBKDF2(encoded string) (func() hash.Hash, int, []byte, []byte, error) {
+	// "", "pbkdf2-<алгоритм>", "i=...", соль, хеш
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 {
+		return nil, 0, nil, nil, ErrUnknownHashFormat
+	}
+
+	h, ok := shaFunc(strings.TrimPrefix(parts[1], "pbkdf2-"))
+	if !ok {
+		return nil, 0, nil, nil, ErrUnknownHashFormat
+	}
+
+	iterations, err := strconv.Atoi(strings.TrimPrefix(parts[2], "i="))
+	if err != nil || iterations <= 0 {
+		return nil, 0, nil, nil, ErrUnknownHashFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, 0, nil, nil, ErrUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(key) == 0 {
+		return nil, 0, nil, nil, ErrUnknownHashFormat
+	}
+
+	return h, iterations, salt, key, nil
+}
+
+// verifyLegacy проверяет пароль по импортированному хешу.
+func verifyLegacy(encoded string, pass string) error {
+	var actual, expected []byte
+
+	switch {
+	case strings.HasPrefix(encoded, "$argon2i$"):
+		params, salt, key, err := decodeArgon2(encoded, "argon2i")
+		if err != nil {
+			return err
+		}
+		actual = argon2.Key([]byte(pass), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+		expected = key
+
+	case strings.HasPrefix(encoded, "$pbkdf2-"):
+		h, iterations, salt, key, err := decodePBKDF2(encoded)
+		if err != nil {
+			return err
+		}
+		actual = pbkdf2.Key([]byte(pass), salt, iterations, len(key), h)
+		expected = key
+
+	case strings.HasPrefix(encoded, "$salted-"):
+		// "", "salted-<алгоритм>", позиция соли, соль, хеш
+		parts := strings.Split(encoded, "$")
+		if len(parts) != 5 {
+			return ErrUnknownHashFormat
+		}
+		h, ok := shaFunc(strings.TrimPrefix(parts[1], "salted-"))
+		if !ok {
+			return ErrUnknownHashFormat
+		}
+		salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+		if err != nil {
+			return ErrUnknownHashFormat
+		}
+		if expected, err = hex.DecodeString(parts[4]); err != nil {
+			return ErrUnknownHashFormat
+		}
+
+		d := h()
+		switch parts[2] {
+		case "prefix":
+			d.Write(salt)
+			d.Write([]byte(pass))
+		case "suffix":
+			d.Write([]byte(pass))
+			d.Write(salt)
+		default:
+			return ErrUnknownHashFormat
+		}
+		actual = d.Sum(nil)
+
+	default:
+		return ErrUnknownHashFormat
+	}
+
+	if subtle.ConstantTimeCompare(actual, expected) != 1 {
+		return ErrMismatch
+	}
+
+	return nil
+}
+
+func shaFunc(name string) (func() hash.Hash, bool) {
+	switch name {
+	case "sha1":
+		return sha1.New, true
+	case "sha256":
+		return sha256.New, true
+	case "sha512":
+		return sha512.New, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,107 @@
+package password
+
+import (
+	"errors"
+	"testing"
+)
+
+// Векторы взяты из опубликованных наборов: PBKDF2-HMAC-SHA1 — RFC 6070,
+// argon2i — тесты эталонной реализации (phc-winner-argon2), SHA от "abc" — FIPS 180-2.
+func TestImportHashKnownVectors(t *testing.T) {
+	tests := []struct {
+		name         string
+		format       string
+		encoded      string
+		salt         string
+		saltPosition string
+		password     string
+	}{
+		{
+			name:     "django pbkdf2_sha1 (RFC 6070)",
+			encoded:  "pbkdf2_sha1$4096$salt$SwB5AbdlSJq+rUnZJvch0GWkKcE=",
+			password: "password",
+		},
+		{
+			name:     "django pbkdf2_sha256",
+			format:   FormatPBKDF2,
+			encoded:  "pbkdf2_sha256$10000$seasalt$CWWFdHOWwPnki7HvkcqN9iA2T3KLW1cf2uZ5kvArtVY=",
+			password: "lètmein",
+		},
+		{
+			name:     "argon2i",
+			encoded:  "$argon2i$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$wWKIMhR9lyDFvRz9YTZweHKfbftvj+qf+YFY4NeBbtA",
+			password: "password",
+		},
+		{
+			name:         "salted sha1 prefix",
+			format:       "salted-sha1",
+			encoded:      "a9993e364706816aba3e25717850c26c9cd0d89d",
+			salt:         "ab",
+			saltPosition: "prefix",
+			password:     "c",
+		},
+		{
+			name:         "salted sha256 suffix",
+			format:       "salted-sha256",
+			encoded:      "BA7816BF8F01CFEA414140DE5DAE2223B00361A396177A9CB410FF61F20015AD",
+			salt:         "bc",
+			saltPosition: "suffix",
+			password:     "a",
+		},
+		{
+			name:         "salted sha512 prefix",
+			format:       "salted-sha512",
+			encoded:      "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f",
+			salt:         "a",
+			saltPosition: "prefix",
+			password:     "bc",
+		},
+	}
+
+	h := mustHasher(t, Argon2id, testArgon2, 0)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := ImportHash(tt.format, tt.encoded, tt.salt, tt.saltPosition)
+			if err != nil {
+				t.Fatalf("ImportHash: %v", err)
+			}
+
+			needsRehash, err := h.Verify(hash, tt.password)
+			if err != nil {
+				t.Fatalf("Verify(%q): %v", hash, err)
+			}
+			if !needsRehash {
+				t.Error("needsRehash = false, want true for imported hash")
+			}
+
+			if _, err := h.Verify(hash, tt.password+"x"); !errors.Is(err, ErrMismatch) {
+				t.Errorf("Verify(wrong) error = %v, want %v", err, ErrMismatch)
+			}
+		})
+	}
+}
+
+func TestImportHashRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name         string
+		format       string
+		encoded      string
+		saltPosition string
+	}{
+		{name: "unknown format", encoded: "md5$abc"},
+		{name: "django unsupported digest", encoded: "pbkdf2_md5$1000$salt$SwB5AbdlSJq+rUnZJvch0GWkKcE="},
+		{name: "django too many iterations", encoded: "pbkdf2_sha256$100000000$salt$SwB5AbdlSJq+rUnZJvch0GWkKcE="},
+		{name: "bcrypt cost too high", encoded: "$2a$31$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"},
+		{name: "salted sha without position", format: "salted-sha1", encoded: "a9993e364706816aba3e25717850c26c9cd0d89d"},
+		{name: "salted sha not hex", format: "salted-sha1", encoded: "not hex", saltPosition: "prefix"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ImportHash(tt.format, tt.encoded, "", tt.saltPosition); !errors.Is(err, ErrUnknownHashFormat) {
+				t.Errorf("ImportHash() error = %v, want %v", err, ErrUnknownHashFormat)
+			}
+		})
+	}
+}
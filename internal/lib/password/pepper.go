@@ -0,0 +1,108 @@
+package password
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/1abobik1/Single-Sign-On/internal/lib/secret"
+)
+
+const pepperPrefix = "$pepper$"
+
+var (
+	ErrUnknownPepperKey = errors.New("unknown pepper key")
+)
+
+// PepperedHasher добавляет к паролю серверный секрет (pepper) перед хешированием:
+// хешируется HMAC-SHA256(ключ, пароль). Секрет хранится вне базы данных, поэтому
+// одной выгрузки таблицы users недостаточно для перебора паролей.
+//
+// К хешу добавляется ID ключа: "$pepper$<id>$argon2id$...". Это позволяет менять
+// ключ: старые ключи остаются для проверки, а хеши со старым ключом или без pepper
+// помечаются для пересчета при следующем успешном входе.
+type PepperedHasher struct {
+	hasher    *Hasher
+	currentID string
+	keys      map[string][]byte
+}
+
+// NewPepperedHasher создает PepperedHasher. Если currentID пуст, новые хеши строятся
+// без pepper, а keys используются только для проверки существующих хешей.
+func NewPepperedHasher(hasher *Hasher, currentID string, keys map[string][]byte) (*PepperedHasher, error) {
+	const op = "password.NewPepperedHasher"
+
+	for id, key := range keys {
+		if !secret.ValidKeyID(id) {
+			return nil, fmt.Errorf("%s: invalid pepper key id %q", op, id)
+		}
+		if len(key) < 32 {
+			return nil, fmt.Errorf("%s: pepper key %q must be at least 32 bytes", op, id)
+		}
+	}
+
+	if currentID != "" {
+		if _, ok := keys[currentID]; !ok {
+			return nil, fmt.Errorf("%s: %v %q", op, ErrUnknownPepperKey, currentID)
+		}
+	}
+
+	return &PepperedHasher{hasher: hasher, currentID: currentID, keys: keys}, nil
+}
+
+// Hash хеширует пароль с текущим ключом pepper.
+func (h *PepperedHasher) Hash(pass string) ([]byte, error) {
+	if h.currentID == "" {
+		return h.hasher.Hash(pass)
+	}
+
+	hash, err := h.hasher.Hash(pepper(h.keys[h.currentID], pass))
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(pepperPrefix + h.currentID + string(hash)), nil
+}
+
+// Verify проверяет пароль по хешу с pepper или без него. needsRehash также
+// выставляется, если хеш построен не с текущим ключом.
+func (h *PepperedHasher) Verify(hash []byte, pass string) (bool, error) {
+	encoded := string(hash)
+
+	if !strings.HasPrefix(encoded, pepperPrefix) {
+		needsRehash, err := h.hasher.Verify(hash, pass)
+		if err != nil {
+			return false, err
+		}
+
+		return needsRehash || h.currentID != "", nil
+	}
+
+	id, inner, ok := strings.Cut(strings.TrimPrefix(encoded, pepperPrefix), "$")
+	if !ok {
+		return false, ErrUnknownHashFormat
+	}
+
+	key, ok := h.keys[id]
+	if !ok {
+		return false, fmt.Errorf("%w %q", ErrUnknownPepperKey, id)
+	}
+
+	needsRehash, err := h.hasher.Verify([]byte("$"+inner), pepper(key, pass))
+	if err != nil {
+		return false, err
+	}
+
+	return needsRehash || id != h.currentID, nil
+}
+
+// pepper возвращает HMAC-SHA256 пароля в base64 — 44 байта, в пределах ограничения bcrypt.
+func pepper(key []byte, pass string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(pass))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,104 @@
+package password
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var (
+	testPepperKey1 = bytes.Repeat([]byte{1}, 32)
+	testPepperKey2 = bytes.Repeat([]byte{2}, 32)
+)
+
+func mustPepperedHasher(t *testing.T, currentID string, keys map[string][]byte) *PepperedHasher {
+	t.Helper()
+
+	h, err := NewPepperedHasher(mustHasher(t, Argon2id, testArgon2, 0), currentID, keys)
+	if err != nil {
+		t.Fatalf("NewPepperedHasher: %v", err)
+	}
+
+	return h
+}
+
+func TestPepperedHasherRoundTrip(t *testing.T) {
+	h := mustPepperedHasher(t, "k1", map[string][]byte{"k1": testPepperKey1})
+
+	hash := mustHash(t, h, "secret")
+	if !strings.HasPrefix(string(hash), "$pepper$k1$argon2id$") {
+		t.Errorf("hash = %q, want prefix $pepper$k1$argon2id$", hash)
+	}
+
+	needsRehash, err := h.Verify(hash, "secret")
+	if err != nil || needsRehash {
+		t.Errorf("Verify(correct) = %v, %v; want false, nil", needsRehash, err)
+	}
+
+	if _, err := h.Verify(hash, "wrong"); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Verify(wrong) error = %v, want %v", err, ErrMismatch)
+	}
+
+	// Без pepper хеш не совпадает: хешировался HMAC пароля, а не сам пароль
+	inner := []byte(strings.TrimPrefix(string(hash), "$pepper$k1"))
+	if _, err := mustHasher(t, Argon2id, testArgon2, 0).Verify(inner, "secret"); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Verify without pepper error = %v, want %v", err, ErrMismatch)
+	}
+}
+
+func TestPepperedHasherKeyRotation(t *testing.T) {
+	keys := map[string][]byte{"k1": testPepperKey1, "k2": testPepperKey2}
+
+	oldHash := mustHash(t, mustPepperedHasher(t, "k1", keys), "secret")
+	plainHash := mustHash(t, mustPepperedHasher(t, "", nil), "secret")
+
+	tests := []struct {
+		name    string
+		hasher  *PepperedHasher
+		hash    []byte
+		want    bool
+		wantErr error
+	}{
+		{name: "old key", hasher: mustPepperedHasher(t, "k2", keys), hash: oldHash, want: true},
+		{name: "current key", hasher: mustPepperedHasher(t, "k1", keys), hash: oldHash, want: false},
+		{name: "pepper disabled", hasher: mustPepperedHasher(t, "", keys), hash: oldHash, want: true},
+		{name: "hash without pepper", hasher: mustPepperedHasher(t, "k2", keys), hash: plainHash, want: true},
+		{name: "no pepper at all", hasher: mustPepperedHasher(t, "", nil), hash: plainHash, want: false},
+		{name: "removed key", hasher: mustPepperedHasher(t, "k2", map[string][]byte{"k2": testPepperKey2}), hash: oldHash, wantErr: ErrUnknownPepperKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			needsRehash, err := tt.hasher.Verify(tt.hash, "secret")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if needsRehash != tt.want {
+				t.Errorf("needsRehash = %v, want %v", needsRehash, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPepperedHasherValidatesKeys(t *testing.T) {
+	hasher := mustHasher(t, Argon2id, testArgon2, 0)
+
+	tests := []struct {
+		name      string
+		currentID string
+		keys      map[string][]byte
+	}{
+		{name: "unknown current key", currentID: "k2", keys: map[string][]byte{"k1": testPepperKey1}},
+		{name: "short key", currentID: "k1", keys: map[string][]byte{"k1": testPepperKey1[:16]}},
+		{name: "invalid key id", currentID: "", keys: map[string][]byte{"k$1": testPepperKey1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewPepperedHasher(hasher, tt.currentID, tt.keys); err == nil {
+				t.Error("NewPepperedHasher() error = nil, want error")
+			}
+		})
+	}
+}
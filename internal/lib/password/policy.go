@@ -0,0 +1,185 @@
+package password
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BcryptMaxBytes — bcrypt учитывает только первые 72 байта пароля.
+const BcryptMaxBytes = 72
+
+// commonPasswords — встроенный список самых распространенных паролей.
+var commonPasswords = []string{
+	"123456", "123456789", "12345678", "password", "qwerty", "qwerty123",
+	"1234567", "111111", "1234567890", "123123", "abc123", "1q2w3e4r",
+	"password1", "iloveyou", "000000", "qwertyuiop", "admin", "welcome",
+	"letmein", "monkey", "dragon", "football", "sunshine", "princess",
+}
+
+// Policy описывает требования к паролю.
+type Policy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+
+	denylist map[string]struct{}
+	breached *BreachedList
+}
+
+// NewPolicy создает политику. denylistPath и breachedPath необязательны:
+// первый содержит дополнительные запрещенные пароли по одному в строке,
+// второй — отсортированный по хешу список SHA-1 утекших паролей (см. BreachedList).
+func NewPolicy(
+	minLength int,
+	maxLength int,
+	requireUpper, requireLower, requireDigit, requireSymbol bool,
+	denylistPath string,
+	breachedPath string,
+) (*Policy, error) {
+	const op = "password.NewPolicy"
+
+	if maxLength <= 0 || maxLength > BcryptMaxBytes {
+		maxLength = BcryptMaxBytes
+	}
+	if minLength > maxLength {
+		return nil, fmt.Errorf("%s: min length %d exceeds max length %d", op, minLength, maxLength)
+	}
+
+	p := &Policy{
+		MinLength:     minLength,
+		MaxLength:     maxLength,
+		RequireUpper:  requireUpper,
+		RequireLower:  requireLower,
+		RequireDigit:  requireDigit,
+		RequireSymbol: requireSymbol,
+		denylist:      make(map[string]struct{}, len(commonPasswords)),
+	}
+
+	for _, pass := range commonPasswords {
+		p.denylist[pass] = struct{}{}
+	}
+
+	if denylistPath != "" {
+		if err := p.loadDenylist(denylistPath); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+	}
+
+	if breachedPath != "" {
+		breached, err := OpenBreachedList(breachedPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		p.breached = breached
+	}
+
+	return p, nil
+}
+
+func (p *Policy) loadDenylist(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			p.denylist[strings.ToLower(line)] = struct{}{}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Validate проверяет пароль и возвращает список нарушений политики.
+// Ошибка возвращается только при сбое проверки по списку утекших паролей.
+func (p *Policy) Validate(email string, pass string) ([]string, error) {
+	var violations []string
+
+	if n := utf8.RuneCountInString(pass); n < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	if len(pass) > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d bytes long", p.MaxLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range pass {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case !unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		violations = append(violations, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, "must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, "must contain a symbol")
+	}
+
+	if _, ok := p.denylist[strings.ToLower(pass)]; ok {
+		violations = append(violations, "is too common")
+	}
+
+	if similarToEmail(email, pass) {
+		violations = append(violations, "must not be similar to the email")
+	}
+
+	if p.breached != nil {
+		found, err := p.breached.Contains(pass)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			violations = append(violations, "has appeared in a data breach")
+		}
+	}
+
+	return violations, nil
+}
+
+// similarToEmail сообщает, совпадает ли пароль с email или его локальной частью,
+// либо содержит одно в другом.
+func similarToEmail(email string, pass string) bool {
+	email = strings.ToLower(email)
+	pass = strings.ToLower(pass)
+	if email == "" || pass == "" {
+		return false
+	}
+
+	local, _, _ := strings.Cut(email, "@")
+	if pass == email || pass == local {
+		return true
+	}
+
+	const minOverlap = 4
+	if len(local) >= minOverlap && strings.Contains(pass, local) {
+		return true
+	}
+	if len(pass) >= minOverlap && strings.Contains(email, pass) {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,197 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Attributes — атрибуты одного пространства имен. Значения сравниваются как строки.
+type Attributes map[string]string
+
+// Request — проверка разрешения, к которой применяются политики.
+type Request struct {
+	Permission string
+	Subject    Attributes
+	Resource   Attributes
+	Context    Attributes
+}
+
+// Step — шаг объяснения решения: результат одной применимой к разрешению политики.
+type Step struct {
+	Policy  string
+	Effect  Effect
+	Matched bool
+	Reason  string
+}
+
+// Result — решение политик. Effect пуст, если ни одна политика не сработала.
+type Result struct {
+	Effect Effect
+	Trace  []Step
+}
+
+// Evaluate применяет политики к запросу. Запрещающая политика сильнее
+// разрешающей: если сработали обе, результат — EffectDeny. В Trace попадают
+// все политики, относящиеся к разрешению, в порядке policies.
+func Evaluate(policies []Policy, req Request) Result {
+	var res Result
+
+	for _, p := range policies {
+		if !p.Applies(req.Permission) {
+			continue
+		}
+
+		matched, reason := true, "no condition"
+		if p.Condition != nil {
+			matched, reason = p.Condition.eval(req)
+		}
+
+		res.Trace = append(res.Trace, Step{
+			Policy:  p.ID,
+			Effect:  p.Effect,
+			Matched: matched,
+			Reason:  reason,
+		})
+
+		if matched && res.Effect != EffectDeny {
+			res.Effect = p.Effect
+		}
+	}
+
+	return res
+}
+
+// eval вычисляет условие и описывает, почему оно выполнено или нет. Сравнение
+// с отсутствующим атрибутом не выполняется; not такого сравнения выполняется.
+func (c *Condition) eval(req Request) (bool, string) {
+	switch {
+	case c.All != nil:
+		reasons := make([]string, 0, len(c.All))
+		for i := range c.All {
+			ok, reason := c.All[i].eval(req)
+			if !ok {
+				return false, reason
+			}
+			reasons = append(reasons, reason)
+		}
+		return true, strings.Join(reasons, " and ")
+
+	case c.Any != nil:
+		reasons := make([]string, 0, len(c.Any))
+		for i := range c.Any {
+			ok, reason := c.Any[i].eval(req)
+			if ok {
+				return true, reason
+			}
+			reasons = append(reasons, reason)
+		}
+		return false, strings.Join(reasons, " or ")
+
+	case c.Not != nil:
+		ok, reason := c.Not.eval(req)
+		return !ok, "not (" + reason + ")"
+	}
+
+	value, found := req.lookup(c.Attr)
+	if c.Op == OpExists {
+		if found {
+			return true, c.Attr + " exists"
+		}
+		return false, c.Attr + " is missing"
+	}
+	if !found {
+		return false, c.Attr + " is missing"
+	}
+
+	operands := c.values
+	operandDesc := c.describeValues()
+	if c.Ref != "" {
+		ref, ok := req.lookup(c.Ref)
+		if !ok {
+			return false, c.Ref + " is missing"
+		}
+		operands = []string{ref}
+		operandDesc = fmt.Sprintf("%s %q", c.Ref, ref)
+	}
+
+	ok := compare(c.Op, value, operands)
+
+	verb := string(c.Op)
+	if !ok {
+		verb = "not " + verb
+	}
+
+	return ok, fmt.Sprintf("%s %q %s %s", c.Attr, value, verb, operandDesc)
+}
+
+func (c *Condition) describeValues() string {
+	if len(c.values) == 1 && c.Op != OpIn && c.Op != OpNotIn {
+		return strconv.Quote(c.values[0])
+	}
+
+	return "[" + strings.Join(c.values, ", ") + "]"
+}
+
+func (r Request) lookup(attr string) (string, bool) {
+	namespace, name, _ := strings.Cut(attr, ".")
+
+	var attrs Attributes
+	switch namespace {
+	case NamespaceSubject:
+		attrs = r.Subject
+	case NamespaceResource:
+		attrs = r.Resource
+	case NamespaceContext:
+		attrs = r.Context
+	}
+
+	value, ok := attrs[name]
+	return value, ok
+}
+
+func compare(op Operator, value string, operands []string) bool {
+	switch op {
+	case OpEq:
+		return value == operands[0]
+	case OpNe:
+		return value != operands[0]
+	case OpPrefix:
+		return strings.HasPrefix(value, operands[0])
+	case OpIn, OpNotIn:
+		found := false
+		for _, o := range operands {
+			if value == o {
+				found = true
+				break
+			}
+		}
+		return found == (op == OpIn)
+	}
+
+	x, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+	bounds := make([]float64, len(operands))
+	for i, o := range operands {
+		if bounds[i], err = strconv.ParseFloat(o, 64); err != nil {
+			return false
+		}
+	}
+
+	switch op {
+	case OpGt:
+		return x > bounds[0]
+	case OpGte:
+		return x >= bounds[0]
+	case OpLt:
+		return x < bounds[0]
+	case OpLte:
+		return x <= bounds[0]
+	case OpBetween:
+		return x >= bounds[0] && x < bounds[1]
+	}
+
+	return false
+}
@@ -0,0 +1,181 @@
+package policy
+
+import (
+	"slices"
+	"testing"
+)
+
+func mustParse(t *testing.T, data string) []Policy {
+	t.Helper()
+
+	policies, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	return policies
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies string
+		req      Request
+		want     Effect
+		// matched — политики из Trace, условие которых выполнено.
+		matched []string
+	}{
+		{
+			name: "deny wins over allow",
+			policies: `[
+				{"id": "allow", "effect": "allow", "permissions": ["orders:approve"]},
+				{"id": "deny", "effect": "deny", "permissions": ["orders:*"]}
+			]`,
+			req:     Request{Permission: "orders:approve"},
+			want:    EffectDeny,
+			matched: []string{"allow", "deny"},
+		},
+		{
+			name: "deny wins regardless of order",
+			policies: `[
+				{"id": "deny", "effect": "deny", "permissions": ["*"]},
+				{"id": "allow", "effect": "allow", "permissions": ["orders:approve"]}
+			]`,
+			req:     Request{Permission: "orders:approve"},
+			want:    EffectDeny,
+			matched: []string{"deny", "allow"},
+		},
+		{
+			name: "unmatched deny does not apply",
+			policies: `[
+				{"id": "allow", "effect": "allow", "permissions": ["orders:approve"]},
+				{"id": "deny", "effect": "deny", "permissions": ["orders:approve"],
+				 "condition": {"attr": "subject.status", "op": "eq", "value": "suspended"}}
+			]`,
+			req:     Request{Permission: "orders:approve", Subject: Attributes{"status": "active"}},
+			want:    EffectAllow,
+			matched: []string{"allow"},
+		},
+		{
+			name:     "other permission",
+			policies: `{"id": "allow", "effect": "allow", "permissions": ["orders:approve"]}`,
+			req:      Request{Permission: "orders:delete"},
+			want:     "",
+		},
+		{
+			name: "missing attribute does not match",
+			policies: `{"id": "allow", "effect": "allow", "permissions": ["*"],
+				"condition": {"attr": "subject.department", "op": "ne", "value": "sales"}}`,
+			req:  Request{Permission: "orders:approve", Subject: Attributes{}},
+			want: "",
+		},
+		{
+			name: "not of missing attribute matches",
+			policies: `{"id": "deny", "effect": "deny", "permissions": ["*"],
+				"condition": {"not": {"attr": "subject.department", "op": "eq", "value": "sales"}}}`,
+			req:     Request{Permission: "orders:approve"},
+			want:    EffectDeny,
+			matched: []string{"deny"},
+		},
+		{
+			name: "exists",
+			policies: `{"id": "allow", "effect": "allow", "permissions": ["*"],
+				"condition": {"attr": "context.ip", "op": "exists"}}`,
+			req:     Request{Permission: "orders:approve", Context: Attributes{"ip": "10.0.0.1"}},
+			want:    EffectAllow,
+			matched: []string{"allow"},
+		},
+		{
+			name: "between includes lower bound",
+			policies: `{"id": "allow", "effect": "allow", "permissions": ["*"],
+				"condition": {"attr": "context.hour", "op": "between", "value": [9, 18]}}`,
+			req:     Request{Permission: "orders:approve", Context: Attributes{"hour": "9"}},
+			want:    EffectAllow,
+			matched: []string{"allow"},
+		},
+		{
+			name: "between excludes upper bound",
+			policies: `{"id": "allow", "effect": "allow", "permissions": ["*"],
+				"condition": {"attr": "context.hour", "op": "between", "value": [9, 18]}}`,
+			req:  Request{Permission: "orders:approve", Context: Attributes{"hour": "18"}},
+			want: "",
+		},
+		{
+			name: "between with non-numeric value",
+			policies: `{"id": "allow", "effect": "allow", "permissions": ["*"],
+				"condition": {"attr": "context.hour", "op": "between", "value": [9, 18]}}`,
+			req:  Request{Permission: "orders:approve", Context: Attributes{"hour": "noon"}},
+			want: "",
+		},
+		{
+			name: "ref matches",
+			policies: `{"id": "allow", "effect": "allow", "permissions": ["*"],
+				"condition": {"attr": "subject.department", "op": "eq", "ref": "resource.department"}}`,
+			req: Request{
+				Permission: "orders:approve",
+				Subject:    Attributes{"department": "sales"},
+				Resource:   Attributes{"department": "sales"},
+			},
+			want:    EffectAllow,
+			matched: []string{"allow"},
+		},
+		{
+			name: "ref differs",
+			policies: `{"id": "allow", "effect": "allow", "permissions": ["*"],
+				"condition": {"attr": "subject.department", "op": "eq", "ref": "resource.department"}}`,
+			req: Request{
+				Permission: "orders:approve",
+				Subject:    Attributes{"department": "sales"},
+				Resource:   Attributes{"department": "finance"},
+			},
+			want: "",
+		},
+		{
+			name: "missing ref does not match",
+			policies: `{"id": "allow", "effect": "allow", "permissions": ["*"],
+				"condition": {"attr": "subject.department", "op": "ne", "ref": "resource.department"}}`,
+			req: Request{
+				Permission: "orders:approve",
+				Subject:    Attributes{"department": "sales"},
+			},
+			want: "",
+		},
+		{
+			name: "all and any",
+			policies: `{"id": "allow", "effect": "allow", "permissions": ["*"],
+				"condition": {"all": [
+					{"attr": "subject.title", "op": "in", "value": ["manager", "director"]},
+					{"any": [
+						{"attr": "context.weekday", "op": "between", "value": [1, 6]},
+						{"attr": "subject.on_call", "op": "eq", "value": "true"}
+					]}
+				]}}`,
+			req: Request{
+				Permission: "orders:approve",
+				Subject:    Attributes{"title": "manager", "on_call": "true"},
+				Context:    Attributes{"weekday": "7"},
+			},
+			want:    EffectAllow,
+			matched: []string{"allow"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := Evaluate(mustParse(t, tt.policies), tt.req)
+			if res.Effect != tt.want {
+				t.Errorf("Effect = %q, want %q; trace: %+v", res.Effect, tt.want, res.Trace)
+			}
+
+			var matched []string
+			for _, step := range res.Trace {
+				if step.Matched {
+					matched = append(matched, step.Policy)
+				}
+			}
+			if !slices.Equal(matched, tt.matched) {
+				t.Errorf("matched policies = %v, want %v", matched, tt.matched)
+			}
+		})
+	}
+}
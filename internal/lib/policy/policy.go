@@ -0,0 +1,354 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Пространства имен атрибутов, на которые ссылаются условия.
+const (
+	NamespaceSubject  = "subject"
+	NamespaceResource = "resource"
+	NamespaceContext  = "context"
+)
+
+var (
+	ErrInvalidPolicy = errors.New("invalid policy")
+)
+
+type Effect string
+
+const (
+	EffectAllow Effect = "allow"
+	EffectDeny  Effect = "deny"
+)
+
+type Operator string
+
+const (
+	OpEq     Operator = "eq"
+	OpNe     Operator = "ne"
+	OpIn     Operator = "in"
+	OpNotIn  Operator = "not_in"
+	OpPrefix Operator = "prefix"
+	OpGt     Operator = "gt"
+	OpGte    Operator = "gte"
+	OpLt     Operator = "lt"
+	OpLte    Operator = "lte"
+	// OpBetween проверяет число на полуинтервал [value[0], value[1]): для часов
+	// рабочего дня [9, 18] верно в 9:00–17:59.
+	OpBetween Operator = "between"
+	OpExists  Operator = "exists"
+)
+
+// Policy — декларативная политика доступа. Применяется к разрешениям из
+// Permissions, если выполнено Condition; пустое условие выполнено всегда.
+//
+//	{
+//	  "id": "approve-own-department",
+//	  "effect": "allow",
+//	  "permissions": ["orders:approve"],
+//	  "condition": {"all": [
+//	    {"attr": "subject.title", "op": "eq", "value": "manager"},
+//	    {"attr": "subject.department", "op": "eq", "ref": "resource.department"},
+//	    {"attr": "context.weekday", "op": "between", "value": [1, 6]},
+//	    {"attr": "context.hour", "op": "between", "value": [9, 18]}
+//	  ]}
+//	}
+type Policy struct {
+	ID          string `json:"id"`
+	Description string `json:"description,omitempty"`
+	// AppID — приложение, к проверкам которого применяется политика. 0 — ко всем.
+	AppID  int    `json:"app_id,omitempty"`
+	Effect Effect `json:"effect"`
+	// Permissions — разрешения, к которым применяется политика: точное имя,
+	// префикс с "*" на конце ("orders:*") или "*" для всех разрешений.
+	Permissions []string   `json:"permissions"`
+	Condition   *Condition `json:"condition,omitempty"`
+}
+
+// Condition — условие политики. Задается ровно одно из All, Any, Not или
+// сравнение атрибута Attr оператором Op со значением Value или с другим атрибутом Ref.
+type Condition struct {
+	All []Condition `json:"all,omitempty"`
+	Any []Condition `json:"any,omitempty"`
+	Not *Condition  `json:"not,omitempty"`
+
+	Attr  string      `json:"attr,omitempty"`
+	Op    Operator    `json:"op,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+	Ref   string      `json:"ref,omitempty"`
+
+	// values — Value, приведенное к строкам при проверке политики
+	values []string
+}
+
+// Parse разбирает JSON с одной политикой или массивом политик и проверяет их.
+func Parse(data []byte) ([]Policy, error) {
+	const op = "policy.Parse"
+
+	data = bytes.TrimSpace(data)
+
+	var policies []Policy
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &policies); err != nil {
+			return nil, fmt.Errorf("%s: %w: %v", op, ErrInvalidPolicy, err)
+		}
+	} else {
+		var p Policy
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, fmt.Errorf("%s: %w: %v", op, ErrInvalidPolicy, err)
+		}
+		policies = []Policy{p}
+	}
+
+	seen := make(map[string]struct{}, len(policies))
+	for i := range policies {
+		if err := policies[i].prepare(); err != nil {
+			return nil, fmt.Errorf("%s: %w: policy %q: %v", op, ErrInvalidPolicy, policies[i].ID, err)
+		}
+		if _, ok := seen[policies[i].ID]; ok {
+			return nil, fmt.Errorf("%s: %w: duplicate policy id %q", op, ErrInvalidPolicy, policies[i].ID)
+		}
+		seen[policies[i].ID] = struct{}{}
+	}
+
+	return policies, nil
+}
+
+// Load загружает политики из JSON файла или из всех файлов *.json каталога.
+// ID политик должны быть уникальны среди всех файлов.
+func Load(path string) ([]Policy, error) {
+	const op = "policy.Load"
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		sort.Strings(files)
+	}
+
+	var policies []Policy
+	seen := make(map[string]string)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+
+		parsed, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", op, file, err)
+		}
+		for _, p := range parsed {
+			if prev, ok := seen[p.ID]; ok {
+				return nil, fmt.Errorf("%s: %w: policy %q defined in %s and %s", op, ErrInvalidPolicy, p.ID, prev, file)
+			}
+			seen[p.ID] = file
+		}
+		policies = append(policies, parsed...)
+	}
+
+	return policies, nil
+}
+
+// Applies сообщает, относится ли политика к разрешению permission.
+func (p Policy) Applies(permission string) bool {
+	for _, pattern := range p.Permissions {
+		if pattern == "*" || pattern == permission {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(permission, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) prepare() error {
+	p.ID = strings.TrimSpace(p.ID)
+	if p.ID == "" {
+		return errors.New("id is required")
+	}
+	if p.Effect != EffectAllow && p.Effect != EffectDeny {
+		return fmt.Errorf("effect must be %q or %q", EffectAllow, EffectDeny)
+	}
+	if len(p.Permissions) == 0 {
+		return errors.New("permissions must not be empty")
+	}
+	for _, perm := range p.Permissions {
+		if strings.TrimSpace(perm) == "" || strings.Contains(strings.TrimSuffix(perm, "*"), "*") {
+			return fmt.Errorf("invalid permission pattern %q", perm)
+		}
+	}
+	if p.Condition != nil {
+		return p.Condition.prepare()
+	}
+
+	return nil
+}
+
+func (c *Condition) prepare() error {
+	set := 0
+	if c.All != nil {
+		set++
+	}
+	if c.Any != nil {
+		set++
+	}
+	if c.Not != nil {
+		set++
+	}
+	if c.Attr != "" {
+		set++
+	}
+	if set != 1 {
+		return errors.New("condition must set exactly one of all, any, not, attr")
+	}
+
+	for i := range c.All {
+		if err := c.All[i].prepare(); err != nil {
+			return err
+		}
+	}
+	for i := range c.Any {
+		if err := c.Any[i].prepare(); err != nil {
+			return err
+		}
+	}
+	if c.Not != nil {
+		return c.Not.prepare()
+	}
+	if c.Attr == "" {
+		return nil
+	}
+
+	if err := validateAttr(c.Attr); err != nil {
+		return err
+	}
+
+	values, err := normalizeValue(c.Value)
+	if err != nil {
+		return fmt.Errorf("%s: %v", c.Attr, err)
+	}
+	c.values = values
+
+	if c.Ref != "" {
+		if err := validateAttr(c.Ref); err != nil {
+			return err
+		}
+		if c.Value != nil {
+			return fmt.Errorf("%s: value and ref are mutually exclusive", c.Attr)
+		}
+	}
+
+	operands := len(values)
+	if c.Ref != "" {
+		operands = 1
+	}
+
+	switch c.Op {
+	case OpEq, OpNe, OpPrefix:
+		if operands != 1 {
+			return fmt.Errorf("%s: %s requires a single value", c.Attr, c.Op)
+		}
+	case OpGt, OpGte, OpLt, OpLte:
+		if operands != 1 {
+			return fmt.Errorf("%s: %s requires a single value", c.Attr, c.Op)
+		}
+		if c.Ref == "" {
+			if _, err := strconv.ParseFloat(values[0], 64); err != nil {
+				return fmt.Errorf("%s: %s requires a number", c.Attr, c.Op)
+			}
+		}
+	case OpIn, OpNotIn:
+		if c.Ref != "" || len(values) == 0 {
+			return fmt.Errorf("%s: %s requires a list of values", c.Attr, c.Op)
+		}
+	case OpBetween:
+		if c.Ref != "" || len(values) != 2 {
+			return fmt.Errorf("%s: between requires [min, max]", c.Attr)
+		}
+		for _, v := range values {
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				return fmt.Errorf("%s: between requires numbers", c.Attr)
+			}
+		}
+	case OpExists:
+		if operands != 0 {
+			return fmt.Errorf("%s: exists takes no value", c.Attr)
+		}
+	default:
+		return fmt.Errorf("%s: unknown operator %q", c.Attr, c.Op)
+	}
+
+	return nil
+}
+
+// validateAttr проверяет ссылку на атрибут вида "<namespace>.<name>".
+func validateAttr(attr string) error {
+	namespace, name, ok := strings.Cut(attr, ".")
+	if !ok || name == "" {
+		return fmt.Errorf("attribute %q must be <namespace>.<name>", attr)
+	}
+	switch namespace {
+	case NamespaceSubject, NamespaceResource, NamespaceContext:
+		return nil
+	}
+
+	return fmt.Errorf("attribute %q: unknown namespace %q", attr, namespace)
+}
+
+// normalizeValue приводит значение из JSON к списку строк: атрибуты
+// сравниваются как строки, а числовые операторы разбирают их как числа.
+func normalizeValue(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := scalar(item)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}
+
+	s, err := scalar(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{s}, nil
+}
+
+func scalar(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+
+	return "", fmt.Errorf("unsupported value %v", value)
+}
@@ -0,0 +1,68 @@
+package secret
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"math/big"
+	"strings"
+)
+
+// NumericCode генерирует случайный код из digits цифр, например для SMS или письма.
+func NumericCode(digits int) (string, error) {
+	var b strings.Builder
+	b.Grow(digits)
+
+	ten := big.NewInt(10)
+	for i := 0; i < digits; i++ {
+		n, err := rand.Int(rand.Reader, ten)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(byte('0' + n.Int64()))
+	}
+
+	return b.String(), nil
+}
+
+// Token генерирует случайную строку из size байт в base64url без выравнивания.
+func Token(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Hash возвращает SHA-256 от значения. Подходит для хранения высокоэнтропийных
+// токенов и короткоживущих кодов с ограничением числа попыток, но не паролей.
+func Hash(value string) []byte {
+	sum := sha256.Sum256([]byte(value))
+	return sum[:]
+}
+
+// Equal сравнивает хеши за постоянное время.
+func Equal(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// ValidKeyID сообщает, подходит ли id для ID ключа (pepper, мастер-ключ):
+// ID записывается в хеши и зашифрованные значения, поэтому допустимы только
+// латинские буквы, цифры, '-' и '_'.
+func ValidKeyID(id string) bool {
+	if id == "" {
+		return false
+	}
+
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,106 @@
+package webauthn
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Значения userVerification.
+const (
+	UVRequired    = "required"
+	UVPreferred   = "preferred"
+	UVDiscouraged = "discouraged"
+)
+
+// User — владелец регистрируемого ключа. Handle сохраняется в ключе и возвращается
+// при входе без указания логина, поэтому не должен содержать персональных данных.
+type User struct {
+	Handle      []byte
+	Name        string
+	DisplayName string
+}
+
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type creationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int64  `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout,omitempty"`
+	ExcludeCredentials     []credentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+type requestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout,omitempty"`
+	AllowCredentials []credentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CreationOptions формирует JSON PublicKeyCredentialCreationOptions для
+// navigator.credentials.create(). Ключи exclude уже зарегистрированы у пользователя.
+// Запрашивается discoverable credential, чтобы ключ подходил для входа без логина.
+func (rp RelyingParty) CreationOptions(challenge []byte, user User, exclude [][]byte, timeout time.Duration) ([]byte, error) {
+	var opts creationOptions
+
+	opts.Challenge = EncodeBase64(challenge)
+	opts.RP.ID = rp.ID
+	opts.RP.Name = rp.Name
+	opts.User.ID = EncodeBase64(user.Handle)
+	opts.User.Name = user.Name
+	opts.User.DisplayName = user.DisplayName
+	for _, alg := range SupportedAlgorithms {
+		opts.PubKeyCredParams = append(opts.PubKeyCredParams, struct {
+			Type string `json:"type"`
+			Alg  int64  `json:"alg"`
+		}{Type: "public-key", Alg: alg})
+	}
+	opts.Timeout = timeout.Milliseconds()
+	opts.ExcludeCredentials = descriptors(exclude)
+	opts.AuthenticatorSelection.ResidentKey = "preferred"
+	opts.AuthenticatorSelection.UserVerification = UVPreferred
+	opts.Attestation = "none"
+
+	return json.Marshal(opts)
+}
+
+// RequestOptions формирует JSON PublicKeyCredentialRequestOptions для
+// navigator.credentials.get(). Пустой allow разрешает любой discoverable ключ.
+func (rp RelyingParty) RequestOptions(challenge []byte, allow [][]byte, userVerification string, timeout time.Duration) ([]byte, error) {
+	return json.Marshal(requestOptions{
+		Challenge:        EncodeBase64(challenge),
+		RPID:             rp.ID,
+		Timeout:          timeout.Milliseconds(),
+		AllowCredentials: descriptors(allow),
+		UserVerification: userVerification,
+	})
+}
+
+func descriptors(ids [][]byte) []credentialDescriptor {
+	res := make([]credentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, credentialDescriptor{Type: "public-key", ID: EncodeBase64(id)})
+	}
+
+	return res
+}
@@ -0,0 +1,388 @@
+// Package webauthn реализует проверку церемоний регистрации и входа WebAuthn
+// (https://www.w3.org/TR/webauthn-2/) на стороне сервера.
+// Аттестация аутентификатора не проверяется: принимается любой формат, как при
+// attestation "none".
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ChallengeSize — размер challenge в байтах.
+const ChallengeSize = 32
+
+var (
+	ErrInvalidResponse   = errors.New("malformed webauthn response")
+	ErrChallengeMismatch = errors.New("webauthn challenge mismatch")
+	ErrOriginMismatch    = errors.New("webauthn origin not allowed")
+	ErrRPIDMismatch      = errors.New("webauthn rp id mismatch")
+	ErrUserNotPresent    = errors.New("webauthn user not present")
+	ErrUserNotVerified   = errors.New("webauthn user not verified")
+	// ErrCounterRegression — счетчик подписей не вырос. Это признак клонированного аутентификатора.
+	ErrCounterRegression = errors.New("webauthn sign counter did not increase")
+)
+
+// Флаги authenticator data.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+	flagExtensions   = 0x80
+)
+
+const (
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+)
+
+// RelyingParty — сервер, от имени которого регистрируются ключи.
+type RelyingParty struct {
+	// ID — домен, к которому привязаны ключи, например "example.com".
+	ID   string
+	Name string
+	// Origins — допустимые origin страниц, вызывающих WebAuthn API.
+	Origins []string
+}
+
+// Credential — зарегистрированный ключ.
+type Credential struct {
+	ID []byte
+	// PublicKey — открытый ключ в формате COSE_Key.
+	PublicKey    []byte
+	SignCount    uint32
+	UserVerified bool
+}
+
+// Assertion — результат проверки входа.
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+// NewChallenge генерирует случайный challenge.
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, ChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// RegistrationResponse — результат navigator.credentials.create().
+type RegistrationResponse struct {
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+// AssertionResponse — результат navigator.credentials.get().
+type AssertionResponse struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	UserHandle        []byte
+}
+
+// rawCredential — JSON-представление PublicKeyCredential (PublicKeyCredential.toJSON()).
+type rawCredential struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// ParseRegistrationResponse разбирает JSON ответа на регистрацию.
+func ParseRegistrationResponse(data []byte) (RegistrationResponse, error) {
+	var raw rawCredential
+	if err := json.Unmarshal(data, &raw); err != nil || raw.Type != "public-key" {
+		return RegistrationResponse{}, ErrInvalidResponse
+	}
+
+	var (
+		resp RegistrationResponse
+		err  error
+	)
+	if resp.ClientDataJSON, err = decodeBase64(raw.Response.ClientDataJSON); err != nil {
+		return RegistrationResponse{}, ErrInvalidResponse
+	}
+	if resp.AttestationObject, err = decodeBase64(raw.Response.AttestationObject); err != nil {
+		return RegistrationResponse{}, ErrInvalidResponse
+	}
+
+	return resp, nil
+}
+
+// ParseAssertionResponse разбирает JSON ответа на вход.
+func ParseAssertionResponse(data []byte) (AssertionResponse, error) {
+	var raw rawCredential
+	if err := json.Unmarshal(data, &raw); err != nil || raw.Type != "public-key" {
+		return AssertionResponse{}, ErrInvalidResponse
+	}
+
+	id := raw.RawID
+	if id == "" {
+		id = raw.ID
+	}
+
+	var (
+		resp AssertionResponse
+		err  error
+	)
+	if resp.CredentialID, err = decodeBase64(id); err != nil || len(resp.CredentialID) == 0 {
+		return AssertionResponse{}, ErrInvalidResponse
+	}
+	if resp.ClientDataJSON, err = decodeBase64(raw.Response.ClientDataJSON); err != nil {
+		return AssertionResponse{}, ErrInvalidResponse
+	}
+	if resp.AuthenticatorData, err = decodeBase64(raw.Response.AuthenticatorData); err != nil {
+		return AssertionResponse{}, ErrInvalidResponse
+	}
+	if resp.Signature, err = decodeBase64(raw.Response.Signature); err != nil {
+		return AssertionResponse{}, ErrInvalidResponse
+	}
+	if resp.UserHandle, err = decodeBase64(raw.Response.UserHandle); err != nil {
+		return AssertionResponse{}, ErrInvalidResponse
+	}
+
+	return resp, nil
+}
+
+// Challenge возвращает challenge, на который отвечает клиент. По нему сервер находит
+// сохраненную церемонию. Сам ответ при этом еще не проверен.
+func (r RegistrationResponse) Challenge() ([]byte, error) {
+	cd, err := parseClientData(r.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return cd.challenge, nil
+}
+
+// Challenge возвращает challenge, на который отвечает клиент.
+func (r AssertionResponse) Challenge() ([]byte, error) {
+	cd, err := parseClientData(r.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return cd.challenge, nil
+}
+
+// VerifyRegistration проверяет ответ на регистрацию и возвращает новый ключ.
+func (rp RelyingParty) VerifyRegistration(resp RegistrationResponse, challenge []byte, requireUV bool) (Credential, error) {
+	if err := rp.verifyClientData(resp.ClientDataJSON, ceremonyCreate, challenge); err != nil {
+		return Credential{}, err
+	}
+
+	decoded, rest, err := decodeCBOR(resp.AttestationObject)
+	if err != nil || len(rest) != 0 {
+		return Credential{}, ErrInvalidResponse
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return Credential{}, ErrInvalidResponse
+	}
+	authData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return Credential{}, ErrInvalidResponse
+	}
+
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return Credential{}, err
+	}
+	if err := rp.verifyAuthenticatorData(ad, requireUV); err != nil {
+		return Credential{}, err
+	}
+	if ad.credentialID == nil {
+		return Credential{}, ErrInvalidResponse
+	}
+	if _, _, err := parsePublicKey(ad.publicKey); err != nil {
+		return Credential{}, err
+	}
+
+	return Credential{
+		ID:           ad.credentialID,
+		PublicKey:    ad.publicKey,
+		SignCount:    ad.signCount,
+		UserVerified: ad.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// VerifyAssertion проверяет ответ на вход ключом publicKey. storedSignCount — значение
+// счетчика после предыдущего входа. Аутентификаторы без счетчика всегда присылают 0.
+func (rp RelyingParty) VerifyAssertion(resp AssertionResponse, challenge []byte, publicKey []byte, storedSignCount uint32, requireUV bool) (Assertion, error) {
+	if err := rp.verifyClientData(resp.ClientDataJSON, ceremonyGet, challenge); err != nil {
+		return Assertion{}, err
+	}
+
+	ad, err := parseAuthenticatorData(resp.AuthenticatorData)
+	if err != nil {
+		return Assertion{}, err
+	}
+	if err := rp.verifyAuthenticatorData(ad, requireUV); err != nil {
+		return Assertion{}, err
+	}
+
+	clientDataHash := sha256.Sum256(resp.ClientDataJSON)
+	signed := make([]byte, 0, len(resp.AuthenticatorData)+len(clientDataHash))
+	signed = append(signed, resp.AuthenticatorData...)
+	signed = append(signed, clientDataHash[:]...)
+
+	if err := verifySignature(publicKey, signed, resp.Signature); err != nil {
+		return Assertion{}, err
+	}
+
+	if (ad.signCount != 0 || storedSignCount != 0) && ad.signCount <= storedSignCount {
+		return Assertion{}, ErrCounterRegression
+	}
+
+	return Assertion{
+		SignCount:    ad.signCount,
+		UserVerified: ad.flags&flagUserVerified != 0,
+	}, nil
+}
+
+type clientData struct {
+	typ       string
+	challenge []byte
+	origin    string
+}
+
+func parseClientData(data []byte) (clientData, error) {
+	var raw struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return clientData{}, ErrInvalidResponse
+	}
+
+	challenge, err := decodeBase64(raw.Challenge)
+	if err != nil || len(challenge) == 0 {
+		return clientData{}, ErrInvalidResponse
+	}
+
+	return clientData{typ: raw.Type, challenge: challenge, origin: raw.Origin}, nil
+}
+
+func (rp RelyingParty) verifyClientData(data []byte, ceremony string, challenge []byte) error {
+	cd, err := parseClientData(data)
+	if err != nil {
+		return err
+	}
+
+	if cd.typ != ceremony {
+		return ErrInvalidResponse
+	}
+	if subtle.ConstantTimeCompare(cd.challenge, challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+
+	for _, origin := range rp.Origins {
+		if cd.origin == origin {
+			return nil
+		}
+	}
+
+	return ErrOriginMismatch
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthenticatorData разбирает authenticator data:
+// rpIdHash(32) | flags(1) | signCount(4) | [attestedCredentialData] | [extensions].
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	if len(data) < 37 {
+		return authenticatorData{}, ErrInvalidResponse
+	}
+
+	ad := authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if ad.flags&flagAttested != 0 {
+		// aaguid(16) | credentialIdLength(2) | credentialId | credentialPublicKey
+		if len(rest) < 18 {
+			return authenticatorData{}, ErrInvalidResponse
+		}
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+			return authenticatorData{}, ErrInvalidResponse
+		}
+		ad.credentialID = append([]byte(nil), rest[:idLen]...)
+		rest = rest[idLen:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return authenticatorData{}, ErrInvalidResponse
+		}
+		ad.publicKey = append([]byte(nil), rest[:len(rest)-len(after)]...)
+		rest = after
+	}
+
+	if ad.flags&flagExtensions != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return authenticatorData{}, ErrInvalidResponse
+		}
+		rest = after
+	}
+
+	if len(rest) != 0 {
+		return authenticatorData{}, ErrInvalidResponse
+	}
+
+	return ad, nil
+}
+
+func (rp RelyingParty) verifyAuthenticatorData(ad authenticatorData, requireUV bool) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.rpIDHash, rpIDHash[:]) {
+		return ErrRPIDMismatch
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+	if requireUV && ad.flags&flagUserVerified == 0 {
+		return ErrUserNotVerified
+	}
+
+	return nil
+}
+
+// decodeBase64 принимает base64url с дополнением и без, как его кодируют браузеры.
+func decodeBase64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// EncodeBase64 кодирует байты в base64url без дополнения.
+func EncodeBase64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,356 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+var testRP = RelyingParty{ID: testRPID, Name: "Example", Origins: []string{testOrigin}}
+
+// cborPair — пара ключ-значение словаря CBOR; порядок пар сохраняется при кодировании.
+type cborPair struct {
+	key   interface{}
+	value interface{}
+}
+
+// encodeCBOR кодирует подмножество CBOR, которое разбирает decodeCBOR.
+func encodeCBOR(v interface{}) []byte {
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case []cborPair:
+		out := cborHead(5, uint64(len(v)))
+		for _, p := range v {
+			out = append(out, encodeCBOR(p.key)...)
+			out = append(out, encodeCBOR(p.value)...)
+		}
+		return out
+	}
+
+	panic("unsupported cbor value")
+}
+
+func cborHead(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major<<5 | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+	}
+
+	return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(arg))
+}
+
+// authenticator — программный аутентификатор с ключом ES256.
+type authenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	rpID         string
+	origin       string
+	flags        byte
+}
+
+func newAuthenticator(t *testing.T) *authenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+
+	return &authenticator{
+		t:            t,
+		key:          key,
+		credentialID: id,
+		rpID:         testRPID,
+		origin:       testOrigin,
+		flags:        flagUserPresent | flagUserVerified,
+	}
+}
+
+func (a *authenticator) publicKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.PublicKey.X.FillBytes(x)
+	a.key.PublicKey.Y.FillBytes(y)
+
+	return encodeCBOR([]cborPair{
+		{coseKty, coseKtyEC2},
+		{coseAlg, int(AlgES256)},
+		{-1, coseCrvP256},
+		{-2, x},
+		{-3, y},
+	})
+}
+
+func (a *authenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": EncodeBase64(challenge),
+		"origin":    a.origin,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return data
+}
+
+func (a *authenticator) authData(flags byte, signCount uint32, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+
+	data := append([]byte(nil), rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, signCount)
+
+	return append(data, attested...)
+}
+
+// create возвращает JSON ответа navigator.credentials.create().
+func (a *authenticator) create(challenge []byte) []byte {
+	attested := make([]byte, 16) // aaguid
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, a.publicKey()...)
+
+	attestation := encodeCBOR([]cborPair{
+		{"fmt", "none"},
+		{"attStmt", []cborPair{}},
+		{"authData", a.authData(a.flags|flagAttested, 0, attested)},
+	})
+
+	return a.credentialJSON(map[string]string{
+		"clientDataJSON":    EncodeBase64(a.clientData(ceremonyCreate, challenge)),
+		"attestationObject": EncodeBase64(attestation),
+	})
+}
+
+// get возвращает JSON ответа navigator.credentials.get() со счетчиком signCount.
+func (a *authenticator) get(challenge []byte, signCount uint32) []byte {
+	clientDataJSON := a.clientData(ceremonyGet, challenge)
+	authData := a.authData(a.flags, signCount, nil)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.credentialJSON(map[string]string{
+		"clientDataJSON":    EncodeBase64(clientDataJSON),
+		"authenticatorData": EncodeBase64(authData),
+		"signature":         EncodeBase64(sig),
+	})
+}
+
+func (a *authenticator) credentialJSON(response map[string]string) []byte {
+	data, err := json.Marshal(map[string]interface{}{
+		"id":       EncodeBase64(a.credentialID),
+		"rawId":    EncodeBase64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return data
+}
+
+func newTestChallenge(t *testing.T) []byte {
+	t.Helper()
+
+	challenge, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return challenge
+}
+
+func register(t *testing.T, a *authenticator, challenge []byte, requireUV bool) (Credential, error) {
+	t.Helper()
+
+	resp, err := ParseRegistrationResponse(a.create(challenge))
+	if err != nil {
+		t.Fatalf("ParseRegistrationResponse: %v", err)
+	}
+
+	return testRP.VerifyRegistration(resp, challenge, requireUV)
+}
+
+func assert(t *testing.T, a *authenticator, challenge []byte, signCount uint32, cred Credential, requireUV bool) (Assertion, error) {
+	t.Helper()
+
+	resp, err := ParseAssertionResponse(a.get(challenge, signCount))
+	if err != nil {
+		t.Fatalf("ParseAssertionResponse: %v", err)
+	}
+
+	return testRP.VerifyAssertion(resp, challenge, cred.PublicKey, cred.SignCount, requireUV)
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	a := newAuthenticator(t)
+
+	challenge := newTestChallenge(t)
+	resp, err := ParseRegistrationResponse(a.create(challenge))
+	if err != nil {
+		t.Fatalf("ParseRegistrationResponse: %v", err)
+	}
+	got, err := resp.Challenge()
+	if err != nil || string(got) != string(challenge) {
+		t.Fatalf("Challenge() = %x, %v; want %x", got, err, challenge)
+	}
+
+	cred, err := testRP.VerifyRegistration(resp, challenge, true)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+	if string(cred.ID) != string(a.credentialID) {
+		t.Errorf("credential ID = %x, want %x", cred.ID, a.credentialID)
+	}
+	if !cred.UserVerified {
+		t.Error("UserVerified = false, want true")
+	}
+
+	res, err := assert(t, a, newTestChallenge(t), 1, cred, true)
+	if err != nil {
+		t.Fatalf("VerifyAssertion: %v", err)
+	}
+	if res.SignCount != 1 || !res.UserVerified {
+		t.Errorf("assertion = %+v, want SignCount 1 and UserVerified", res)
+	}
+}
+
+func TestVerifyAssertionSignCount(t *testing.T) {
+	a := newAuthenticator(t)
+
+	cred, err := register(t, a, newTestChallenge(t), false)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		stored    uint32
+		signCount uint32
+		wantErr   error
+	}{
+		{name: "increased", stored: 5, signCount: 6},
+		{name: "no counter", stored: 0, signCount: 0},
+		{name: "same", stored: 5, signCount: 5, wantErr: ErrCounterRegression},
+		{name: "decreased", stored: 5, signCount: 3, wantErr: ErrCounterRegression},
+		{name: "reset to zero", stored: 5, signCount: 0, wantErr: ErrCounterRegression},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cred := cred
+			cred.SignCount = tt.stored
+
+			_, err := assert(t, a, newTestChallenge(t), tt.signCount, cred, false)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyAssertion() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsInvalidResponses(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    func(a *authenticator)
+		requireUV bool
+		wantErr   error
+	}{
+		{name: "origin", modify: func(a *authenticator) { a.origin = "https://evil.example" }, wantErr: ErrOriginMismatch},
+		{name: "rp id", modify: func(a *authenticator) { a.rpID = "evil.example" }, wantErr: ErrRPIDMismatch},
+		{name: "user not present", modify: func(a *authenticator) { a.flags = 0 }, wantErr: ErrUserNotPresent},
+		{name: "user not verified", modify: func(a *authenticator) { a.flags = flagUserPresent }, requireUV: true, wantErr: ErrUserNotVerified},
+	}
+
+	for _, tt := range tests {
+		t.Run("registration/"+tt.name, func(t *testing.T) {
+			a := newAuthenticator(t)
+			tt.modify(a)
+
+			_, err := register(t, a, newTestChallenge(t), tt.requireUV)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyRegistration() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+
+		t.Run("assertion/"+tt.name, func(t *testing.T) {
+			a := newAuthenticator(t)
+			cred, err := register(t, a, newTestChallenge(t), false)
+			if err != nil {
+				t.Fatalf("VerifyRegistration: %v", err)
+			}
+			tt.modify(a)
+
+			_, err = assert(t, a, newTestChallenge(t), 1, cred, tt.requireUV)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyAssertion() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionRejectsChallengeAndKeyMismatch(t *testing.T) {
+	a := newAuthenticator(t)
+	cred, err := register(t, a, newTestChallenge(t), false)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+
+	resp, err := ParseAssertionResponse(a.get(newTestChallenge(t), 1))
+	if err != nil {
+		t.Fatalf("ParseAssertionResponse: %v", err)
+	}
+	if _, err := testRP.VerifyAssertion(resp, newTestChallenge(t), cred.PublicKey, 0, false); !errors.Is(err, ErrChallengeMismatch) {
+		t.Errorf("other challenge: error = %v, want %v", err, ErrChallengeMismatch)
+	}
+
+	challenge := newTestChallenge(t)
+	resp, err = ParseAssertionResponse(a.get(challenge, 1))
+	if err != nil {
+		t.Fatalf("ParseAssertionResponse: %v", err)
+	}
+	other := newAuthenticator(t)
+	if _, err := testRP.VerifyAssertion(resp, challenge, other.publicKey(), 0, false); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("other key: error = %v, want %v", err, ErrBadSignature)
+	}
+
+	resp.ClientDataJSON = a.clientData(ceremonyCreate, challenge)
+	if _, err := testRP.VerifyAssertion(resp, challenge, cred.PublicKey, 0, false); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("registration client data: error = %v, want %v", err, ErrInvalidResponse)
+	}
+}
@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 500
+	maxUserRoles        = 100
+)
+
+// AuthorizeAdmin проверяет, что access токен выдан администратору: разрешение
+// PermissionAdmin должно быть и в токене, и у пользователя сейчас. Токен,
+// выпущенный до назначения роли администратора, не подходит. Токен должен быть
+// выдан доверенному приложению client, которое выполняет вызов: иначе любое
+// приложение могло бы подписать своим секретом токен от имени администратора.
+func (a *Auth) AuthorizeAdmin(ctx context.Context, client models.App, accessToken string) (int64, error) {
+	const op = "Auth.AuthorizeAdmin"
+
+	claims, err := a.authenticateClaims(ctx, accessToken)
+	if err != nil {
+		return 0, err
+	}
+	if !client.Trusted || claims.appID != client.ID {
+		a.log.Warn("admin token rejected for client",
+			"op", op, "userID", claims.userID, "tokenAppID", claims.appID, "clientAppID", client.ID)
+		return 0, ErrPermissionDenied
+	}
+	if !slices.Contains(claims.grants.Permissions, PermissionAdmin) {
+		return 0, ErrPermissionDenied
+	}
+
+	return a.requireAdmin(ctx, accessToken)
+}
+
+// ListUsers возвращает страницу пользователей, подходящих под filter, в порядке
+// ID и токен следующей страницы (пустой на последней). Доступно только администраторам.
+func (a *Auth) ListUsers(ctx context.Context, accessToken string, filter models.UserFilter, pageToken string, pageSize int) ([]models.User, string, error) {
+	const op = "Auth.ListUsers"
+
+	if _, err := a.requireAdmin(ctx, accessToken); err != nil {
+		return nil, "", err
+	}
+
+	filter.EmailPrefix = strings.TrimSpace(filter.EmailPrefix)
+
+	verr := &ValidationError{}
+	afterID, err := decodeUserPageToken(pageToken)
+	if err != nil {
+		verr.Violations = append(verr.Violations, FieldViolation{Field: "page_token", Description: "is invalid"})
+	}
+	if pageSize < 0 || pageSize > maxUserPageSize {
+		verr.Violations = append(verr.Violations, FieldViolation{
+			Field:       "page_size",
+			Description: fmt.Sprintf("must be between 0 and %d", maxUserPageSize),
+		})
+	}
+	switch filter.Status {
+	case "", models.UserActive, models.UserDisabled, models.UserSuspended, models.UserPendingApproval:
+	default:
+		verr.Violations = append(verr.Violations, FieldViolation{Field: "status", Description: "must be one of active, disabled, suspended, pending_approval"})
+	}
+	if !filter.CreatedAfter.IsZero() && !filter.CreatedBefore.IsZero() && !filter.CreatedBefore.After(filter.CreatedAfter) {
+		verr.Violations = append(verr.Violations, FieldViolation{Field: "created_before", Description: "must be after created_after"})
+	}
+	if len(verr.Violations) > 0 {
+		return nil, "", verr
+	}
+
+	if pageSize == 0 {
+		pageSize = defaultUserPageSize
+	}
+
+	// Лишняя запись показывает, есть ли следующая страница
+	users, err := a.usrProvider.ListUsers(ctx, filter, afterID, pageSize+1)
+	if err != nil {
+		a.log.Error("failed to list users", "op", op, "error", err)
+		return nil, "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	var next string
+	if len(users) > pageSize {
+		users = users[:pageSize]
+		next = encodeUserPageToken(users[len(users)-1].ID)
+	}
+
+	return users, next, nil
+}
+
+// GetUser возвращает пользователя по ID. Доступно только администраторам.
+func (a *Auth) GetUser(ctx context.Context, accessToken string, userID int64) (models.User, error) {
+	const op = "Auth.GetUser"
+
+	if _, err := a.requireAdmin(ctx, accessToken); err != nil {
+		return models.User{}, err
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.User{}, storage.ErrUserNotFound
+		}
+		return models.User{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return user, nil
+}
+
+// SetRoles заменяет роли пользователя в приложении appID (0 — глобальные роли)
+// на roleIDs и возвращает роли, действующие в приложении. Доступно только администраторам.
+func (a *Auth) SetRoles(ctx context.Context, accessToken string, userID int64, appID int, roleIDs []int64) ([]models.Role, error) {
+	const op = "Auth.SetRoles"
+
+	log := a.log.With(
+		"op", op,
+		"userID", userID,
+		"appID", appID,
+	)
+
+	adminID, err := a.requireAdmin(ctx, accessToken)
+	if err != nil {
+		log.Warn("roles change denied", "error", err)
+		return nil, err
+	}
+
+	roleIDs = slices.Clone(roleIDs)
+	slices.Sort(roleIDs)
+	roleIDs = slices.Compact(roleIDs)
+
+	if len(roleIDs) > maxUserRoles {
+		return nil, &ValidationError{Violations: []FieldViolation{{
+			Field:       "role_ids",
+			Description: fmt.Sprintf("must contain at most %d roles", maxUserRoles),
+		}}}
+	}
+
+	// Администратор не может снять с себя роль администратора
+	if adminID == userID && appID == 0 {
+		keepsAdmin := false
+		for _, id := range roleIDs {
+			role, err := a.roleStorage.Role(ctx, id)
+			if err != nil {
+				if errors.Is(err, storage.ErrRoleNotFound) {
+					return nil, ErrRoleNotFound
+				}
+				return nil, fmt.Errorf("%s: %v", op, err)
+			}
+			if role.Global() && slices.Contains(role.Permissions, PermissionAdmin) {
+				keepsAdmin = true
+			}
+		}
+		if !keepsAdmin {
+			return nil, &ValidationError{Violations: []FieldViolation{{Field: "user_id", Description: "admins cannot revoke their own admin role"}}}
+		}
+	}
+
+	if err := a.roleStorage.SetUserRoles(ctx, userID, appID, roleIDs); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotFound):
+			return nil, storage.ErrUserNotFound
+		case errors.Is(err, storage.ErrRoleNotFound):
+			return nil, ErrRoleNotFound
+		}
+		log.Error("failed to set user roles", "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	roles, err := a.roleStorage.UserRoles(ctx, userID, appID)
+	if err != nil {
+		log.Error("failed to list user roles", "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("user roles replaced", "roles", len(roleIDs), "adminID", adminID)
+	return roles, nil
+}
+
+// ResetMFA удаляет все вторые факторы пользователя, потерявшего доступ к ним:
+// TOTP, коды восстановления, ключи WebAuthn и доверенные устройства. Доступно
+// только администраторам.
+func (a *Auth) ResetMFA(ctx context.Context, accessToken string, userID int64) error {
+	const op = "Auth.ResetMFA"
+
+	log := a.log.With(
+		"op", op,
+		"userID", userID,
+	)
+
+	adminID, err := a.requireAdmin(ctx, accessToken)
+	if err != nil {
+		log.Warn("MFA reset denied", "error", err)
+		return err
+	}
+
+	if err := a.mfaStorage.ResetMFA(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return storage.ErrUserNotFound
+		}
+		log.Error("failed to reset MFA", "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("MFA reset", "adminID", adminID)
+	return nil
+}
+
+// ForceLogout завершает сессии пользователя: refresh токен и доверенные
+// устройства перестают действовать. Выданные access токены действуют до
+// истечения срока. Доступно только администраторам.
+func (a *Auth) ForceLogout(ctx context.Context, accessToken string, userID int64) error {
+	const op = "Auth.ForceLogout"
+
+	log := a.log.With(
+		"op", op,
+		"userID", userID,
+	)
+
+	adminID, err := a.requireAdmin(ctx, accessToken)
+	if err != nil {
+		log.Warn("force logout denied", "error", err)
+		return err
+	}
+
+	if _, err := a.usrProvider.UserByID(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return storage.ErrUserNotFound
+		}
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := a.usrSaver.SaveRefreshToken(ctx, userID, ""); err != nil {
+		log.Error("failed to revoke refresh token", "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if err := a.deviceStorage.DeleteTrustedDevices(ctx, userID); err != nil {
+		log.Error("failed to revoke trusted devices", "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("user logged out by admin", "adminID", adminID)
+	return nil
+}
+
+func encodeUserPageToken(lastID int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(lastID, 10)))
+}
+
+func decodeUserPageToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id < 0 {
+		return 0, errors.New("invalid page token")
+	}
+
+	return id, nil
+}
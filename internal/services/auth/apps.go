@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/secret"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+const (
+	// appSecretSize — длина секрета приложения в байтах. Секрет — ключ HMAC
+	// для токенов приложения, поэтому он генерируется только сервером.
+	appSecretSize    = 32
+	maxAppNameLength = 255
+)
+
+var (
+	ErrAppExists = errors.New("app already exists")
+)
+
+// AppUpdate — изменения приложения; nil поля не меняются.
+type AppUpdate struct {
+	Name    *string
+	Trusted *bool
+}
+
+// CreateApp регистрирует приложение и генерирует ему секрет. Секрет
+// возвращается только здесь и в RotateAppSecret. Доступно только администраторам.
+func (a *Auth) CreateApp(ctx context.Context, accessToken string, app models.App) (models.App, error) {
+	const op = "Auth.CreateApp"
+
+	log := a.log.With(
+		"op", op,
+		"name", app.Name,
+	)
+
+	adminID, err := a.requireAdmin(ctx, accessToken)
+	if err != nil {
+		log.Warn("app creation denied", "error", err)
+		return models.App{}, err
+	}
+
+	app.Name = strings.TrimSpace(app.Name)
+	if err := validateAppName(app.Name); err != nil {
+		return models.App{}, err
+	}
+
+	app.Secret, err = secret.Token(appSecretSize)
+	if err != nil {
+		log.Error("failed to generate app secret", "error", err)
+		return models.App{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	app, err = a.appStorage.CreateApp(ctx, app)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppExists) {
+			log.Warn("app already exists")
+			return models.App{}, ErrAppExists
+		}
+		log.Error("failed to create app", "error", err)
+		return models.App{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("app created", "appID", app.ID, "trusted", app.Trusted, "adminID", adminID)
+	return app, nil
+}
+
+// GetApp возвращает приложение без секрета. Доступно только администраторам.
+func (a *Auth) GetApp(ctx context.Context, accessToken string, appID int) (models.App, error) {
+	const op = "Auth.GetApp"
+
+	if _, err := a.requireAdmin(ctx, accessToken); err != nil {
+		return models.App{}, err
+	}
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.App{}, storage.ErrAppNotFound
+		}
+		return models.App{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	app.Secret = ""
+	return app, nil
+}
+
+// ListApps возвращает все приложения без секретов. Доступно только администраторам.
+func (a *Auth) ListApps(ctx context.Context, accessToken string) ([]models.App, error) {
+	const op = "Auth.ListApps"
+
+	if _, err := a.requireAdmin(ctx, accessToken); err != nil {
+		return nil, err
+	}
+
+	apps, err := a.appStorage.Apps(ctx)
+	if err != nil {
+		a.log.Error("failed to list apps", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return apps, nil
+}
+
+// UpdateApp меняет название и настройки приложения и возвращает его без
+// секрета. Доступно только администраторам.
+func (a *Auth) UpdateApp(ctx context.Context, accessToken string, appID int, update AppUpdate) (models.App, error) {
+	const op = "Auth.UpdateApp"
+
+	log := a.log.With(
+		"op", op,
+		"appID", appID,
+	)
+
+	adminID, err := a.requireAdmin(ctx, accessToken)
+	if err != nil {
+		log.Warn("app update denied", "error", err)
+		return models.App{}, err
+	}
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.App{}, storage.ErrAppNotFound
+		}
+		return models.App{}, fmt.Errorf("%s: %v", op, err)
+	}
+	app.Secret = ""
+
+	if update.Name != nil {
+		app.Name = strings.TrimSpace(*update.Name)
+		if err := validateAppName(app.Name); err != nil {
+			return models.App{}, err
+		}
+	}
+	if update.Trusted != nil {
+		app.Trusted = *update.Trusted
+	}
+
+	if err := a.appStorage.UpdateApp(ctx, app); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrAppExists):
+			return models.App{}, ErrAppExists
+		case errors.Is(err, storage.ErrAppNotFound):
+			return models.App{}, storage.ErrAppNotFound
+		}
+		log.Error("failed to update app", "error", err)
+		return models.App{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("app updated", "trusted", app.Trusted, "adminID", adminID)
+	return app, nil
+}
+
+// DeleteApp удаляет приложение вместе с его ролями, scope, политиками и
+// приглашениями. Доступно только администраторам.
+func (a *Auth) DeleteApp(ctx context.Context, accessToken string, appID int) error {
+	const op = "Auth.DeleteApp"
+
+	log := a.log.With(
+		"op", op,
+		"appID", appID,
+	)
+
+	adminID, err := a.requireAdmin(ctx, accessToken)
+	if err != nil {
+		log.Warn("app deletion denied", "error", err)
+		return err
+	}
+
+	if err := a.appStorage.DeleteApp(ctx, appID); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return storage.ErrAppNotFound
+		}
+		log.Error("failed to delete app", "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("app deleted", "adminID", adminID)
+	return nil
+}
+
+// RotateAppSecret генерирует приложению новый секрет и возвращает его.
+// Токены, подписанные старым секретом, перестают проходить проверку.
+// Доступно только администраторам.
+func (a *Auth) RotateAppSecret(ctx context.Context, accessToken string, appID int) (string, error) {
+	const op = "Auth.RotateAppSecret"
+
+	log := a.log.With(
+		"op", op,
+		"appID", appID,
+	)
+
+	adminID, err := a.requireAdmin(ctx, accessToken)
+	if err != nil {
+		log.Warn("app secret rotation denied", "error", err)
+		return "", err
+	}
+
+	appSecret, err := secret.Token(appSecretSize)
+	if err != nil {
+		log.Error("failed to generate app secret", "error", err)
+		return "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := a.appStorage.SetAppSecret(ctx, appID, appSecret); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return "", storage.ErrAppNotFound
+		}
+		log.Error("failed to save app secret", "error", err)
+		return "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("app secret rotated", "adminID", adminID)
+	return appSecret, nil
+}
+
+func validateAppName(name string) error {
+	if name == "" || utf8.RuneCountInString(name) > maxAppNameLength {
+		return &ValidationError{Violations: []FieldViolation{{
+			Field:       "name",
+			Description: fmt.Sprintf("must be 1-%d characters long", maxAppNameLength),
+		}}}
+	}
+
+	return nil
+}
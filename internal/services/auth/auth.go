@@ -5,75 +5,362 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	emailaddr "github.com/1abobik1/Single-Sign-On/internal/lib/email"
 	jwt "github.com/1abobik1/Single-Sign-On/internal/lib/jwt"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/notify"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/password"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/secret"
 	"github.com/1abobik1/Single-Sign-On/internal/storage"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrAccountLocked      = errors.New("account temporarily locked")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrPermissionDenied   = errors.New("permission denied")
+	ErrValidation         = errors.New("validation failed")
 )
 
+// FieldViolation описывает нарушение требований к одному полю запроса.
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// ValidationError содержит все нарушения, найденные при проверке запроса.
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, v.Field+" "+v.Description)
+	}
+
+	return fmt.Sprintf("%v: %s", ErrValidation, strings.Join(parts, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// LockedError возвращается, когда вход заблокирован после серии неудачных попыток.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%v: retry after %s", ErrAccountLocked, e.RetryAfter)
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrAccountLocked
+}
+
+// LockoutPolicy задает порог блокировки и экспоненциальную задержку между блокировками.
+type LockoutPolicy struct {
+	MaxAttempts  int
+	BaseDuration time.Duration
+	MaxDuration  time.Duration
+}
+
+// duration возвращает длительность блокировки с учетом числа предыдущих блокировок.
+func (p LockoutPolicy) duration(lockoutCount int) time.Duration {
+	d := p.BaseDuration
+	for i := 0; i < lockoutCount && d < p.MaxDuration; i++ {
+		d *= 2
+	}
+	if p.MaxDuration > 0 && d > p.MaxDuration {
+		d = p.MaxDuration
+	}
+
+	return d
+}
+
 type UserSaver interface {
 	SaveUser(ctx context.Context, email string, passHash []byte) (user_id int64, err error)
 	SaveRefreshToken(ctx context.Context, userID int64, refreshToken string) (err error)
+	UpdateProfile(ctx context.Context, userID int64, profile models.Profile) (models.User, error)
+	UpdatePasswordHash(ctx context.Context, userID int64, passHash []byte) error
+	SetUserStatus(ctx context.Context, userID int64, status models.UserStatus, suspendedUntil time.Time, reason string) (models.User, error)
+	SetUserAttributes(ctx context.Context, userID int64, attributes map[string]string) (models.User, error)
+}
+
+type PasswordHasher interface {
+	Hash(password string) ([]byte, error)
+	Verify(hash []byte, password string) (needsRehash bool, err error)
 }
 
 type UserProvider interface {
 	User(ctx context.Context, email string) (models.User, error)
-	IsAdmin(ctx context.Context, userID int64) (bool, error)
+	UserByID(ctx context.Context, userID int64) (models.User, error)
+	ListUsers(ctx context.Context, filter models.UserFilter, afterID int64, limit int) ([]models.User, error)
+}
+
+type IdentifierStorage interface {
+	Identifier(ctx context.Context, kind models.IdentifierKind, value string) (models.Identifier, error)
+	Identifiers(ctx context.Context, userID int64) ([]models.Identifier, error)
+	SaveIdentifier(ctx context.Context, ident models.Identifier, codeHash []byte, expiresAt time.Time) (int64, error)
+	SetIdentifierCode(ctx context.Context, userID int64, kind models.IdentifierKind, codeHash []byte, expiresAt time.Time) error
+	CountIdentifierCodeSends(ctx context.Context, userID int64, kind models.IdentifierKind, value string, since time.Time) (byUser int, byValue int, err error)
+	ConfirmIdentifier(ctx context.Context, userID int64, kind models.IdentifierKind, codeHash []byte, maxAttempts int) (bool, error)
+	DeleteIdentifier(ctx context.Context, userID int64, kind models.IdentifierKind) error
+}
+
+type MFAStorage interface {
+	SaveTOTPSecret(ctx context.Context, userID int64, secret string) error
+	TOTP(ctx context.Context, userID int64) (models.TOTP, error)
+	UseTOTPStep(ctx context.Context, userID int64, step int64) (bool, error)
+	DeleteTOTP(ctx context.Context, userID int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes [][]byte) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash []byte) (ok bool, remaining int, err error)
+	ResetMFA(ctx context.Context, userID int64) error
+}
+
+type WebAuthnStorage interface {
+	SaveWebAuthnChallenge(ctx context.Context, challenge models.WebAuthnChallenge) error
+	ConsumeWebAuthnChallenge(ctx context.Context, challenge []byte, kind string) (models.WebAuthnChallenge, error)
+	SaveWebAuthnCredential(ctx context.Context, cred models.WebAuthnCredential) (int64, error)
+	WebAuthnCredential(ctx context.Context, credentialID []byte) (models.WebAuthnCredential, error)
+	WebAuthnCredentials(ctx context.Context, userID int64) ([]models.WebAuthnCredential, error)
+	UpdateWebAuthnSignCount(ctx context.Context, id int64, signCount uint32) (bool, error)
+	DeleteWebAuthnCredential(ctx context.Context, userID int64, id int64) error
+}
+
+type PasswordlessStorage interface {
+	SavePasswordlessLogin(ctx context.Context, login models.PasswordlessLogin, codeHash []byte) error
+	CountPasswordlessLogins(ctx context.Context, userID int64, since time.Time) (int, error)
+	ConsumePasswordlessLogin(ctx context.Context, id string, codeHash []byte, maxAttempts int) (models.PasswordlessLogin, bool, error)
+}
+
+type DeviceStorage interface {
+	SaveTrustedDevice(ctx context.Context, device models.TrustedDevice, tokenHash []byte) (int64, error)
+	UseTrustedDevice(ctx context.Context, userID int64, tokenHash []byte) (bool, error)
+	TrustedDevices(ctx context.Context, userID int64) ([]models.TrustedDevice, error)
+	DeleteTrustedDevice(ctx context.Context, userID int64, id int64) error
+	DeleteTrustedDevices(ctx context.Context, userID int64) error
+}
+
+type RoleStorage interface {
+	CreateRole(ctx context.Context, role models.Role) (models.Role, error)
+	DeleteRole(ctx context.Context, roleID int64) error
+	Role(ctx context.Context, roleID int64) (models.Role, error)
+	Roles(ctx context.Context, appID int) ([]models.Role, error)
+	AssignRole(ctx context.Context, userID int64, roleID int64) error
+	UnassignRole(ctx context.Context, userID int64, roleID int64) error
+	UserRoles(ctx context.Context, userID int64, appID int) ([]models.Role, error)
+	SetUserRoles(ctx context.Context, userID int64, appID int, roleIDs []int64) error
+	HasPermission(ctx context.Context, userID int64, appID int, permissions ...string) (bool, error)
+}
+
+type ScopeStorage interface {
+	DefineScope(ctx context.Context, scope models.Scope) (models.Scope, error)
+	DeleteScope(ctx context.Context, appID int, name string) error
+	Scopes(ctx context.Context, appID int) ([]models.Scope, error)
+	ScopesByName(ctx context.Context, names []string) ([]models.Scope, error)
+	SetAllowedScopes(ctx context.Context, appID int, scopeIDs []int64) error
+	AllowedScopes(ctx context.Context, appID int) ([]models.Scope, error)
+}
+
+type OrgStorage interface {
+	CreateOrganization(ctx context.Context, org models.Organization, ownerID int64) (models.Organization, error)
+	Organization(ctx context.Context, orgID int64) (models.Organization, error)
+	OrgMember(ctx context.Context, orgID int64, userID int64) (models.OrgMember, error)
+	OrgMembers(ctx context.Context, orgID int64) ([]models.OrgMember, error)
+	UserOrganizations(ctx context.Context, userID int64) ([]models.Membership, error)
+	AddOrgMember(ctx context.Context, orgID int64, userID int64, role models.OrgRole) error
+	UpdateOrgMemberRole(ctx context.Context, orgID int64, userID int64, role models.OrgRole) error
+	RemoveOrgMember(ctx context.Context, orgID int64, userID int64) error
+}
+
+type InvitationStorage interface {
+	SaveInvitation(ctx context.Context, inv models.Invitation) (models.Invitation, error)
+	Invitation(ctx context.Context, id string) (models.Invitation, error)
+	Invitations(ctx context.Context, orgID int64) ([]models.Invitation, error)
+	DeleteInvitation(ctx context.Context, orgID int64, id string) error
+	AcceptInvitation(ctx context.Context, id string, userID int64) (models.Invitation, error)
+}
+
+type PolicyStorage interface {
+	SavePolicy(ctx context.Context, p models.Policy) (models.Policy, error)
+	DeletePolicy(ctx context.Context, appID int, name string) error
+	Policies(ctx context.Context, appID int) ([]models.Policy, error)
+}
+
+type LoginAttemptsTracker interface {
+	ReserveLoginAttempt(ctx context.Context, userID int64, maxAttempts int) (attempts int, reserved bool, err error)
+	IncrementFailedLogins(ctx context.Context, userID int64) (attempts int, err error)
+	LockUser(ctx context.Context, userID int64, until time.Time) error
+	ResetLoginAttempts(ctx context.Context, userID int64) error
 }
 
 type AppProvider interface {
 	App(ctx context.Context, appID int) (models.App, error)
 }
 
+type AppStorage interface {
+	CreateApp(ctx context.Context, app models.App) (models.App, error)
+	Apps(ctx context.Context) ([]models.App, error)
+	UpdateApp(ctx context.Context, app models.App) error
+	SetAppSecret(ctx context.Context, appID int, secret string) error
+	DeleteApp(ctx context.Context, appID int) error
+}
+
 type Auth struct {
-	usrSaver        UserSaver
-	usrProvider     UserProvider
-	appProvider     AppProvider
-	log             *slog.Logger
-	AcessTokenTTL   time.Duration
-	RefreshTokenTTL time.Duration
+	usrSaver            UserSaver
+	usrProvider         UserProvider
+	appProvider         AppProvider
+	appStorage          AppStorage
+	loginAttempts       LoginAttemptsTracker
+	identifiers         IdentifierStorage
+	mfaStorage          MFAStorage
+	webAuthnStorage     WebAuthnStorage
+	passwordlessStorage PasswordlessStorage
+	deviceStorage       DeviceStorage
+	roleStorage         RoleStorage
+	scopeStorage        ScopeStorage
+	orgStorage          OrgStorage
+	invitationStorage   InvitationStorage
+	policyStorage       PolicyStorage
+	sender              notify.Sender
+	log                 *slog.Logger
+	AcessTokenTTL       time.Duration
+	RefreshTokenTTL     time.Duration
+	lockout             LockoutPolicy
+	passwordPolicy      *password.Policy
+	hasher              PasswordHasher
+	mfa                 MFAPolicy
+	webAuthn            WebAuthnPolicy
+	passwordless        PasswordlessPolicy
+	authorization       AuthorizationPolicy
+	invitation          InvitationPolicy
+	clientAuth          ClientAuthPolicy
 }
 
 type Storage interface {
 	UserSaver
 	UserProvider
 	AppProvider
+	AppStorage
+	LoginAttemptsTracker
+	IdentifierStorage
+	MFAStorage
+	WebAuthnStorage
+	PasswordlessStorage
+	DeviceStorage
+	RoleStorage
+	ScopeStorage
+	OrgStorage
+	InvitationStorage
+	PolicyStorage
+}
+
+// Deps — хранилище и подключаемые компоненты сервиса.
+type Deps struct {
+	Storage        Storage
+	PasswordPolicy *password.Policy
+	Hasher         PasswordHasher
+	Sender         notify.Sender
+}
+
+// Config — сроки жизни токенов и политики сервиса.
+type Config struct {
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	Lockout         LockoutPolicy
+	MFA             MFAPolicy
+	WebAuthn        WebAuthnPolicy
+	Passwordless    PasswordlessPolicy
+	Authorization   AuthorizationPolicy
+	Invitation      InvitationPolicy
+	ClientAuth      ClientAuthPolicy
 }
 
-func New(
-	log *slog.Logger,
-	storage Storage,
-	AcessTokenTTL time.Duration,
-	RefreshTokenTTL time.Duration,
-) *Auth {
+func New(log *slog.Logger, deps Deps, cfg Config) *Auth {
 	return &Auth{
-		usrSaver:        storage,
-		usrProvider:     storage,
-		appProvider:     storage,
-		log:             log,
-		AcessTokenTTL:   AcessTokenTTL,
-		RefreshTokenTTL: RefreshTokenTTL,
+		usrSaver:            deps.Storage,
+		usrProvider:         deps.Storage,
+		appProvider:         deps.Storage,
+		appStorage:          deps.Storage,
+		loginAttempts:       deps.Storage,
+		identifiers:         deps.Storage,
+		mfaStorage:          deps.Storage,
+		webAuthnStorage:     deps.Storage,
+		passwordlessStorage: deps.Storage,
+		deviceStorage:       deps.Storage,
+		roleStorage:         deps.Storage,
+		scopeStorage:        deps.Storage,
+		orgStorage:          deps.Storage,
+		invitationStorage:   deps.Storage,
+		policyStorage:       deps.Storage,
+		sender:              deps.Sender,
+		log:                 log,
+		AcessTokenTTL:       cfg.AccessTokenTTL,
+		RefreshTokenTTL:     cfg.RefreshTokenTTL,
+		lockout:             cfg.Lockout,
+		passwordPolicy:      deps.PasswordPolicy,
+		hasher:              deps.Hasher,
+		mfa:                 cfg.MFA,
+		webAuthn:            cfg.WebAuthn,
+		passwordless:        cfg.Passwordless,
+		authorization:       cfg.Authorization,
+		invitation:          cfg.Invitation,
+		clientAuth:          cfg.ClientAuth,
 	}
 }
 
-func (a *Auth) Login(ctx context.Context, email string, password string, appID int) (string, string, error) {
+// Login аутентифицирует пользователя по паролю. login — email, имя пользователя
+// или подтвержденный номер телефона. req — требования приложения к уровню
+// аутентификации: если пароля недостаточно, запрашивается второй фактор.
+// deviceToken — токен доверенного устройства из TrustDevice, может быть пустым.
+func (a *Auth) Login(ctx context.Context, login string, pass string, appID int, req AuthRequirements, deviceToken string) (string, string, error) {
 	const op = "Auth.Login"
 
+	if err := req.validate(); err != nil {
+		return "", "", err
+	}
+
 	a.log.With(
 		"op", op,
-		"email", email,
+		"login", login,
 	).Info("attempting to log in user")
 
+	// Получение информации о приложении
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			a.log.Warn("app not found", "error", err)
+			return "", "", storage.ErrAppNotFound
+		}
+		a.log.Error("failed to retrieve app", "error", err)
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	// Запрошенные scope проверяются до пароля: отказ не должен расходовать попытки входа
+	scope, err := a.grantScope(ctx, app.ID, req.Scope)
+	if err != nil {
+		var scopeErr *ScopeError
+		if errors.As(err, &scopeErr) {
+			a.log.Warn("requested scope not allowed", "denied", scopeErr.Denied)
+			return "", "", err
+		}
+		a.log.Error("failed to check requested scope", "error", err)
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
 	// Проверка наличия пользователя
-	user, err := a.usrProvider.User(ctx, email)
+	user, err := a.userByLogin(ctx, login, app)
 	if err != nil {
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			a.log.Warn("invalid login identifier")
+			return "", "", err
+		}
 		if errors.Is(err, storage.ErrUserNotFound) {
 			a.log.Warn("user not found")
 			return "", "", storage.ErrUserNotFound
@@ -82,61 +369,111 @@ func (a *Auth) Login(ctx context.Context, email string, password string, appID i
 		return "", "", fmt.Errorf("%s: %v", op, err)
 	}
 
-	// Проверка пароля
-	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)); err != nil {
-		a.log.Warn("invalid password")
-		return "", "", ErrInvalidCredentials
+	// Проверка блокировки
+	if now := time.Now(); user.LockedUntil.After(now) {
+		a.log.Warn("account is locked", "lockedUntil", user.LockedUntil)
+		return "", "", &LockedError{RetryAfter: user.LockedUntil.Sub(now)}
 	}
 
-	// Получение информации о приложении
-	app, err := a.appProvider.App(ctx, appID)
+	// Попытка учитывается до медленной проверки пароля: параллельные запросы
+	// не проверят больше паролей, чем позволяет порог блокировки
+	attempts, err := a.reserveLoginAttempt(ctx, user)
 	if err != nil {
-		if errors.Is(err, storage.ErrAppNotFound) {
-			a.log.Warn("app not found", "error", err)
-			return "", "", storage.ErrAppNotFound
-		}
-		a.log.Error("failed to retrieve app", "error", err)
-		return "", "", fmt.Errorf("%s: %v", op, err)
+		return "", "", err
 	}
 
-	// Генерация нового access токена
-	accessToken, err := jwt.NewAccessToken(user, app, a.AcessTokenTTL)
+	// Проверка пароля
+	needsRehash, err := a.hasher.Verify(user.PassHash, pass)
 	if err != nil {
-		a.log.Error("failed to generate JWT", "error", err)
-		return "", "", fmt.Errorf("%s: %v", op, err)
+		if !errors.Is(err, password.ErrMismatch) {
+			a.log.Error("failed to verify password", "error", err)
+		}
+		a.log.Warn("invalid password")
+		return "", "", a.lockAfterFailedLogins(ctx, user, attempts)
 	}
 
-	// Проверка существования refresh токена
-	refreshToken := user.RefreshToken
-	if refreshToken == "" {
-		// Если токен отсутствует, создаем новый refresh токен
-		refreshToken, err = jwt.NewRefreshToken(user, app, 30*24*time.Hour) // Установите срок жизни refresh токена, например, 30 дней
-		if err != nil {
-			a.log.Error("failed to generate refresh token", "error", err)
-			return "", "", fmt.Errorf("%s: %v", op, err)
-		}
-		// Сохраняем refresh токен в базе данных
-		if err := a.usrSaver.SaveRefreshToken(ctx, user.ID, refreshToken); err != nil {
-			a.log.Error("failed to save refresh token", "error", err)
+	// Хеш построен устаревшим алгоритмом или параметрами: пересчитываем его, пока пароль известен
+	if needsRehash {
+		a.rehashPassword(ctx, user.ID, pass)
+	}
+
+	if attempts > 0 || user.FailedLoginAttempts > 0 || user.LockoutCount > 0 {
+		if err := a.loginAttempts.ResetLoginAttempts(ctx, user.ID); err != nil {
+			a.log.Error("failed to reset login attempts", "error", err)
 			return "", "", fmt.Errorf("%s: %v", op, err)
 		}
 	}
 
+	// Проверка статуса аккаунта
+	if err := checkStatus(user); err != nil {
+		a.log.Warn("login rejected by account status", "status", user.Status)
+		return "", "", err
+	}
+
+	authInfo := newAuthInfo(amrPassword)
+	authInfo.Scope = scope
+
+	// Если подключен второй фактор, вместо токенов выдаем токен MFA-проверки.
+	// С доверенного устройства он не запрашивается, если его не требует приложение
+	if a.isTrustedDevice(ctx, user.ID, deviceToken) && req.satisfiedBy(authInfo.ACR) {
+		a.log.Info("mfa skipped for trusted device")
+	} else if err := a.requireMFA(ctx, user, app, authInfo, req); err != nil {
+		return "", "", err
+	}
+
+	accessToken, refreshToken, err := a.issueTokens(ctx, user, app, authInfo)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
 	a.log.Info("user logged in successfully")
 	return accessToken, refreshToken, nil
 }
 
-func (a *Auth) RegisterNewUser(ctx context.Context, email string, pass string, appID int) (string, string, error) {
+func (a *Auth) RegisterNewUser(ctx context.Context, email string, pass string, appID int) (int64, string, string, error) {
 	const op = "auth.RegisterNewUser"
 
 	// Логирование регистрации
 	a.log.With("op", op, "email", email).Info("attempting to register user")
 
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			a.log.Warn("app not found", "error", err)
+			return 0, "", "", storage.ErrAppNotFound
+		}
+		a.log.Error("failed to retrieve app", "error", err)
+		return 0, "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	verr := &ValidationError{}
+
+	// Нормализуем email
+	email, err = emailaddr.Normalize(email)
+	if err != nil {
+		verr.Violations = append(verr.Violations, FieldViolation{Field: "email", Description: "is not a valid email address"})
+	}
+
+	// Проверяем пароль на соответствие политике
+	violations, err := a.passwordPolicy.Validate(email, pass)
+	if err != nil {
+		a.log.Error("failed to validate password", "error", err)
+		return 0, "", "", fmt.Errorf("%s: %v", op, err)
+	}
+	for _, v := range violations {
+		verr.Violations = append(verr.Violations, FieldViolation{Field: "password", Description: v})
+	}
+
+	if len(verr.Violations) > 0 {
+		a.log.Warn("registration request rejected", "violations", len(verr.Violations))
+		return 0, "", "", verr
+	}
+
 	// Хешируем пароль
-	passHash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	passHash, err := a.hasher.Hash(pass)
 	if err != nil {
 		a.log.Error("failed to generate password hash", "error", err)
-		return "", "", fmt.Errorf("%s: %v", op, err)
+		return 0, "", "", fmt.Errorf("%s: %v", op, err)
 	}
 
 	// Сохраняем пользователя в БД
@@ -144,84 +481,161 @@ func (a *Auth) RegisterNewUser(ctx context.Context, email string, pass string, a
 	if err != nil {
 		if errors.Is(err, storage.ErrUserExists) {
 			a.log.Warn("user already exists", "error", err)
-			return "", "", fmt.Errorf("user with this email already exists")
+			return 0, "", "", storage.ErrUserExists
 		}
 		a.log.Error("failed to save user", "error", err)
-		return "", "", fmt.Errorf("%s: %v", op, err)
+		return 0, "", "", fmt.Errorf("%s: %v", op, err)
 	}
 
-	// Получаем пользователя и приложение для токенов
 	user := models.User{ID: userID, Email: email, PassHash: passHash}
-	app, err := a.appProvider.App(ctx, appID)
-	if err != nil {
-		return "", "", fmt.Errorf("%s: %v", op, err)
-	}
-
-	accessToken, err := jwt.NewAccessToken(user, app, a.AcessTokenTTL)
-	if err != nil {
-		return "", "", fmt.Errorf("%s: %v", op, err)
-	}
 
-	refreshToken, err := jwt.NewRefreshToken(user, app, a.RefreshTokenTTL)
+	accessToken, refreshToken, err := a.issueTokens(ctx, user, app, newAuthInfo(amrPassword))
 	if err != nil {
-		return "", "", fmt.Errorf("%s: %v", op, err)
-	}
-
-	// Сохраняем refresh токен в БД (чтобы можно было использовать его для обновления)
-	if err := a.usrSaver.SaveRefreshToken(ctx, userID, refreshToken); err != nil {
-		return "", "", fmt.Errorf("%s: %v", op, err)
+		return 0, "", "", fmt.Errorf("%s: %v", op, err)
 	}
 
 	a.log.Info("user registered and tokens generated successfully")
-	return accessToken, refreshToken, nil
+	return userID, accessToken, refreshToken, nil
 }
 
-func (a *Auth) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+// IsAdmin сообщает, есть ли у пользователя глобальное разрешение PermissionAdmin.
+// Доступно только доверенным приложениям. Для несуществующего пользователя
+// возвращает false, чтобы ответ нельзя было использовать для перебора пользователей.
+func (a *Auth) IsAdmin(ctx context.Context, client models.App, userID int64) (bool, error) {
 	const op = "Auth.IsAdmin"
 
-	a.log.With(
+	log := a.log.With(
 		"op", op,
 		"userID", userID,
-	).Info("checking if user is admin")
+		"clientID", client.ID,
+	)
+
+	if err := authorizeLookup(client, 0); err != nil {
+		log.Warn("admin check denied for untrusted app")
+		return false, err
+	}
 
-	isAdmin, err := a.usrProvider.IsAdmin(ctx, userID)
+	isAdmin, err := a.roleStorage.HasPermission(ctx, userID, 0, PermissionAdmin)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
-			a.log.Warn("user not found for admin check", "error", err)
-			return false, storage.ErrUserNotFound
+			log.Info("admin check for unknown user")
+			return false, nil
 		}
-		a.log.Error("failed to check admin status", "error", err)
+		log.Error("failed to check admin status", "error", err)
 		return false, fmt.Errorf("%s: %v", op, err)
 	}
 
-	a.log.Info("checked admin status", "isAdmin", isAdmin)
+	log.Info("checked admin status", "isAdmin", isAdmin)
 	return isAdmin, nil
 }
 
-func (a *Auth) RefreshAccessToken(ctx context.Context, refreshToken string, appID int) (string, error) {
+// RefreshAccessToken выпускает новый access токен по refresh токену. Если сессия
+// старше req.MaxAge, возвращает ErrReauthenticationRequired. Если уровень
+// аутентификации сессии ниже req.MinACR, возвращает MFARequiredError: после
+// VerifyMFA выдаются новые токены с повышенным уровнем.
+func (a *Auth) RefreshAccessToken(ctx context.Context, refreshToken string, appID int, req AuthRequirements) (string, error) {
 	const op = "Auth.RefreshAccessToken"
 
+	if err := req.validate(); err != nil {
+		return "", err
+	}
+
+	session, err := a.refreshSession(ctx, refreshToken, appID)
+	if err != nil {
+		return "", err
+	}
+	user, app, authInfo := session.user, session.app, session.auth
+
+	// Новый токен может сузить scope сессии, но не расширить
+	authInfo.Scope, err = a.refreshScope(ctx, app.ID, authInfo.Scope, req.Scope)
+	if err != nil {
+		var scopeErr *ScopeError
+		if errors.As(err, &scopeErr) {
+			a.log.Warn("requested scope not granted", "denied", scopeErr.Denied)
+			return "", err
+		}
+		a.log.Error("failed to check requested scope", "error", err)
+		return "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	// Проверка давности аутентификации
+	if req.MaxAge > 0 && (authInfo.AuthTime.IsZero() || time.Since(authInfo.AuthTime) > req.MaxAge) {
+		a.log.Warn("session too old for requested max age", "userID", user.ID, "authTime", authInfo.AuthTime)
+		return "", ErrReauthenticationRequired
+	}
+
+	// Уровня сессии недостаточно: повышаем его вторым фактором
+	if !req.satisfiedBy(authInfo.ACR) {
+		a.log.Info("step-up authentication required", "userID", user.ID, "acr", authInfo.ACR, "minACR", req.MinACR)
+		if err := a.requireMFA(ctx, user, app, authInfo, req); err != nil {
+			return "", err
+		}
+		return "", ErrInsufficientACR
+	}
+
+	// Роли перечитываются, чтобы изменения вступали в силу с новым access токеном
+	authInfo, grants, err := a.accessGrants(ctx, user.ID, app.ID, authInfo)
+	if err != nil {
+		a.log.Error("failed to load user roles", "error", err)
+		return "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	// Генерация нового access токена с методами аутентификации исходного входа
+	accessToken, err := jwt.NewAccessToken(user, app, a.AcessTokenTTL, authInfo, grants)
+	if err != nil {
+		a.log.Error("failed to generate JWT", "error", err)
+		return "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	a.log.Info("access token refreshed successfully")
+	return accessToken, nil
+}
+
+// refreshedSession — сессия, подтвержденная refresh токеном.
+type refreshedSession struct {
+	user models.User
+	app  models.App
+	auth jwt.AuthInfo
+}
+
+// refreshSession проверяет refresh токен сессии в приложении appID и что
+// пользователю по-прежнему разрешен вход.
+func (a *Auth) refreshSession(ctx context.Context, refreshToken string, appID int) (refreshedSession, error) {
+	const op = "Auth.refreshSession"
+
 	// Проверка refresh токена
-	claims, err := jwt.ParseRefreshToken(refreshToken, a.appProvider, appID)
+	claims, err := jwt.ParseRefreshToken(ctx, refreshToken, a.appProvider, appID)
 	if err != nil {
 		a.log.Warn("invalid refresh token")
-		return "", ErrInvalidCredentials
+		return refreshedSession{}, ErrInvalidCredentials
 	}
 
 	// Получение информации о пользователе по UID
-	userID, ok := claims["uid"].(int64)
-	if !ok {
-		return "", ErrInvalidCredentials
+	userID, err := jwt.UserID(claims)
+	if err != nil {
+		return refreshedSession{}, ErrInvalidCredentials
 	}
 
 	user, err := a.usrProvider.UserByID(ctx, userID)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
 			a.log.Warn("user not found")
-			return "", storage.ErrUserNotFound
+			return refreshedSession{}, storage.ErrUserNotFound
 		}
 		a.log.Error("failed to retrieve user", "error", err)
-		return "", fmt.Errorf("%s: %v", op, err)
+		return refreshedSession{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	// Токен должен совпадать с сохраненным: отзыв сессии удаляет его из БД
+	if user.RefreshToken == "" || !secret.Equal([]byte(user.RefreshToken), []byte(refreshToken)) {
+		a.log.Warn("refresh token revoked")
+		return refreshedSession{}, ErrInvalidCredentials
+	}
+
+	// Проверка статуса аккаунта
+	if err := checkStatus(user); err != nil {
+		a.log.Warn("refresh rejected by account status", "status", user.Status)
+		return refreshedSession{}, err
 	}
 
 	// Проверка appID
@@ -229,19 +643,206 @@ func (a *Auth) RefreshAccessToken(ctx context.Context, refreshToken string, appI
 	if err != nil {
 		if errors.Is(err, storage.ErrAppNotFound) {
 			a.log.Warn("app not found", "error", err)
-			return "", storage.ErrAppNotFound
+			return refreshedSession{}, storage.ErrAppNotFound
 		}
 		a.log.Error("failed to retrieve app", "error", err)
-		return "", fmt.Errorf("%s: %v", op, err)
+		return refreshedSession{}, fmt.Errorf("%s: %v", op, err)
 	}
 
-	// Генерация нового access токена
-	accessToken, err := jwt.NewAccessToken(user, app, a.AcessTokenTTL)
+	return refreshedSession{user: user, app: app, auth: sessionAuth(jwt.Auth(claims))}, nil
+}
+
+// issueTokens выпускает access и refresh токены и сохраняет refresh токен,
+// заменяя прежний.
+func (a *Auth) issueTokens(ctx context.Context, user models.User, app models.App, authInfo jwt.AuthInfo) (string, string, error) {
+	authInfo, grants, err := a.accessGrants(ctx, user.ID, app.ID, authInfo)
+	if err != nil {
+		a.log.Error("failed to load user roles", "error", err)
+		return "", "", err
+	}
+
+	accessToken, err := jwt.NewAccessToken(user, app, a.AcessTokenTTL, authInfo, grants)
 	if err != nil {
 		a.log.Error("failed to generate JWT", "error", err)
-		return "", fmt.Errorf("%s: %v", op, err)
+		return "", "", err
 	}
 
-	a.log.Info("access token refreshed successfully")
-	return accessToken, nil
+	refreshToken, err := jwt.NewRefreshToken(user, app, a.RefreshTokenTTL, authInfo)
+	if err != nil {
+		a.log.Error("failed to generate refresh token", "error", err)
+		return "", "", err
+	}
+
+	// Сохраняем refresh токен в БД (чтобы можно было использовать его для обновления)
+	if err := a.usrSaver.SaveRefreshToken(ctx, user.ID, refreshToken); err != nil {
+		a.log.Error("failed to save refresh token", "error", err)
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// rehashPassword сохраняет хеш пароля, построенный текущим алгоритмом.
+// Ошибка не прерывает вход: хеш будет пересчитан при следующем входе.
+func (a *Auth) rehashPassword(ctx context.Context, userID int64, pass string) {
+	passHash, err := a.hasher.Hash(pass)
+	if err != nil {
+		a.log.Error("failed to rehash password", "userID", userID, "error", err)
+		return
+	}
+
+	if err := a.usrSaver.UpdatePasswordHash(ctx, userID, passHash); err != nil {
+		a.log.Error("failed to save rehashed password", "userID", userID, "error", err)
+		return
+	}
+
+	a.log.Info("password hash upgraded", "userID", userID)
+}
+
+// registerFailedLogin учитывает неудачную попытку входа и блокирует аккаунт при достижении порога.
+func (a *Auth) registerFailedLogin(ctx context.Context, user models.User) error {
+	const op = "Auth.registerFailedLogin"
+
+	if a.lockout.MaxAttempts <= 0 {
+		return ErrInvalidCredentials
+	}
+
+	attempts, err := a.loginAttempts.IncrementFailedLogins(ctx, user.ID)
+	if err != nil {
+		a.log.Error("failed to register failed login", "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return a.lockAfterFailedLogins(ctx, user, attempts)
+}
+
+// reserveLoginAttempt учитывает попытку входа до проверки пароля и возвращает
+// номер попытки. Если вход заблокирован или порог исчерпан параллельными
+// попытками, возвращает LockedError. При отключенной блокировке возвращает 0.
+func (a *Auth) reserveLoginAttempt(ctx context.Context, user models.User) (int, error) {
+	const op = "Auth.reserveLoginAttempt"
+
+	if a.lockout.MaxAttempts <= 0 {
+		return 0, nil
+	}
+
+	attempts, reserved, err := a.loginAttempts.ReserveLoginAttempt(ctx, user.ID, a.lockout.MaxAttempts)
+	if err != nil {
+		a.log.Error("failed to reserve login attempt", "error", err)
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+	if !reserved {
+		retryAfter := a.lockout.duration(user.LockoutCount)
+		a.log.Warn("login attempts exhausted", "userID", user.ID, "retryAfter", retryAfter)
+		return 0, &LockedError{RetryAfter: retryAfter}
+	}
+
+	return attempts, nil
+}
+
+// lockAfterFailedLogins блокирует аккаунт, если неудачная попытка attempts
+// достигла порога, и возвращает ошибку для вызывающего.
+func (a *Auth) lockAfterFailedLogins(ctx context.Context, user models.User, attempts int) error {
+	const op = "Auth.lockAfterFailedLogins"
+
+	if a.lockout.MaxAttempts <= 0 || attempts < a.lockout.MaxAttempts {
+		return ErrInvalidCredentials
+	}
+
+	lockFor := a.lockout.duration(user.LockoutCount)
+	if err := a.loginAttempts.LockUser(ctx, user.ID, time.Now().Add(lockFor)); err != nil {
+		a.log.Error("failed to lock user", "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	a.log.Warn("account locked after failed login attempts", "userID", user.ID, "attempts", attempts, "lockFor", lockFor)
+	return &LockedError{RetryAfter: lockFor}
+}
+
+// UnlockUser снимает блокировку входа с пользователя. Доступно только администраторам.
+func (a *Auth) UnlockUser(ctx context.Context, accessToken string, userID int64) error {
+	const op = "Auth.UnlockUser"
+
+	log := a.log.With(
+		"op", op,
+		"userID", userID,
+	)
+
+	if _, err := a.requireAdmin(ctx, accessToken); err != nil {
+		log.Warn("unlock denied", "error", err)
+		return err
+	}
+
+	if err := a.loginAttempts.ResetLoginAttempts(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return storage.ErrUserNotFound
+		}
+		log.Error("failed to unlock user", "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("user unlocked")
+	return nil
+}
+
+// accessClaims — проверенные данные access токена.
+type accessClaims struct {
+	userID int64
+	appID  int
+	auth   jwt.AuthInfo
+	grants jwt.Grants
+	// user — владелец токена, загруженный при проверке его статуса.
+	user models.User
+}
+
+// authenticate проверяет access токен и возвращает ID его владельца.
+func (a *Auth) authenticate(ctx context.Context, accessToken string) (int64, error) {
+	claims, err := a.authenticateClaims(ctx, accessToken)
+	if err != nil {
+		return 0, err
+	}
+
+	return claims.userID, nil
+}
+
+// authenticateClaims проверяет access токен и возвращает владельца и приложение, которому токен выдан.
+// Токен пользователя, который удален, заблокирован или приостановлен после его
+// выпуска, не принимается.
+func (a *Auth) authenticateClaims(ctx context.Context, accessToken string) (accessClaims, error) {
+	const op = "Auth.authenticateClaims"
+
+	claims, err := jwt.ParseAccessToken(ctx, accessToken, a.appProvider)
+	if err != nil {
+		return accessClaims{}, ErrInvalidToken
+	}
+
+	userID, err := jwt.UserID(claims)
+	if err != nil {
+		return accessClaims{}, ErrInvalidToken
+	}
+
+	appID, err := jwt.AppID(claims)
+	if err != nil {
+		return accessClaims{}, ErrInvalidToken
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return accessClaims{}, ErrInvalidToken
+		}
+		return accessClaims{}, fmt.Errorf("%s: %v", op, err)
+	}
+	if err := checkStatus(user); err != nil {
+		a.log.Warn("access token of inactive user rejected", "op", op, "userID", userID, "status", user.Status)
+		return accessClaims{}, ErrInvalidToken
+	}
+
+	return accessClaims{userID: userID, appID: appID, auth: jwt.Auth(claims), grants: jwt.AccessGrants(claims), user: user}, nil
+}
+
+// requireAdmin проверяет, что access токен принадлежит администратору, и возвращает его ID.
+func (a *Auth) requireAdmin(ctx context.Context, accessToken string) (int64, error) {
+	return a.authorize(ctx, accessToken, 0, PermissionAdmin)
 }
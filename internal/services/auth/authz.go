@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/policy"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+const (
+	// resourceSeparator отделяет в разрешении роли ресурс, которым оно ограничено.
+	resourceSeparator = "@"
+
+	maxPermissionChecks = 100
+)
+
+// AuthorizationPolicy задает параметры решений CheckPermission.
+type AuthorizationPolicy struct {
+	// DecisionTTL — время, в течение которого вызывающий может кешировать решение.
+	DecisionTTL time.Duration
+	// Policies — политики доступа из конфигурации. Применяются вместе с
+	// политиками приложений из БД.
+	Policies []policy.Policy
+}
+
+// PermissionCheck — проверяемое разрешение. Resource пуст, если проверяется
+// разрешение без привязки к ресурсу.
+type PermissionCheck struct {
+	Permission string
+	Resource   string
+	// ResourceAttributes — атрибуты ресурса для политик (resource.<name>).
+	// resource.id — это Resource.
+	ResourceAttributes map[string]string
+}
+
+// CheckOptions задает контекст проверки разрешений.
+type CheckOptions struct {
+	// Context — атрибуты запроса для политик (context.<name>): IP, канал и т.п.
+	// context.time, context.date, context.hour и context.weekday вычисляет сервер в UTC.
+	Context map[string]string
+	// Explain добавляет к решениям объяснение: какие роли и политики на них повлияли.
+	Explain bool
+}
+
+// PermissionDecision — решение по одной проверке.
+type PermissionDecision struct {
+	Allowed bool
+	// Trace — объяснение решения, заполняется только с CheckOptions.Explain.
+	Trace []DecisionStep
+}
+
+// Источники шагов объяснения решения.
+const (
+	DecisionSourceStatus = "status"
+	DecisionSourceRole   = "role"
+	DecisionSourcePolicy = "policy"
+)
+
+// DecisionStep — шаг объяснения решения: роль или политика и ее вклад в решение.
+type DecisionStep struct {
+	Source string
+	// Name — имя роли или ID политики.
+	Name    string
+	Effect  policy.Effect
+	Matched bool
+	Reason  string
+}
+
+// CheckPermission сообщает, разрешено ли пользователю в приложении appID
+// действие check. Вместе с решением возвращается срок, на который его можно кешировать.
+func (a *Auth) CheckPermission(ctx context.Context, client models.App, userID int64, appID int, check PermissionCheck, opts CheckOptions) (PermissionDecision, time.Duration, error) {
+	decisions, ttl, err := a.CheckPermissions(ctx, client, userID, appID, []PermissionCheck{check}, opts)
+	if err != nil {
+		return PermissionDecision{}, 0, err
+	}
+
+	return decisions[0], ttl, nil
+}
+
+// CheckPermissions проверяет несколько разрешений за один запрос. Решения
+// возвращаются в порядке checks. Разрешение дается ролью пользователя или
+// разрешающей политикой; сработавшая запрещающая политика отменяет его.
+// Пользователю с неактивным аккаунтом, как и несуществующему, все проверки
+// отклоняются. Приложение client проверяет разрешения только в своем
+// приложении, если оно не доверенное.
+func (a *Auth) CheckPermissions(ctx context.Context, client models.App, userID int64, appID int, checks []PermissionCheck, opts CheckOptions) ([]PermissionDecision, time.Duration, error) {
+	const op = "Auth.CheckPermissions"
+
+	log := a.log.With(
+		"op", op,
+		"userID", userID,
+		"appID", appID,
+		"clientID", client.ID,
+	)
+
+	if err := authorizeLookup(client, appID); err != nil {
+		log.Warn("permission check for another app denied")
+		return nil, 0, err
+	}
+
+	if err := validatePermissionChecks(checks, opts); err != nil {
+		return nil, 0, err
+	}
+
+	if _, err := a.appProvider.App(ctx, appID); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found")
+			return nil, 0, storage.ErrAppNotFound
+		}
+		log.Error("failed to retrieve app", "error", err)
+		return nil, 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	decisions := make([]PermissionDecision, len(checks))
+
+	// Несуществующий пользователь неотличим от неактивного
+	user, err := a.usrProvider.UserByID(ctx, userID)
+	if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+		log.Error("failed to retrieve user", "error", err)
+		return nil, 0, fmt.Errorf("%s: %v", op, err)
+	}
+	if err != nil || checkStatus(user) != nil {
+		log.Info("permissions denied: user missing or inactive", "status", user.Status)
+		if opts.Explain {
+			for i := range decisions {
+				decisions[i].Trace = []DecisionStep{{
+					Source:  DecisionSourceStatus,
+					Effect:  policy.EffectDeny,
+					Matched: true,
+					Reason:  "account is not active",
+				}}
+			}
+		}
+		return decisions, a.authorization.DecisionTTL, nil
+	}
+
+	roles, err := a.roleStorage.UserRoles(ctx, userID, appID)
+	if err != nil {
+		log.Error("failed to load user roles", "error", err)
+		return nil, 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	policies, err := a.appPolicies(ctx, appID)
+	if err != nil {
+		log.Error("failed to load policies", "error", err)
+		return nil, 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	subject := subjectAttributes(user)
+	reqContext := requestContext(opts.Context, time.Now())
+
+	for i, check := range checks {
+		decisions[i] = decide(roles, policies, check, policy.Request{
+			Permission: check.Permission,
+			Subject:    subject,
+			Resource:   resourceAttributes(check),
+			Context:    reqContext,
+		}, opts.Explain)
+	}
+
+	log.Debug("permissions checked", "checks", len(checks), "policies", len(policies))
+	return decisions, a.authorization.DecisionTTL, nil
+}
+
+// decide объединяет разрешения ролей и политики в решение по одной проверке.
+func decide(roles []models.Role, policies []policy.Policy, check PermissionCheck, req policy.Request, explain bool) PermissionDecision {
+	var decision PermissionDecision
+
+	granted := false
+	for _, role := range roles {
+		permissions := make(map[string]struct{}, len(role.Permissions))
+		for _, p := range role.Permissions {
+			permissions[p] = struct{}{}
+		}
+		if !hasGrant(permissions, check) {
+			continue
+		}
+
+		granted = true
+		if !explain {
+			break
+		}
+		decision.Trace = append(decision.Trace, DecisionStep{
+			Source:  DecisionSourceRole,
+			Name:    role.Name,
+			Effect:  policy.EffectAllow,
+			Matched: true,
+			Reason:  "role grants " + check.Permission,
+		})
+	}
+	if explain && !granted {
+		decision.Trace = append(decision.Trace, DecisionStep{
+			Source: DecisionSourceRole,
+			Effect: policy.EffectAllow,
+			Reason: "no role grants " + check.Permission,
+		})
+	}
+
+	result := policy.Evaluate(policies, req)
+	if explain {
+		for _, step := range result.Trace {
+			decision.Trace = append(decision.Trace, DecisionStep{
+				Source:  DecisionSourcePolicy,
+				Name:    step.Policy,
+				Effect:  step.Effect,
+				Matched: step.Matched,
+				Reason:  step.Reason,
+			})
+		}
+	}
+
+	decision.Allowed = result.Effect != policy.EffectDeny && (granted || result.Effect == policy.EffectAllow)
+
+	return decision
+}
+
+// resourceAttributes возвращает атрибуты resource.* проверки.
+func resourceAttributes(check PermissionCheck) policy.Attributes {
+	attrs := make(policy.Attributes, len(check.ResourceAttributes)+1)
+	maps.Copy(attrs, check.ResourceAttributes)
+	if check.Resource != "" {
+		attrs["id"] = check.Resource
+	}
+
+	return attrs
+}
+
+// hasGrant сообщает, выдано ли разрешение на все ресурсы или на ресурс проверки.
+func hasGrant(granted map[string]struct{}, check PermissionCheck) bool {
+	if _, ok := granted[check.Permission]; ok {
+		return true
+	}
+	if check.Resource == "" {
+		return false
+	}
+	_, ok := granted[check.Permission+resourceSeparator+check.Resource]
+
+	return ok
+}
+
+func validatePermissionChecks(checks []PermissionCheck, opts CheckOptions) error {
+	verr := &ValidationError{Violations: validateAttributes("context", opts.Context)}
+
+	if len(checks) == 0 {
+		verr.Violations = append(verr.Violations, FieldViolation{Field: "checks", Description: "must not be empty"})
+	}
+	if len(checks) > maxPermissionChecks {
+		verr.Violations = append(verr.Violations, FieldViolation{
+			Field:       "checks",
+			Description: fmt.Sprintf("must contain at most %d checks", maxPermissionChecks),
+		})
+	}
+	for i, check := range checks {
+		if !permissionNamePattern.MatchString(check.Permission) {
+			verr.Violations = append(verr.Violations, FieldViolation{
+				Field:       fmt.Sprintf("checks[%d].permission", i),
+				Description: "must be a valid permission name",
+			})
+		}
+		if check.Resource != "" && !resourcePattern.MatchString(check.Resource) {
+			verr.Violations = append(verr.Violations, FieldViolation{
+				Field:       fmt.Sprintf("checks[%d].resource", i),
+				Description: "must be 1-128 letters, digits, '_', '.', ':', '/' or '-'",
+			})
+		}
+		verr.Violations = append(verr.Violations, validateAttributes(fmt.Sprintf("checks[%d].resource_attributes", i), check.ResourceAttributes)...)
+	}
+
+	if len(verr.Violations) > 0 {
+		return verr
+	}
+	return nil
+}
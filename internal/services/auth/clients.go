@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/secret"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+var (
+	ErrInvalidClient = errors.New("invalid client credentials")
+)
+
+// ClientAuthPolicy задает аутентификацию приложений, вызывающих внутренние RPC
+// (IsAdmin, CheckPermission).
+type ClientAuthPolicy struct {
+	// CertificateApps сопоставляет CN проверенного клиентского сертификата (mTLS) с ID приложения.
+	CertificateApps map[string]int
+}
+
+// AuthenticateClient проверяет учетные данные приложения: ID и секрет.
+func (a *Auth) AuthenticateClient(ctx context.Context, appID int, clientSecret string) (models.App, error) {
+	const op = "Auth.AuthenticateClient"
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			a.log.Warn("client authentication for unknown app", "op", op, "appID", appID)
+			return models.App{}, ErrInvalidClient
+		}
+		return models.App{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if clientSecret == "" || !secret.Equal([]byte(app.Secret), []byte(clientSecret)) {
+		a.log.Warn("invalid client secret", "op", op, "appID", appID)
+		return models.App{}, ErrInvalidClient
+	}
+
+	return app, nil
+}
+
+// AuthenticateClientCertificate возвращает приложение, которому сопоставлен
+// CN клиентского сертификата. Сертификат уже проверен при установке TLS соединения.
+func (a *Auth) AuthenticateClientCertificate(ctx context.Context, commonName string) (models.App, error) {
+	const op = "Auth.AuthenticateClientCertificate"
+
+	appID, ok := a.clientAuth.CertificateApps[commonName]
+	if !ok || commonName == "" {
+		a.log.Warn("client certificate is not mapped to an app", "op", op, "commonName", commonName)
+		return models.App{}, ErrInvalidClient
+	}
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			a.log.Error("client certificate mapped to unknown app", "op", op, "commonName", commonName, "appID", appID)
+			return models.App{}, ErrInvalidClient
+		}
+		return models.App{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return app, nil
+}
+
+// authorizeLookup проверяет, что приложение client может запрашивать роли и
+// разрешения пользователей в приложении appID (0 — глобальные). Недоверенное
+// приложение видит только себя.
+func authorizeLookup(client models.App, appID int) error {
+	if client.Trusted || (appID != 0 && client.ID == appID) {
+		return nil
+	}
+
+	return ErrPermissionDenied
+}
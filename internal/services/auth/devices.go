@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/secret"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+const (
+	deviceTokenSize   = 32
+	maxDeviceNameLen  = 64
+	defaultDeviceName = "Unknown device"
+)
+
+var (
+	ErrDeviceNotFound      = errors.New("trusted device not found")
+	ErrDeviceTrustDisabled = errors.New("trusted devices are disabled")
+)
+
+// TrustDevice делает устройство доверенным: при входе с ним второй фактор не
+// запрашивается до истечения MFAPolicy.TrustedDeviceTTL. Access токен должен быть
+// получен вторым фактором не раньше recentAuthMaxAge назад. Возвращает токен
+// устройства, который клиент передает при входе; на сервере хранится только его хеш.
+func (a *Auth) TrustDevice(ctx context.Context, accessToken string, name string) (models.TrustedDevice, string, error) {
+	const op = "Auth.TrustDevice"
+
+	if a.mfa.TrustedDeviceTTL <= 0 {
+		return models.TrustedDevice{}, "", ErrDeviceTrustDisabled
+	}
+
+	claims, err := a.authenticateClaims(ctx, accessToken)
+	if err != nil {
+		return models.TrustedDevice{}, "", err
+	}
+
+	log := a.log.With(
+		"op", op,
+		"userID", claims.userID,
+	)
+
+	if err := requireRecentAuth(claims.auth, true); err != nil {
+		log.Warn("device trust requested without recent mfa", "amr", claims.auth.AMR, "authTime", claims.auth.AuthTime)
+		return models.TrustedDevice{}, "", err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = defaultDeviceName
+	}
+	if utf8.RuneCountInString(name) > maxDeviceNameLen {
+		return models.TrustedDevice{}, "", &ValidationError{Violations: []FieldViolation{{
+			Field:       "name",
+			Description: fmt.Sprintf("must be at most %d characters", maxDeviceNameLen),
+		}}}
+	}
+
+	token, err := secret.Token(deviceTokenSize)
+	if err != nil {
+		return models.TrustedDevice{}, "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	now := time.Now()
+	device := models.TrustedDevice{
+		UserID:    claims.userID,
+		Name:      name,
+		ExpiresAt: now.Add(a.mfa.TrustedDeviceTTL),
+		CreatedAt: now,
+	}
+
+	device.ID, err = a.deviceStorage.SaveTrustedDevice(ctx, device, secret.Hash(token))
+	if err != nil {
+		log.Error("failed to save trusted device", "error", err)
+		return models.TrustedDevice{}, "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("device trusted", "deviceID", device.ID, "expiresAt", device.ExpiresAt)
+	return device, token, nil
+}
+
+// ListTrustedDevices возвращает действующие доверенные устройства владельца access токена.
+func (a *Auth) ListTrustedDevices(ctx context.Context, accessToken string) ([]models.TrustedDevice, error) {
+	const op = "Auth.ListTrustedDevices"
+
+	userID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := a.deviceStorage.TrustedDevices(ctx, userID)
+	if err != nil {
+		a.log.Error("failed to retrieve trusted devices", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return devices, nil
+}
+
+// RevokeTrustedDevice отзывает доверенное устройство владельца access токена.
+func (a *Auth) RevokeTrustedDevice(ctx context.Context, accessToken string, deviceID int64) error {
+	const op = "Auth.RevokeTrustedDevice"
+
+	userID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+
+	if err := a.deviceStorage.DeleteTrustedDevice(ctx, userID, deviceID); err != nil {
+		if errors.Is(err, storage.ErrDeviceNotFound) {
+			return ErrDeviceNotFound
+		}
+		a.log.Error("failed to revoke trusted device", "op", op, "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	a.log.Info("trusted device revoked", "op", op, "userID", userID, "deviceID", deviceID)
+	return nil
+}
+
+// RevokeAllTrustedDevices отзывает все доверенные устройства владельца access токена.
+func (a *Auth) RevokeAllTrustedDevices(ctx context.Context, accessToken string) error {
+	const op = "Auth.RevokeAllTrustedDevices"
+
+	userID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+
+	if err := a.deviceStorage.DeleteTrustedDevices(ctx, userID); err != nil {
+		a.log.Error("failed to revoke trusted devices", "op", op, "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	a.log.Info("all trusted devices revoked", "op", op, "userID", userID)
+	return nil
+}
+
+// isTrustedDevice сообщает, принадлежит ли токен действующему доверенному устройству
+// пользователя. Ошибка хранилища не мешает входу: второй фактор просто будет запрошен.
+func (a *Auth) isTrustedDevice(ctx context.Context, userID int64, deviceToken string) bool {
+	if deviceToken == "" || a.mfa.TrustedDeviceTTL <= 0 {
+		return false
+	}
+
+	ok, err := a.deviceStorage.UseTrustedDevice(ctx, userID, secret.Hash(deviceToken))
+	if err != nil {
+		a.log.Error("failed to check trusted device", "userID", userID, "error", err)
+		return false
+	}
+
+	return ok
+}
@@ -0,0 +1,352 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	emailaddr "github.com/1abobik1/Single-Sign-On/internal/lib/email"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/identifier"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/notify"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/secret"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+const (
+	verificationCodeDigits      = 6
+	verificationCodeTTL         = 10 * time.Minute
+	verificationCodeMaxAttempts = 5
+	// Не больше verificationCodeMaxSends кодов за verificationCodeSendWindow
+	// одному пользователю и на один адрес.
+	verificationCodeMaxSends   = 5
+	verificationCodeSendWindow = time.Hour
+)
+
+var (
+	ErrIdentifierExists      = errors.New("identifier already in use")
+	ErrIdentifierNotFound    = errors.New("identifier not found")
+	ErrInvalidCode           = errors.New("invalid or expired verification code")
+	ErrPrimaryIdentifier     = errors.New("email identifier cannot be changed")
+	ErrUnsupportedIdentifier = errors.New("unsupported identifier kind")
+)
+
+// normalizeIdentifier проверяет значение идентификатора и приводит его к каноническому виду.
+func normalizeIdentifier(kind models.IdentifierKind, value string, app models.App) (string, error) {
+	var (
+		normalized  string
+		err         error
+		description string
+	)
+
+	switch kind {
+	case models.IdentifierEmail:
+		normalized, err = emailaddr.Normalize(value)
+		description = "is not a valid email address"
+	case models.IdentifierUsername:
+		normalized, err = identifier.NormalizeUsername(value)
+		description = "must be 3-32 latin letters, digits, '.', '_' or '-' starting with a letter"
+	case models.IdentifierPhone:
+		normalized, err = identifier.NormalizePhone(value)
+		description = "must be a phone number in E.164 format"
+	default:
+		return "", ErrUnsupportedIdentifier
+	}
+	if err != nil {
+		return "", &ValidationError{Violations: []FieldViolation{{Field: string(kind), Description: description}}}
+	}
+
+	return normalized, nil
+}
+
+// userByLogin находит пользователя по email, имени пользователя или номеру телефона.
+// Номер телефона принимается только подтвержденным.
+func (a *Auth) userByLogin(ctx context.Context, login string, app models.App) (models.User, error) {
+	const op = "Auth.userByLogin"
+
+	kind := identifier.Detect(login)
+
+	value, err := normalizeIdentifier(kind, login, app)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	ident, err := a.identifiers.Identifier(ctx, kind, value)
+	if err != nil {
+		if errors.Is(err, storage.ErrIdentifierNotFound) {
+			return models.User{}, storage.ErrUserNotFound
+		}
+		return models.User{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if kind == models.IdentifierPhone && !ident.Verified() {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	return a.usrProvider.UserByID(ctx, ident.UserID)
+}
+
+// ListIdentifiers возвращает идентификаторы владельца access токена.
+func (a *Auth) ListIdentifiers(ctx context.Context, accessToken string) ([]models.Identifier, error) {
+	const op = "Auth.ListIdentifiers"
+
+	userID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	idents, err := a.identifiers.Identifiers(ctx, userID)
+	if err != nil {
+		a.log.Error("failed to list identifiers", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return idents, nil
+}
+
+// AddIdentifier добавляет владельцу access токена имя пользователя или номер телефона.
+// Имя пользователя доступно для входа сразу, на номер телефона отправляется код
+// подтверждения, который нужно передать в VerifyIdentifier. Номер, который
+// подтвердил другой пользователь, занят; неподтвержденные заявки не мешают.
+// Email сменить нельзя: для своего неподтвержденного email AddIdentifier
+// отправляет на него код подтверждения.
+func (a *Auth) AddIdentifier(ctx context.Context, accessToken string, kind models.IdentifierKind, value string) (models.Identifier, error) {
+	const op = "Auth.AddIdentifier"
+
+	log := a.log.With(
+		"op", op,
+		"kind", kind,
+	)
+
+	claims, err := a.authenticateClaims(ctx, accessToken)
+	if err != nil {
+		return models.Identifier{}, err
+	}
+
+	if kind == models.IdentifierEmail {
+		return a.requestEmailVerification(ctx, claims.userID, value)
+	}
+
+	app, err := a.appProvider.App(ctx, claims.appID)
+	if err != nil {
+		return models.Identifier{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	value, err = normalizeIdentifier(kind, value, app)
+	if err != nil {
+		return models.Identifier{}, err
+	}
+
+	ident := models.Identifier{UserID: claims.userID, Kind: kind, Value: value}
+
+	var code string
+	var codeHash []byte
+	if kind == models.IdentifierUsername {
+		ident.VerifiedAt = time.Now()
+	} else {
+		code, err = secret.NumericCode(verificationCodeDigits)
+		if err != nil {
+			return models.Identifier{}, fmt.Errorf("%s: %v", op, err)
+		}
+		codeHash = secret.Hash(code)
+	}
+
+	// Значение занято, только если его подтвердили: неподтвержденная чужая
+	// заявка не мешает владельцу
+	existing, err := a.identifiers.Identifier(ctx, kind, value)
+	if err != nil && !errors.Is(err, storage.ErrIdentifierNotFound) {
+		log.Error("failed to look up identifier", "error", err)
+		return models.Identifier{}, fmt.Errorf("%s: %v", op, err)
+	}
+	if err == nil && existing.Verified() {
+		log.Warn("identifier already in use")
+		return models.Identifier{}, ErrIdentifierExists
+	}
+
+	if code != "" {
+		byUser, byValue, err := a.identifiers.CountIdentifierCodeSends(ctx, claims.userID, kind, value, time.Now().Add(-verificationCodeSendWindow))
+		if err != nil {
+			log.Error("failed to count verification codes", "error", err)
+			return models.Identifier{}, fmt.Errorf("%s: %v", op, err)
+		}
+		if byUser >= verificationCodeMaxSends || byValue >= verificationCodeMaxSends {
+			log.Warn("verification code rate limited", "userID", claims.userID, "byUser", byUser, "byValue", byValue)
+			return models.Identifier{}, ErrTooManyRequests
+		}
+	}
+
+	// Повторный запрос кода заменяет неподтвержденный идентификатор того же вида
+	idents, err := a.identifiers.Identifiers(ctx, claims.userID)
+	if err != nil {
+		log.Error("failed to list identifiers", "error", err)
+		return models.Identifier{}, fmt.Errorf("%s: %v", op, err)
+	}
+	for _, own := range idents {
+		if own.Kind != kind || own.Verified() {
+			continue
+		}
+		if err := a.identifiers.DeleteIdentifier(ctx, claims.userID, kind); err != nil {
+			log.Error("failed to replace pending identifier", "error", err)
+			return models.Identifier{}, fmt.Errorf("%s: %v", op, err)
+		}
+	}
+
+	ident.ID, err = a.identifiers.SaveIdentifier(ctx, ident, codeHash, time.Now().Add(verificationCodeTTL))
+	if err != nil {
+		if errors.Is(err, storage.ErrIdentifierExists) {
+			log.Warn("identifier already in use")
+			return models.Identifier{}, ErrIdentifierExists
+		}
+		log.Error("failed to save identifier", "error", err)
+		return models.Identifier{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if code != "" {
+		err := a.sender.Send(ctx, notify.Message{
+			Channel: notify.ChannelSMS,
+			To:      value,
+			Body:    fmt.Sprintf("Your verification code: %s", code),
+		})
+		if err != nil {
+			log.Error("failed to send verification code", "error", err)
+			return models.Identifier{}, fmt.Errorf("%s: %v", op, err)
+		}
+	}
+
+	log.Info("identifier added", "userID", claims.userID, "verified", ident.Verified())
+	return ident, nil
+}
+
+// requestEmailVerification отправляет код подтверждения на email пользователя.
+// value должен совпадать с текущим email; подтвержденный email возвращается без отправки кода.
+func (a *Auth) requestEmailVerification(ctx context.Context, userID int64, value string) (models.Identifier, error) {
+	const op = "Auth.requestEmailVerification"
+
+	log := a.log.With(
+		"op", op,
+		"userID", userID,
+	)
+
+	value, err := emailaddr.Normalize(value)
+	if err != nil {
+		return models.Identifier{}, ErrPrimaryIdentifier
+	}
+
+	idents, err := a.identifiers.Identifiers(ctx, userID)
+	if err != nil {
+		log.Error("failed to list identifiers", "error", err)
+		return models.Identifier{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	var ident models.Identifier
+	for _, own := range idents {
+		if own.Kind == models.IdentifierEmail {
+			ident = own
+		}
+	}
+	if ident.Value != value {
+		return models.Identifier{}, ErrPrimaryIdentifier
+	}
+	if ident.Verified() {
+		return ident, nil
+	}
+
+	byUser, byValue, err := a.identifiers.CountIdentifierCodeSends(ctx, userID, ident.Kind, value, time.Now().Add(-verificationCodeSendWindow))
+	if err != nil {
+		log.Error("failed to count verification codes", "error", err)
+		return models.Identifier{}, fmt.Errorf("%s: %v", op, err)
+	}
+	if byUser >= verificationCodeMaxSends || byValue >= verificationCodeMaxSends {
+		log.Warn("verification code rate limited", "byUser", byUser, "byValue", byValue)
+		return models.Identifier{}, ErrTooManyRequests
+	}
+
+	code, err := secret.NumericCode(verificationCodeDigits)
+	if err != nil {
+		return models.Identifier{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	err = a.identifiers.SetIdentifierCode(ctx, userID, ident.Kind, secret.Hash(code), time.Now().Add(verificationCodeTTL))
+	if err != nil {
+		if errors.Is(err, storage.ErrIdentifierNotFound) {
+			// неподтвержденного email уже нет: его подтвердили параллельным запросом
+			return models.Identifier{}, ErrIdentifierNotFound
+		}
+		log.Error("failed to save verification code", "error", err)
+		return models.Identifier{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	err = a.sender.Send(ctx, notify.Message{
+		Channel: notify.ChannelEmail,
+		To:      value,
+		Subject: "Email verification",
+		Body:    fmt.Sprintf("Your verification code: %s", code),
+	})
+	if err != nil {
+		log.Error("failed to send verification code", "error", err)
+		return models.Identifier{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("email verification code sent")
+	return ident, nil
+}
+
+// VerifyIdentifier подтверждает идентификатор владельца access токена кодом из сообщения.
+func (a *Auth) VerifyIdentifier(ctx context.Context, accessToken string, kind models.IdentifierKind, code string) error {
+	const op = "Auth.VerifyIdentifier"
+
+	log := a.log.With(
+		"op", op,
+		"kind", kind,
+	)
+
+	userID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+
+	ok, err := a.identifiers.ConfirmIdentifier(ctx, userID, kind, secret.Hash(code), verificationCodeMaxAttempts)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrIdentifierNotFound):
+			return ErrIdentifierNotFound
+		case errors.Is(err, storage.ErrIdentifierExists):
+			log.Warn("identifier was verified by another user", "userID", userID)
+			return ErrIdentifierExists
+		}
+		log.Error("failed to confirm identifier", "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if !ok {
+		log.Warn("invalid verification code", "userID", userID)
+		return ErrInvalidCode
+	}
+
+	log.Info("identifier verified", "userID", userID)
+	return nil
+}
+
+// RemoveIdentifier удаляет у владельца access токена имя пользователя или номер телефона.
+func (a *Auth) RemoveIdentifier(ctx context.Context, accessToken string, kind models.IdentifierKind) error {
+	const op = "Auth.RemoveIdentifier"
+
+	if kind == models.IdentifierEmail {
+		return ErrPrimaryIdentifier
+	}
+
+	userID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+
+	if err := a.identifiers.DeleteIdentifier(ctx, userID, kind); err != nil {
+		if errors.Is(err, storage.ErrIdentifierNotFound) {
+			return ErrIdentifierNotFound
+		}
+		a.log.Error("failed to remove identifier", "op", op, "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,364 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	emailaddr "github.com/1abobik1/Single-Sign-On/internal/lib/email"
+	jwt "github.com/1abobik1/Single-Sign-On/internal/lib/jwt"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/notify"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/secret"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+const invitationIDSize = 24
+
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrLoginRequired      = errors.New("account already exists, log in to accept the invitation")
+	ErrInvitationEmail    = errors.New("invitation was sent to another email")
+)
+
+// InvitationPolicy задает параметры приглашений в организации.
+type InvitationPolicy struct {
+	TTL time.Duration
+	// LinkURL — страница приложения, принимающая ссылку приглашения. Пустое
+	// значение отключает ссылки: в письме будет только токен.
+	LinkURL string
+}
+
+// InviteOrgMember отправляет на email приглашение в организацию с ролью role.
+// Доступно администраторам организации; пригласить владельца может только владелец.
+// Токен приглашения подписывается ключом приложения, которому выдан access токен.
+// Повторное приглашение того же email заменяет прежнее.
+func (a *Auth) InviteOrgMember(ctx context.Context, accessToken string, orgID int64, email string, role models.OrgRole) (models.Invitation, error) {
+	const op = "Auth.InviteOrgMember"
+
+	log := a.log.With(
+		"op", op,
+		"orgID", orgID,
+	)
+
+	if !role.Valid() {
+		return models.Invitation{}, &ValidationError{Violations: []FieldViolation{{Field: "role", Description: orgRoleDescription}}}
+	}
+
+	caller, err := a.authenticateClaims(ctx, accessToken)
+	if err != nil {
+		return models.Invitation{}, err
+	}
+	callerRole, err := a.requireOrgRole(ctx, accessToken, caller.userID, orgID, models.OrgRoleAdmin)
+	if err != nil {
+		log.Warn("invitation denied", "error", err)
+		return models.Invitation{}, err
+	}
+	if !callerRole.AtLeast(role) {
+		log.Warn("invitation with higher role denied", "role", role, "callerRole", callerRole)
+		return models.Invitation{}, ErrPermissionDenied
+	}
+
+	app, err := a.appProvider.App(ctx, caller.appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.Invitation{}, ErrInvalidToken
+		}
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	email, err = emailaddr.Normalize(email)
+	if err != nil {
+		return models.Invitation{}, &ValidationError{Violations: []FieldViolation{{Field: "email", Description: "is not a valid email address"}}}
+	}
+
+	// Приглашать тех, кто уже состоит в организации, бессмысленно
+	user, err := a.usrProvider.User(ctx, email)
+	switch {
+	case err == nil:
+		if _, err := a.orgMember(ctx, orgID, user.ID); err == nil {
+			return models.Invitation{}, ErrMemberExists
+		} else if !errors.Is(err, ErrNotOrgMember) {
+			return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+		}
+	case !errors.Is(err, storage.ErrUserNotFound):
+		log.Error("failed to retrieve invited user", "error", err)
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	id, err := secret.Token(invitationIDSize)
+	if err != nil {
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	inv, err := a.invitationStorage.SaveInvitation(ctx, models.Invitation{
+		ID:        id,
+		OrgID:     orgID,
+		AppID:     app.ID,
+		Email:     email,
+		Role:      role,
+		InvitedBy: caller.userID,
+		ExpiresAt: time.Now().Add(a.invitation.TTL),
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrOrgNotFound) {
+			return models.Invitation{}, ErrOrgNotFound
+		}
+		log.Error("failed to save invitation", "error", err)
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	org, err := a.orgStorage.Organization(ctx, orgID)
+	if err != nil {
+		log.Error("failed to retrieve organization", "error", err)
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	body, err := a.invitationBody(app, org, inv)
+	if err != nil {
+		log.Error("failed to generate invitation link", "error", err)
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	err = a.sender.Send(ctx, notify.Message{
+		Channel: notify.ChannelEmail,
+		To:      inv.Email,
+		Subject: "You have been invited to " + org.Name,
+		Body:    body,
+	})
+	if err != nil {
+		log.Error("failed to send invitation email", "error", err)
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("organization invitation sent", "role", role, "callerID", caller.userID)
+	return inv, nil
+}
+
+// invitationBody формирует текст письма с приглашением: ссылку, если задан
+// LinkURL, иначе сам токен.
+func (a *Auth) invitationBody(app models.App, org models.Organization, inv models.Invitation) (string, error) {
+	token, err := jwt.NewInvitationToken(app, inv.ID, inv.ExpiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	body := fmt.Sprintf("You have been invited to join %s as %s. The invitation expires on %s.",
+		org.Name, inv.Role, inv.ExpiresAt.UTC().Format(time.RFC1123))
+
+	if a.invitation.LinkURL == "" {
+		return body + "\n\nInvitation token: " + token, nil
+	}
+
+	link, err := url.Parse(a.invitation.LinkURL)
+	if err != nil {
+		return "", err
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return body + "\n\nAccept the invitation: " + link.String(), nil
+}
+
+// ListInvitations возвращает действующие приглашения организации.
+// Доступно администраторам организации.
+func (a *Auth) ListInvitations(ctx context.Context, accessToken string, orgID int64) ([]models.Invitation, error) {
+	const op = "Auth.ListInvitations"
+
+	callerID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := a.requireOrgRole(ctx, accessToken, callerID, orgID, models.OrgRoleAdmin); err != nil {
+		return nil, err
+	}
+
+	invitations, err := a.invitationStorage.Invitations(ctx, orgID)
+	if err != nil {
+		a.log.Error("failed to list invitations", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return invitations, nil
+}
+
+// RevokeInvitation отзывает непринятое приглашение. Доступно администраторам организации.
+func (a *Auth) RevokeInvitation(ctx context.Context, accessToken string, orgID int64, invitationID string) error {
+	const op = "Auth.RevokeInvitation"
+
+	log := a.log.With(
+		"op", op,
+		"orgID", orgID,
+	)
+
+	callerID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	if _, err := a.requireOrgRole(ctx, accessToken, callerID, orgID, models.OrgRoleAdmin); err != nil {
+		log.Warn("invitation revoke denied", "error", err)
+		return err
+	}
+
+	if err := a.invitationStorage.DeleteInvitation(ctx, orgID, invitationID); err != nil {
+		if errors.Is(err, storage.ErrInvitationNotFound) {
+			return ErrInvitationNotFound
+		}
+		log.Error("failed to revoke invitation", "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("invitation revoked", "callerID", callerID)
+	return nil
+}
+
+// AcceptInvitation принимает приглашение от имени вошедшего пользователя и
+// добавляет его в организацию. Принять приглашение может только аккаунт с
+// email приглашения: иначе перехваченный токен добавлял бы в организацию
+// любой аккаунт. Токен пришел на этот email, поэтому email аккаунта становится
+// подтвержденным.
+func (a *Auth) AcceptInvitation(ctx context.Context, accessToken string, invitationToken string) (models.OrgMember, error) {
+	const op = "Auth.AcceptInvitation"
+
+	callerID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return models.OrgMember{}, err
+	}
+
+	log := a.log.With(
+		"op", op,
+		"userID", callerID,
+	)
+
+	inv, err := a.invitationByToken(ctx, invitationToken)
+	if err != nil {
+		log.Warn("invalid invitation token", "error", err)
+		return models.OrgMember{}, err
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, callerID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.OrgMember{}, ErrInvalidToken
+		}
+		return models.OrgMember{}, fmt.Errorf("%s: %v", op, err)
+	}
+	if err := checkStatus(user); err != nil {
+		log.Warn("invitation rejected by account status", "status", user.Status)
+		return models.OrgMember{}, err
+	}
+	if !strings.EqualFold(user.Email, inv.Email) {
+		log.Warn("invitation sent to another email", "invitationID", inv.ID)
+		return models.OrgMember{}, ErrInvitationEmail
+	}
+
+	member, err := a.acceptInvitation(ctx, inv, user.ID)
+	if err != nil {
+		return models.OrgMember{}, err
+	}
+
+	log.Info("invitation accepted", "orgID", member.OrgID, "role", member.Role)
+	return member, nil
+}
+
+// AcceptInvitationWithRegistration регистрирует аккаунт на email приглашения
+// через RegisterNewUser и добавляет его в организацию. Если аккаунт с таким
+// email уже есть, возвращает ErrLoginRequired: нужно войти и вызвать AcceptInvitation.
+// Выданные токены не выбирают организацию: она становится активной после SwitchOrganization.
+func (a *Auth) AcceptInvitationWithRegistration(ctx context.Context, invitationToken string, password string) (models.OrgMember, string, string, error) {
+	const op = "Auth.AcceptInvitationWithRegistration"
+
+	log := a.log.With("op", op)
+
+	inv, err := a.invitationByToken(ctx, invitationToken)
+	if err != nil {
+		log.Warn("invalid invitation token", "error", err)
+		return models.OrgMember{}, "", "", err
+	}
+
+	log = log.With("orgID", inv.OrgID)
+
+	if _, err := a.usrProvider.User(ctx, inv.Email); err == nil {
+		log.Warn("invitation email already registered")
+		return models.OrgMember{}, "", "", ErrLoginRequired
+	} else if !errors.Is(err, storage.ErrUserNotFound) {
+		return models.OrgMember{}, "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	userID, accessToken, refreshToken, err := a.RegisterNewUser(ctx, inv.Email, password, inv.AppID)
+	if err != nil {
+		var verr *ValidationError
+		if errors.As(err, &verr) {
+			return models.OrgMember{}, "", "", err
+		}
+		return models.OrgMember{}, "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	member, err := a.acceptInvitation(ctx, inv, userID)
+	if err != nil {
+		return models.OrgMember{}, "", "", err
+	}
+
+	log.Info("invitation accepted with registration", "userID", userID, "role", member.Role)
+	return member, accessToken, refreshToken, nil
+}
+
+// invitationByToken проверяет токен приглашения и возвращает действующее приглашение.
+func (a *Auth) invitationByToken(ctx context.Context, invitationToken string) (models.Invitation, error) {
+	const op = "Auth.invitationByToken"
+
+	claims, err := jwt.ParseInvitationToken(ctx, invitationToken, a.appProvider)
+	if err != nil {
+		return models.Invitation{}, ErrInvitationNotFound
+	}
+	appID, err := jwt.AppID(claims)
+	if err != nil {
+		return models.Invitation{}, ErrInvitationNotFound
+	}
+	id, _ := claims["jti"].(string)
+	if id == "" {
+		return models.Invitation{}, ErrInvitationNotFound
+	}
+
+	inv, err := a.invitationStorage.Invitation(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvitationNotFound) {
+			return models.Invitation{}, ErrInvitationNotFound
+		}
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+	if inv.AppID != appID {
+		return models.Invitation{}, ErrInvitationNotFound
+	}
+
+	return inv, nil
+}
+
+// acceptInvitation погашает приглашение и возвращает нового участника организации.
+func (a *Auth) acceptInvitation(ctx context.Context, inv models.Invitation, userID int64) (models.OrgMember, error) {
+	const op = "Auth.acceptInvitation"
+
+	if _, err := a.invitationStorage.AcceptInvitation(ctx, inv.ID, userID); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrInvitationNotFound):
+			return models.OrgMember{}, ErrInvitationNotFound
+		case errors.Is(err, storage.ErrMemberExists):
+			return models.OrgMember{}, ErrMemberExists
+		case errors.Is(err, storage.ErrUserNotFound):
+			return models.OrgMember{}, ErrInvalidToken
+		}
+		return models.OrgMember{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	member, err := a.orgStorage.OrgMember(ctx, inv.OrgID, userID)
+	if err != nil {
+		return models.OrgMember{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return member, nil
+}
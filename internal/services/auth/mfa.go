@@ -0,0 +1,399 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	jwt "github.com/1abobik1/Single-Sign-On/internal/lib/jwt"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/totp"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+// Методы аутентификации для claim amr (RFC 8176).
+const (
+	amrPassword = "pwd"
+	amrOTP      = "otp"
+	amrMFA      = "mfa"
+)
+
+// totpSkew — допустимое расхождение часов с аутентификатором в шагах TOTP.
+const totpSkew = 1
+
+var (
+	ErrMFARequired       = errors.New("mfa required")
+	ErrMFAAlreadyEnabled = errors.New("mfa already enabled")
+	ErrMFANotEnabled     = errors.New("mfa not enabled")
+	ErrInvalidMFACode    = errors.New("invalid mfa code")
+)
+
+// MFARequiredError возвращается из Login, когда у пользователя подключен второй фактор.
+// ChallengeToken нужно передать в VerifyMFA вместе с кодом.
+type MFARequiredError struct {
+	ChallengeToken string
+	Methods        []string
+}
+
+func (e *MFARequiredError) Error() string {
+	return ErrMFARequired.Error()
+}
+
+func (e *MFARequiredError) Unwrap() error {
+	return ErrMFARequired
+}
+
+// MFAPolicy задает параметры многофакторной аутентификации.
+type MFAPolicy struct {
+	// Issuer отображается в приложении-аутентификаторе.
+	Issuer       string
+	ChallengeTTL time.Duration
+	// RecoveryCodes — сколько кодов восстановления выдается при подключении.
+	RecoveryCodes int
+	// RecoveryCodesLow — при таком остатке кодов пользователь получает уведомление.
+	RecoveryCodesLow int
+	// TrustedDeviceTTL — сколько доверенное устройство входит без второго фактора.
+	// 0 отключает доверенные устройства.
+	TrustedDeviceTTL time.Duration
+}
+
+// requireMFA возвращает MFARequiredError, если у пользователя подключен TOTP
+// или зарегистрирован ключ WebAuthn, либо если первого фактора недостаточно для
+// уровня req.MinACR. Предлагаются только вторые факторы, дающие этот уровень.
+func (a *Auth) requireMFA(ctx context.Context, user models.User, app models.App, authInfo jwt.AuthInfo, req AuthRequirements) error {
+	const op = "Auth.requireMFA"
+
+	methods, err := a.mfaMethods(ctx, user.ID)
+	if err != nil {
+		a.log.Error("failed to retrieve mfa methods", "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	methods = stepUpMethods(methods, authInfo, req.MinACR)
+
+	if len(methods) == 0 {
+		if !req.satisfiedBy(authInfo.ACR) {
+			a.log.Warn("required acr not available", "userID", user.ID, "acr", authInfo.ACR, "minACR", req.MinACR)
+			return ErrInsufficientACR
+		}
+		return nil
+	}
+
+	challenge, err := jwt.NewMFAChallengeToken(user, app, a.mfa.ChallengeTTL, authInfo, req.MinACR)
+	if err != nil {
+		a.log.Error("failed to generate mfa challenge", "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	a.log.Info("mfa required", "userID", user.ID, "methods", methods)
+	return &MFARequiredError{ChallengeToken: challenge, Methods: methods}
+}
+
+// mfaMethods возвращает подключенные у пользователя вторые факторы.
+func (a *Auth) mfaMethods(ctx context.Context, userID int64) ([]string, error) {
+	var methods []string
+
+	t, err := a.mfaStorage.TOTP(ctx, userID)
+	if err != nil && !errors.Is(err, storage.ErrMFANotFound) {
+		return nil, err
+	}
+	if err == nil && t.Confirmed() {
+		methods = append(methods, amrOTP, amrRecoveryCode)
+	}
+
+	creds, err := a.webAuthnStorage.WebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(creds) > 0 {
+		methods = append(methods, amrHardwareKey)
+	}
+
+	return methods, nil
+}
+
+// EnrollTOTP создает новый секрет TOTP для владельца access токена и возвращает его
+// вместе с otpauth:// URI. Второй фактор начинает требоваться после ConfirmTOTP.
+// Access токен должен быть получен входом не раньше recentAuthMaxAge назад.
+func (a *Auth) EnrollTOTP(ctx context.Context, accessToken string) (string, string, error) {
+	const op = "Auth.EnrollTOTP"
+
+	claims, err := a.authenticateClaims(ctx, accessToken)
+	if err != nil {
+		return "", "", err
+	}
+	user := claims.user
+
+	log := a.log.With(
+		"op", op,
+		"userID", user.ID,
+	)
+
+	if err := requireRecentAuth(claims.auth, false); err != nil {
+		log.Warn("totp enrollment requested with stale authentication", "authTime", claims.auth.AuthTime)
+		return "", "", err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := a.mfaStorage.SaveTOTPSecret(ctx, user.ID, secret); err != nil {
+		if errors.Is(err, storage.ErrMFAAlreadyEnabled) {
+			log.Warn("totp already enabled")
+			return "", "", ErrMFAAlreadyEnabled
+		}
+		log.Error("failed to save totp secret", "error", err)
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("totp enrollment started")
+	return secret, totp.URI(a.mfa.Issuer, user.Email, secret), nil
+}
+
+// ConfirmTOTP завершает подключение TOTP кодом из приложения-аутентификатора
+// и возвращает коды восстановления. Коды показываются пользователю только один раз.
+func (a *Auth) ConfirmTOTP(ctx context.Context, accessToken string, code string) ([]string, error) {
+	const op = "Auth.ConfirmTOTP"
+
+	userID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := a.mfaStorage.TOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFANotFound) {
+			return nil, ErrMFANotEnabled
+		}
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	if t.Confirmed() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	if err := a.checkTOTP(ctx, t, code); err != nil {
+		return nil, err
+	}
+
+	// Коды выпускаются только после проверки кода: иначе любой запрос с
+	// украденным access токеном заменял бы действующие коды восстановления.
+	// Если выпуск не удался, TOTP уже подключен и коды можно получить через
+	// RegenerateRecoveryCodes.
+	codes, err := a.issueRecoveryCodes(ctx, userID)
+	if err != nil {
+		a.log.Error("failed to issue recovery codes", "op", op, "userID", userID, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	a.log.Info("totp enabled", "op", op, "userID", userID)
+	return codes, nil
+}
+
+// DisableTOTP отключает TOTP. Требуется действующий код TOTP или код
+// восстановления, чтобы украденный access токен не позволял снять второй фактор,
+// и вход не раньше recentAuthMaxAge назад. Неверные коды учитываются в блокировке
+// аккаунта так же, как в VerifyMFA.
+func (a *Auth) DisableTOTP(ctx context.Context, accessToken string, code string) error {
+	const op = "Auth.DisableTOTP"
+
+	claims, err := a.authenticateClaims(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	user := claims.user
+	userID := user.ID
+
+	if err := requireRecentAuth(claims.auth, false); err != nil {
+		a.log.Warn("totp disable requested with stale authentication", "op", op, "userID", userID, "authTime", claims.auth.AuthTime)
+		return err
+	}
+
+	t, err := a.mfaStorage.TOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFANotFound) {
+			return ErrMFANotEnabled
+		}
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	if t.Confirmed() {
+		if err := a.checkMFACode(ctx, t, user, code); err != nil {
+			if errors.Is(err, ErrInvalidMFACode) {
+				a.log.Warn("invalid mfa code", "op", op, "userID", userID)
+				return a.registerFailedMFA(ctx, user)
+			}
+			return err
+		}
+	}
+
+	if err := a.mfaStorage.DeleteTOTP(ctx, userID); err != nil && !errors.Is(err, storage.ErrMFANotFound) {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	a.log.Info("totp disabled", "op", op, "userID", userID)
+	return nil
+}
+
+// VerifyMFA завершает вход вторым фактором и выпускает токены. code — код TOTP
+// или одноразовый код восстановления. Неверные коды учитываются в блокировке
+// аккаунта так же, как неверные пароли.
+func (a *Auth) VerifyMFA(ctx context.Context, challengeToken string, code string) (string, string, error) {
+	const op = "Auth.VerifyMFA"
+
+	challenge, err := a.mfaChallenge(ctx, challengeToken)
+	if err != nil {
+		return "", "", err
+	}
+	user := challenge.user
+
+	log := a.log.With(
+		"op", op,
+		"userID", user.ID,
+	)
+
+	t, err := a.mfaStorage.TOTP(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFANotFound) {
+			return "", "", ErrMFANotEnabled
+		}
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	if !t.Confirmed() {
+		return "", "", ErrMFANotEnabled
+	}
+
+	method := amrOTP
+	if !isTOTPCode(code) {
+		method = amrRecoveryCode
+	}
+
+	authInfo, err := challenge.complete(method)
+	if err != nil {
+		log.Warn("mfa method does not reach required acr", "method", method)
+		return "", "", err
+	}
+
+	if method == amrOTP {
+		err = a.checkTOTP(ctx, t, code)
+	} else {
+		err = a.useRecoveryCode(ctx, user, code)
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			log.Warn("invalid mfa code", "method", method)
+			return "", "", a.registerFailedMFA(ctx, user)
+		}
+		return "", "", err
+	}
+
+	accessToken, refreshToken, err := a.issueTokens(ctx, user, challenge.app, authInfo)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("mfa verified, user logged in")
+	return accessToken, refreshToken, nil
+}
+
+// mfaChallengeInfo — проверенный токен MFA-проверки.
+type mfaChallengeInfo struct {
+	user        models.User
+	app         models.App
+	auth        jwt.AuthInfo
+	requiredACR string
+}
+
+// complete возвращает сведения об аутентификации после второго фактора method.
+// Если method не дает требуемого уровня, возвращает ErrInsufficientACR.
+func (c mfaChallengeInfo) complete(method string) (jwt.AuthInfo, error) {
+	info := withSecondFactor(c.auth, method)
+	if !(AuthRequirements{MinACR: c.requiredACR}).satisfiedBy(info.ACR) {
+		return jwt.AuthInfo{}, ErrInsufficientACR
+	}
+
+	return info, nil
+}
+
+// mfaChallenge проверяет токен MFA-проверки и что пользователю по-прежнему разрешен вход.
+func (a *Auth) mfaChallenge(ctx context.Context, challengeToken string) (mfaChallengeInfo, error) {
+	const op = "Auth.mfaChallenge"
+
+	claims, err := jwt.ParseMFAChallengeToken(ctx, challengeToken, a.appProvider)
+	if err != nil {
+		return mfaChallengeInfo{}, ErrInvalidToken
+	}
+	userID, err := jwt.UserID(claims)
+	if err != nil {
+		return mfaChallengeInfo{}, ErrInvalidToken
+	}
+	appID, err := jwt.AppID(claims)
+	if err != nil {
+		return mfaChallengeInfo{}, ErrInvalidToken
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return mfaChallengeInfo{}, ErrInvalidToken
+		}
+		return mfaChallengeInfo{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if now := time.Now(); user.LockedUntil.After(now) {
+		a.log.Warn("account is locked", "op", op, "userID", userID, "lockedUntil", user.LockedUntil)
+		return mfaChallengeInfo{}, &LockedError{RetryAfter: user.LockedUntil.Sub(now)}
+	}
+	if err := checkStatus(user); err != nil {
+		return mfaChallengeInfo{}, err
+	}
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		return mfaChallengeInfo{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return mfaChallengeInfo{user: user, app: app, auth: jwt.Auth(claims), requiredACR: jwt.RequiredACR(claims)}, nil
+}
+
+// checkTOTP проверяет код и запоминает его шаг, чтобы код нельзя было использовать повторно.
+func (a *Auth) checkTOTP(ctx context.Context, t models.TOTP, code string) error {
+	const op = "Auth.checkTOTP"
+
+	step, ok := totp.Validate(t.Secret, code, time.Now(), totpSkew)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	fresh, err := a.mfaStorage.UseTOTPStep(ctx, t.UserID, step)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if !fresh {
+		return ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// checkMFACode проверяет код TOTP или погашает код восстановления, если код
+// не похож на код TOTP.
+func (a *Auth) checkMFACode(ctx context.Context, t models.TOTP, user models.User, code string) error {
+	if isTOTPCode(code) {
+		return a.checkTOTP(ctx, t, code)
+	}
+
+	return a.useRecoveryCode(ctx, user, code)
+}
+
+// registerFailedMFA учитывает неверный код второго фактора как неудачную попытку входа.
+func (a *Auth) registerFailedMFA(ctx context.Context, user models.User) error {
+	err := a.registerFailedLogin(ctx, user)
+	if errors.Is(err, ErrInvalidCredentials) {
+		return ErrInvalidMFACode
+	}
+
+	return err
+}
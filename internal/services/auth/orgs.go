@@ -0,0 +1,393 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	jwt "github.com/1abobik1/Single-Sign-On/internal/lib/jwt"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+const (
+	maxOrgNameLen      = 128
+	orgRoleDescription = "must be one of owner, admin, member"
+)
+
+var (
+	ErrOrgExists    = errors.New("organization already exists")
+	ErrOrgNotFound  = errors.New("organization not found")
+	ErrMemberExists = errors.New("user is already a member of the organization")
+	ErrNotOrgMember = errors.New("user is not a member of the organization")
+	ErrLastOrgOwner = errors.New("organization must keep at least one owner")
+)
+
+var orgSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}[a-z0-9]$`)
+
+// CreateOrganization создает организацию, владельцем которой становится вызывающий.
+func (a *Auth) CreateOrganization(ctx context.Context, accessToken string, name string, slug string) (models.Organization, error) {
+	const op = "Auth.CreateOrganization"
+
+	callerID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return models.Organization{}, err
+	}
+
+	log := a.log.With(
+		"op", op,
+		"userID", callerID,
+		"slug", slug,
+	)
+
+	org := models.Organization{
+		Name: strings.TrimSpace(name),
+		Slug: strings.ToLower(strings.TrimSpace(slug)),
+	}
+
+	verr := &ValidationError{}
+	if org.Name == "" || utf8.RuneCountInString(org.Name) > maxOrgNameLen {
+		verr.Violations = append(verr.Violations, FieldViolation{
+			Field:       "name",
+			Description: fmt.Sprintf("must be 1-%d characters", maxOrgNameLen),
+		})
+	}
+	if !orgSlugPattern.MatchString(org.Slug) {
+		verr.Violations = append(verr.Violations, FieldViolation{
+			Field:       "slug",
+			Description: "must be 3-64 lowercase letters, digits or '-', not starting or ending with '-'",
+		})
+	}
+	if len(verr.Violations) > 0 {
+		return models.Organization{}, verr
+	}
+
+	org, err = a.orgStorage.CreateOrganization(ctx, org, callerID)
+	if err != nil {
+		if errors.Is(err, storage.ErrOrgExists) {
+			log.Warn("organization slug taken")
+			return models.Organization{}, ErrOrgExists
+		}
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.Organization{}, ErrInvalidToken
+		}
+		log.Error("failed to create organization", "error", err)
+		return models.Organization{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("organization created", "orgID", org.ID)
+	return org, nil
+}
+
+// ListOrganizations возвращает организации вызывающего и его роли в них.
+func (a *Auth) ListOrganizations(ctx context.Context, accessToken string) ([]models.Membership, error) {
+	const op = "Auth.ListOrganizations"
+
+	callerID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, err := a.orgStorage.UserOrganizations(ctx, callerID)
+	if err != nil {
+		a.log.Error("failed to list organizations", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return memberships, nil
+}
+
+// ListOrgMembers возвращает участников организации. Доступно любому участнику.
+func (a *Auth) ListOrgMembers(ctx context.Context, accessToken string, orgID int64) ([]models.OrgMember, error) {
+	const op = "Auth.ListOrgMembers"
+
+	callerID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := a.requireOrgRole(ctx, accessToken, callerID, orgID, models.OrgRoleMember); err != nil {
+		return nil, err
+	}
+
+	members, err := a.orgStorage.OrgMembers(ctx, orgID)
+	if err != nil {
+		a.log.Error("failed to list organization members", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return members, nil
+}
+
+// AddOrgMember добавляет пользователя в организацию с ролью role без его
+// согласия, поэтому доступно только администраторам сервиса. Администраторы
+// организации приглашают участников через InviteOrgMember: иначе они могли бы
+// добавлять кого угодно и перебором ID узнавать, какие пользователи существуют.
+func (a *Auth) AddOrgMember(ctx context.Context, accessToken string, orgID int64, userID int64, role models.OrgRole) (models.OrgMember, error) {
+	const op = "Auth.AddOrgMember"
+
+	log := a.log.With(
+		"op", op,
+		"orgID", orgID,
+		"userID", userID,
+	)
+
+	if !role.Valid() {
+		return models.OrgMember{}, &ValidationError{Violations: []FieldViolation{{Field: "role", Description: orgRoleDescription}}}
+	}
+
+	callerID, err := a.requireAdmin(ctx, accessToken)
+	if err != nil {
+		log.Warn("adding member denied", "error", err)
+		return models.OrgMember{}, err
+	}
+
+	if err := a.orgStorage.AddOrgMember(ctx, orgID, userID, role); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrMemberExists):
+			return models.OrgMember{}, ErrMemberExists
+		case errors.Is(err, storage.ErrUserNotFound):
+			return models.OrgMember{}, storage.ErrUserNotFound
+		case errors.Is(err, storage.ErrOrgNotFound):
+			return models.OrgMember{}, ErrOrgNotFound
+		}
+		log.Error("failed to add organization member", "error", err)
+		return models.OrgMember{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	member, err := a.orgStorage.OrgMember(ctx, orgID, userID)
+	if err != nil {
+		log.Error("failed to retrieve added member", "error", err)
+		return models.OrgMember{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("organization member added", "role", role, "callerID", callerID)
+	return member, nil
+}
+
+// UpdateOrgMemberRole меняет роль участника. Назначить или снять роль владельца
+// может только владелец; последнего владельца понизить нельзя.
+func (a *Auth) UpdateOrgMemberRole(ctx context.Context, accessToken string, orgID int64, userID int64, role models.OrgRole) (models.OrgMember, error) {
+	const op = "Auth.UpdateOrgMemberRole"
+
+	log := a.log.With(
+		"op", op,
+		"orgID", orgID,
+		"userID", userID,
+	)
+
+	if !role.Valid() {
+		return models.OrgMember{}, &ValidationError{Violations: []FieldViolation{{Field: "role", Description: orgRoleDescription}}}
+	}
+
+	callerID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return models.OrgMember{}, err
+	}
+	callerRole, err := a.requireOrgRole(ctx, accessToken, callerID, orgID, models.OrgRoleAdmin)
+	if err != nil {
+		log.Warn("role change denied", "error", err)
+		return models.OrgMember{}, err
+	}
+
+	member, err := a.orgMember(ctx, orgID, userID)
+	if err != nil {
+		return models.OrgMember{}, err
+	}
+	if !callerRole.AtLeast(role) || !callerRole.AtLeast(member.Role) {
+		log.Warn("role change above caller role denied", "role", role, "callerRole", callerRole)
+		return models.OrgMember{}, ErrPermissionDenied
+	}
+
+	if err := a.orgStorage.UpdateOrgMemberRole(ctx, orgID, userID, role); err != nil {
+		if err := orgMemberError(err); err != nil {
+			return models.OrgMember{}, err
+		}
+		log.Error("failed to update member role", "error", err)
+		return models.OrgMember{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("organization member role changed", "from", member.Role, "to", role, "callerID", callerID)
+	member.Role = role
+	return member, nil
+}
+
+// RemoveOrgMember удаляет участника из организации. Администраторы удаляют
+// участников, владельца может удалить только владелец; любой участник может выйти сам.
+func (a *Auth) RemoveOrgMember(ctx context.Context, accessToken string, orgID int64, userID int64) error {
+	const op = "Auth.RemoveOrgMember"
+
+	log := a.log.With(
+		"op", op,
+		"orgID", orgID,
+		"userID", userID,
+	)
+
+	callerID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+
+	// Выйти из организации может любой участник
+	minRole := models.OrgRoleAdmin
+	if callerID == userID {
+		minRole = models.OrgRoleMember
+	}
+
+	callerRole, err := a.requireOrgRole(ctx, accessToken, callerID, orgID, minRole)
+	if err != nil {
+		log.Warn("member removal denied", "error", err)
+		return err
+	}
+
+	member, err := a.orgMember(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if callerID != userID && !callerRole.AtLeast(member.Role) {
+		log.Warn("removing member with higher role denied", "role", member.Role, "callerRole", callerRole)
+		return ErrPermissionDenied
+	}
+
+	if err := a.orgStorage.RemoveOrgMember(ctx, orgID, userID); err != nil {
+		if err := orgMemberError(err); err != nil {
+			return err
+		}
+		log.Error("failed to remove organization member", "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("organization member removed", "callerID", callerID)
+	return nil
+}
+
+// SwitchOrganization выпускает токены сессии с активной организацией orgID.
+// orgID = 0 — токены без организации.
+func (a *Auth) SwitchOrganization(ctx context.Context, refreshToken string, appID int, orgID int64) (string, string, error) {
+	const op = "Auth.SwitchOrganization"
+
+	session, err := a.refreshSession(ctx, refreshToken, appID)
+	if err != nil {
+		return "", "", err
+	}
+
+	log := a.log.With(
+		"op", op,
+		"userID", session.user.ID,
+		"orgID", orgID,
+	)
+
+	if orgID != 0 {
+		if _, err := a.orgMember(ctx, orgID, session.user.ID); err != nil {
+			if errors.Is(err, ErrNotOrgMember) {
+				// Чужая организация неотличима от несуществующей
+				log.Warn("switch to organization without membership")
+				return "", "", ErrOrgNotFound
+			}
+			return "", "", err
+		}
+	}
+
+	authInfo := session.auth
+	authInfo.OrgID = orgID
+
+	accessToken, newRefreshToken, err := a.issueTokens(ctx, session.user, session.app, authInfo)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("active organization switched")
+	return accessToken, newRefreshToken, nil
+}
+
+// requireOrgRole проверяет, что вызывающий состоит в организации с ролью не ниже
+// min, и возвращает его роль. Глобальный администратор действует как владелец
+// любой организации. Для не-участников организация считается несуществующей.
+func (a *Auth) requireOrgRole(ctx context.Context, accessToken string, callerID int64, orgID int64, min models.OrgRole) (models.OrgRole, error) {
+	const op = "Auth.requireOrgRole"
+
+	member, err := a.orgMember(ctx, orgID, callerID)
+	if err != nil && !errors.Is(err, ErrNotOrgMember) {
+		return "", err
+	}
+	if err == nil && member.Role.AtLeast(min) {
+		return member.Role, nil
+	}
+
+	// Права администратора проверяются как в requireAdmin: токен
+	// недоверенного приложения их не дает
+	_, err = a.authorize(ctx, accessToken, 0, PermissionAdmin)
+	switch {
+	case err == nil:
+		if _, err := a.orgStorage.Organization(ctx, orgID); err != nil {
+			if errors.Is(err, storage.ErrOrgNotFound) {
+				return "", ErrOrgNotFound
+			}
+			return "", fmt.Errorf("%s: %v", op, err)
+		}
+		return models.OrgRoleOwner, nil
+	case !errors.Is(err, ErrPermissionDenied):
+		return "", err
+	}
+
+	if member.Role == "" {
+		return "", ErrOrgNotFound
+	}
+	return "", ErrPermissionDenied
+}
+
+// orgMember возвращает участника организации или ErrNotOrgMember.
+func (a *Auth) orgMember(ctx context.Context, orgID int64, userID int64) (models.OrgMember, error) {
+	const op = "Auth.orgMember"
+
+	member, err := a.orgStorage.OrgMember(ctx, orgID, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMemberNotFound) {
+			return models.OrgMember{}, ErrNotOrgMember
+		}
+		return models.OrgMember{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return member, nil
+}
+
+// accessGrants дополняет роли пользователя в приложении его ролью в активной
+// организации. Если пользователь больше не состоит в ней, организация снимается с сессии.
+func (a *Auth) accessGrants(ctx context.Context, userID int64, appID int, authInfo jwt.AuthInfo) (jwt.AuthInfo, jwt.Grants, error) {
+	grants, err := a.grants(ctx, userID, appID)
+	if err != nil {
+		return jwt.AuthInfo{}, jwt.Grants{}, err
+	}
+
+	if authInfo.OrgID != 0 {
+		member, err := a.orgMember(ctx, authInfo.OrgID, userID)
+		switch {
+		case errors.Is(err, ErrNotOrgMember):
+			a.log.Info("active organization dropped: membership removed", "userID", userID, "orgID", authInfo.OrgID)
+			authInfo.OrgID = 0
+		case err != nil:
+			return jwt.AuthInfo{}, jwt.Grants{}, err
+		default:
+			grants.OrgRole = string(member.Role)
+		}
+	}
+
+	return authInfo, grants, nil
+}
+
+// orgMemberError переводит ошибки изменения участника в ошибки сервиса.
+// Для прочих ошибок возвращает nil.
+func orgMemberError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrOrgNotFound):
+		return ErrOrgNotFound
+	case errors.Is(err, storage.ErrMemberNotFound):
+		return ErrNotOrgMember
+	case errors.Is(err, storage.ErrLastOwner):
+		return ErrLastOrgOwner
+	}
+
+	return nil
+}
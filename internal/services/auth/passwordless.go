@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	emailaddr "github.com/1abobik1/Single-Sign-On/internal/lib/email"
+	jwt "github.com/1abobik1/Single-Sign-On/internal/lib/jwt"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/notify"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/secret"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+const passwordlessRequestIDSize = 24
+
+var (
+	ErrTooManyRequests = errors.New("too many requests")
+)
+
+// PasswordlessPolicy задает параметры входа без пароля.
+type PasswordlessPolicy struct {
+	CodeTTL time.Duration
+	// MaxAttempts — сколько раз можно ввести неверный код одного запроса.
+	MaxAttempts int
+	// MaxRequests — сколько писем со входом пользователь может запросить за RequestWindow.
+	MaxRequests   int
+	RequestWindow time.Duration
+	// LinkURL — страница приложения, принимающая ссылку входа. Пустое значение
+	// отключает ссылки: в письме будет только код.
+	LinkURL string
+}
+
+// StartPasswordlessLogin отправляет на email одноразовый код и ссылку для входа
+// и возвращает ID запроса, который нужно передать в CompletePasswordlessLogin.
+// Для неизвестного email, заблокированного аккаунта и при превышении лимита
+// писем письмо не отправляется, но ответ не отличается, чтобы по нему нельзя
+// было проверить наличие аккаунта.
+func (a *Auth) StartPasswordlessLogin(ctx context.Context, email string, appID int) (string, error) {
+	const op = "Auth.StartPasswordlessLogin"
+
+	log := a.log.With(
+		"op", op,
+		"appID", appID,
+	)
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return "", storage.ErrAppNotFound
+		}
+		return "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	email, err = emailaddr.Normalize(email)
+	if err != nil {
+		return "", &ValidationError{Violations: []FieldViolation{{Field: "email", Description: "is not a valid email address"}}}
+	}
+
+	requestID, err := secret.Token(passwordlessRequestIDSize)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	user, err := a.userByLogin(ctx, email, app)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("passwordless login requested for unknown email")
+			return requestID, nil
+		}
+		log.Error("failed to retrieve user", "error", err)
+		return "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	log = log.With("userID", user.ID)
+
+	if now := time.Now(); user.LockedUntil.After(now) {
+		log.Warn("account is locked, passwordless login email suppressed", "lockedUntil", user.LockedUntil)
+		return requestID, nil
+	}
+
+	if a.passwordless.MaxRequests > 0 {
+		sent, err := a.passwordlessStorage.CountPasswordlessLogins(ctx, user.ID, time.Now().Add(-a.passwordless.RequestWindow))
+		if err != nil {
+			log.Error("failed to count passwordless logins", "error", err)
+			return "", fmt.Errorf("%s: %v", op, err)
+		}
+		if sent >= a.passwordless.MaxRequests {
+			log.Warn("passwordless login rate limited, email suppressed", "sent", sent)
+			return requestID, nil
+		}
+	}
+
+	code, err := secret.NumericCode(verificationCodeDigits)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	login := models.PasswordlessLogin{
+		ID:        requestID,
+		UserID:    user.ID,
+		AppID:     app.ID,
+		ExpiresAt: time.Now().Add(a.passwordless.CodeTTL),
+	}
+	if err := a.passwordlessStorage.SavePasswordlessLogin(ctx, login, secret.Hash(code)); err != nil {
+		log.Error("failed to save passwordless login", "error", err)
+		return "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	body := fmt.Sprintf("Your sign-in code: %s. It expires in %d minutes.", code, int(a.passwordless.CodeTTL.Minutes()))
+	if a.passwordless.LinkURL != "" {
+		link, err := a.magicLink(user, app, requestID)
+		if err != nil {
+			log.Error("failed to generate magic link", "error", err)
+			return "", fmt.Errorf("%s: %v", op, err)
+		}
+		body += "\n\nOr sign in with this link: " + link
+	}
+
+	err = a.sender.Send(ctx, notify.Message{
+		Channel: notify.ChannelEmail,
+		To:      user.Email,
+		Subject: "Your sign-in code",
+		Body:    body,
+	})
+	if err != nil {
+		log.Error("failed to send passwordless login email", "error", err)
+		return "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("passwordless login started")
+	return requestID, nil
+}
+
+// magicLink формирует ссылку входа с подписанным токеном.
+func (a *Auth) magicLink(user models.User, app models.App, requestID string) (string, error) {
+	token, err := jwt.NewMagicLinkToken(user, app, a.passwordless.CodeTTL, requestID)
+	if err != nil {
+		return "", err
+	}
+
+	link, err := url.Parse(a.passwordless.LinkURL)
+	if err != nil {
+		return "", err
+	}
+
+	query := link.Query()
+	query.Set("request_id", requestID)
+	query.Set("code", token)
+	link.RawQuery = query.Encode()
+
+	return link.String(), nil
+}
+
+// CompletePasswordlessLogin завершает вход без пароля кодом из письма или токеном
+// из ссылки и выпускает токены. Если у пользователя подключен второй фактор или
+// его требует приложение, возвращает MFARequiredError.
+func (a *Auth) CompletePasswordlessLogin(ctx context.Context, requestID string, code string, appID int, req AuthRequirements) (string, string, error) {
+	const op = "Auth.CompletePasswordlessLogin"
+
+	log := a.log.With(
+		"op", op,
+		"appID", appID,
+	)
+
+	if err := req.validate(); err != nil {
+		return "", "", err
+	}
+
+	// Scope проверяются до того, как будет погашен одноразовый запрос входа
+	scope, err := a.grantScope(ctx, appID, req.Scope)
+	if err != nil {
+		if errors.Is(err, ErrInvalidScope) {
+			log.Warn("requested scope not allowed", "error", err)
+			return "", "", err
+		}
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	if requestID == "" || code == "" {
+		return "", "", ErrInvalidCode
+	}
+
+	// Код из письма сверяется с хешем в БД, токен из ссылки проверяется по подписи
+	var codeHash []byte
+	if isTOTPCode(code) {
+		codeHash = secret.Hash(code)
+	} else {
+		claims, err := jwt.ParseMagicLinkToken(ctx, code, a.appProvider)
+		if err != nil {
+			log.Warn("invalid magic link token")
+			return "", "", ErrInvalidCode
+		}
+		if tokenAppID, err := jwt.AppID(claims); err != nil || tokenAppID != appID || claims["jti"] != requestID {
+			log.Warn("magic link token issued for another request")
+			return "", "", ErrInvalidCode
+		}
+	}
+
+	login, ok, err := a.passwordlessStorage.ConsumePasswordlessLogin(ctx, requestID, codeHash, a.passwordless.MaxAttempts)
+	if err != nil {
+		if errors.Is(err, storage.ErrPasswordlessLoginNotFound) {
+			return "", "", ErrInvalidCode
+		}
+		log.Error("failed to consume passwordless login", "error", err)
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+	if !ok {
+		log.Warn("invalid passwordless login code")
+		return "", "", ErrInvalidCode
+	}
+	if login.AppID != appID {
+		log.Warn("passwordless login requested by another app", "requestAppID", login.AppID)
+		return "", "", ErrInvalidCode
+	}
+
+	log = log.With("userID", login.UserID)
+
+	user, err := a.usrProvider.UserByID(ctx, login.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", "", ErrInvalidCode
+		}
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	if now := time.Now(); user.LockedUntil.After(now) {
+		log.Warn("account is locked", "lockedUntil", user.LockedUntil)
+		return "", "", &LockedError{RetryAfter: user.LockedUntil.Sub(now)}
+	}
+	if err := checkStatus(user); err != nil {
+		log.Warn("login rejected by account status", "status", user.Status)
+		return "", "", err
+	}
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	// Код и ссылка из письма — один фактор, как и пароль
+	authInfo := newAuthInfo(amrOTP)
+	authInfo.Scope = scope
+
+	if err := a.requireMFA(ctx, user, app, authInfo, req); err != nil {
+		return "", "", err
+	}
+
+	accessToken, refreshToken, err := a.issueTokens(ctx, user, app, authInfo)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("user logged in without password")
+	return accessToken, refreshToken, nil
+}
@@ -0,0 +1,322 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/policy"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+// PermissionManagePolicies разрешает создавать и удалять политики доступа приложения.
+const PermissionManagePolicies = "sso:policies:manage"
+
+const (
+	maxAttributes        = 32
+	maxAttributeValueLen = 256
+	maxPolicyDocumentLen = 64 << 10
+)
+
+var (
+	ErrPolicyNotFound = errors.New("policy not found")
+)
+
+var attributeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// Атрибуты subject.*, которые берутся из учетной записи и не могут быть заданы
+// в атрибутах пользователя.
+var subjectBuiltins = map[string]struct{}{
+	"id": {}, "email": {}, "status": {}, "display_name": {}, "given_name": {},
+	"family_name": {}, "locale": {}, "timezone": {},
+}
+
+// Атрибуты context.*, которые вычисляет сервер; значения вызывающего для них игнорируются.
+var contextBuiltins = map[string]struct{}{
+	"time": {}, "date": {}, "hour": {}, "weekday": {},
+}
+
+// PutPolicy создает политику доступа приложения appID или заменяет политику с
+// тем же ID. document — одна политика в формате internal/lib/policy. Разрешающая
+// политика может выдавать только разрешения, которые есть у вызывающего.
+func (a *Auth) PutPolicy(ctx context.Context, accessToken string, appID int, document []byte) (models.Policy, error) {
+	const op = "Auth.PutPolicy"
+
+	log := a.log.With(
+		"op", op,
+		"appID", appID,
+	)
+
+	callerID, err := a.authorize(ctx, accessToken, appID, PermissionManagePolicies)
+	if err != nil {
+		log.Warn("policy change denied", "error", err)
+		return models.Policy{}, err
+	}
+
+	p, err := parsePolicyDocument(document, appID)
+	if err != nil {
+		return models.Policy{}, err
+	}
+
+	// Разрешающая политика выдает разрешения без роли, поэтому к ней применяются
+	// те же ограничения, что и к ролям
+	if p.Effect == policy.EffectAllow {
+		if err := a.authorizePolicyGrant(ctx, callerID, appID, p.Permissions); err != nil {
+			log.Warn("allow policy exceeds caller permissions", "policy", p.ID, "error", err)
+			return models.Policy{}, err
+		}
+	}
+
+	saved, err := a.policyStorage.SavePolicy(ctx, models.Policy{AppID: appID, Name: p.ID, Document: document})
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.Policy{}, storage.ErrAppNotFound
+		}
+		log.Error("failed to save policy", "error", err)
+		return models.Policy{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("policy saved", "policy", saved.Name, "effect", p.Effect, "callerID", callerID)
+	return saved, nil
+}
+
+// authorizePolicyGrant проверяет, что вызывающий может выдать разрешения
+// разрешающей политики. Шаблоны ("*", "orders:*") покрывают и разрешения, которых
+// у вызывающего нет, в том числе еще не созданные, поэтому их может задать
+// только администратор.
+func (a *Auth) authorizePolicyGrant(ctx context.Context, callerID int64, appID int, permissions []string) error {
+	if slices.ContainsFunc(permissions, func(p string) bool { return strings.HasSuffix(p, "*") }) {
+		permissions = []string{PermissionAdmin}
+	}
+
+	return a.authorizeGrant(ctx, callerID, appID, permissions)
+}
+
+// DeletePolicy удаляет политику доступа приложения.
+func (a *Auth) DeletePolicy(ctx context.Context, accessToken string, appID int, name string) error {
+	const op = "Auth.DeletePolicy"
+
+	log := a.log.With(
+		"op", op,
+		"appID", appID,
+		"policy", name,
+	)
+
+	callerID, err := a.authorize(ctx, accessToken, appID, PermissionManagePolicies)
+	if err != nil {
+		log.Warn("policy deletion denied", "error", err)
+		return err
+	}
+
+	if err := a.policyStorage.DeletePolicy(ctx, appID, name); err != nil {
+		if errors.Is(err, storage.ErrPolicyNotFound) {
+			return ErrPolicyNotFound
+		}
+		log.Error("failed to delete policy", "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("policy deleted", "callerID", callerID)
+	return nil
+}
+
+// ListPolicies возвращает политики доступа приложения, хранимые в БД. Политики
+// из файлов конфигурации сюда не входят.
+func (a *Auth) ListPolicies(ctx context.Context, accessToken string, appID int) ([]models.Policy, error) {
+	const op = "Auth.ListPolicies"
+
+	if _, err := a.authorize(ctx, accessToken, appID, PermissionManagePolicies); err != nil {
+		return nil, err
+	}
+
+	policies, err := a.policyStorage.Policies(ctx, appID)
+	if err != nil {
+		a.log.Error("failed to list policies", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return policies, nil
+}
+
+// SetUserAttributes заменяет атрибуты пользователя, доступные политикам как
+// subject.<name>. Доступно только администраторам.
+func (a *Auth) SetUserAttributes(ctx context.Context, accessToken string, userID int64, attributes map[string]string) (models.User, error) {
+	const op = "Auth.SetUserAttributes"
+
+	log := a.log.With(
+		"op", op,
+		"userID", userID,
+	)
+
+	adminID, err := a.requireAdmin(ctx, accessToken)
+	if err != nil {
+		log.Warn("attributes change denied", "error", err)
+		return models.User{}, err
+	}
+
+	verr := &ValidationError{Violations: validateAttributes("attributes", attributes)}
+	for name := range attributes {
+		if _, ok := subjectBuiltins[name]; ok {
+			verr.Violations = append(verr.Violations, FieldViolation{
+				Field:       "attributes." + name,
+				Description: "is reserved for an account attribute",
+			})
+		}
+	}
+	if len(verr.Violations) > 0 {
+		return models.User{}, verr
+	}
+
+	user, err := a.usrSaver.SetUserAttributes(ctx, userID, attributes)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.User{}, storage.ErrUserNotFound
+		}
+		log.Error("failed to set user attributes", "error", err)
+		return models.User{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("user attributes changed", "attributes", len(attributes), "adminID", adminID)
+	return user, nil
+}
+
+// appPolicies возвращает политики, применимые к проверкам приложения: из
+// конфигурации (общие и для appID) и хранимые в БД.
+func (a *Auth) appPolicies(ctx context.Context, appID int) ([]policy.Policy, error) {
+	const op = "Auth.appPolicies"
+
+	var policies []policy.Policy
+	for _, p := range a.authorization.Policies {
+		if p.AppID == 0 || p.AppID == appID {
+			policies = append(policies, p)
+		}
+	}
+
+	stored, err := a.policyStorage.Policies(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	for _, sp := range stored {
+		parsed, err := policy.Parse(sp.Document)
+		if err != nil || len(parsed) != 1 {
+			return nil, fmt.Errorf("%s: stored policy %q: %v", op, sp.Name, err)
+		}
+		policies = append(policies, parsed[0])
+	}
+
+	return policies, nil
+}
+
+// parsePolicyDocument проверяет документ одной политики приложения appID.
+func parsePolicyDocument(document []byte, appID int) (policy.Policy, error) {
+	if len(document) > maxPolicyDocumentLen {
+		return policy.Policy{}, &ValidationError{Violations: []FieldViolation{{
+			Field:       "document",
+			Description: fmt.Sprintf("must be at most %d bytes", maxPolicyDocumentLen),
+		}}}
+	}
+
+	parsed, err := policy.Parse(document)
+	if err != nil {
+		return policy.Policy{}, &ValidationError{Violations: []FieldViolation{{Field: "document", Description: err.Error()}}}
+	}
+	if len(parsed) != 1 {
+		return policy.Policy{}, &ValidationError{Violations: []FieldViolation{{Field: "document", Description: "must contain exactly one policy"}}}
+	}
+
+	p := parsed[0]
+	verr := &ValidationError{}
+	if !roleNamePattern.MatchString(p.ID) {
+		verr.Violations = append(verr.Violations, FieldViolation{
+			Field:       "document.id",
+			Description: "must be 1-64 lowercase letters, digits, '_', '.' or '-'",
+		})
+	}
+	if p.AppID != 0 && p.AppID != appID {
+		verr.Violations = append(verr.Violations, FieldViolation{
+			Field:       "document.app_id",
+			Description: "must be empty or match app_id",
+		})
+	}
+	if len(verr.Violations) > 0 {
+		return policy.Policy{}, verr
+	}
+
+	return p, nil
+}
+
+// validateAttributes проверяет имена и значения атрибутов для политик.
+func validateAttributes(field string, attributes map[string]string) []FieldViolation {
+	var violations []FieldViolation
+
+	if len(attributes) > maxAttributes {
+		violations = append(violations, FieldViolation{
+			Field:       field,
+			Description: fmt.Sprintf("must contain at most %d attributes", maxAttributes),
+		})
+	}
+	for name, value := range attributes {
+		if !attributeNamePattern.MatchString(name) {
+			violations = append(violations, FieldViolation{
+				Field:       field,
+				Description: fmt.Sprintf("attribute name %q must be 1-64 lowercase letters, digits or '_', starting with a letter", name),
+			})
+		}
+		if utf8.RuneCountInString(value) > maxAttributeValueLen {
+			violations = append(violations, FieldViolation{
+				Field:       field + "." + name,
+				Description: fmt.Sprintf("must be at most %d characters", maxAttributeValueLen),
+			})
+		}
+	}
+
+	return violations
+}
+
+// subjectAttributes возвращает атрибуты subject.* пользователя.
+func subjectAttributes(user models.User) policy.Attributes {
+	attrs := make(policy.Attributes, len(user.Attributes)+len(subjectBuiltins))
+	maps.Copy(attrs, user.Attributes)
+
+	attrs["id"] = strconv.FormatInt(user.ID, 10)
+	attrs["email"] = user.Email
+	attrs["status"] = string(user.EffectiveStatus(time.Now()))
+	attrs["display_name"] = user.DisplayName
+	attrs["given_name"] = user.GivenName
+	attrs["family_name"] = user.FamilyName
+	attrs["locale"] = user.Locale
+	attrs["timezone"] = user.Timezone
+
+	return attrs
+}
+
+// requestContext возвращает атрибуты context.*: переданные вызывающим и время
+// запроса в UTC. Часовой пояс профиля не используется: его меняет сам
+// пользователь, и "рабочие часы" сдвигались бы по его желанию.
+func requestContext(callerContext map[string]string, now time.Time) policy.Attributes {
+	attrs := make(policy.Attributes, len(callerContext)+len(contextBuiltins))
+	maps.Copy(attrs, callerContext)
+
+	now = now.UTC()
+
+	weekday := int(now.Weekday())
+	if weekday == 0 {
+		// ISO 8601: понедельник — 1, воскресенье — 7
+		weekday = 7
+	}
+
+	attrs["time"] = now.Format(time.RFC3339)
+	attrs["date"] = now.Format(time.DateOnly)
+	attrs["hour"] = strconv.Itoa(now.Hour())
+	attrs["weekday"] = strconv.Itoa(weekday)
+
+	return attrs
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	maxNameLength      = 100
+	maxAvatarURLLength = 2048
+	// maxLocaleLength — размер колонки users.locale.
+	maxLocaleLength = 35
+)
+
+// ProfileUpdate — изменения профиля. nil означает, что поле не меняется,
+// пустая строка — что поле очищается.
+type ProfileUpdate struct {
+	DisplayName *string
+	GivenName   *string
+	FamilyName  *string
+	Locale      *string
+	Timezone    *string
+	AvatarURL   *string
+}
+
+// GetMe возвращает пользователя, которому принадлежит access токен.
+func (a *Auth) GetMe(ctx context.Context, accessToken string) (models.User, error) {
+	claims, err := a.authenticateClaims(ctx, accessToken)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return claims.user, nil
+}
+
+// UpdateMe изменяет профиль пользователя, которому принадлежит access токен.
+func (a *Auth) UpdateMe(ctx context.Context, accessToken string, update ProfileUpdate) (models.User, error) {
+	const op = "Auth.UpdateMe"
+
+	user, err := a.GetMe(ctx, accessToken)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	log := a.log.With(
+		"op", op,
+		"userID", user.ID,
+	)
+
+	profile, err := applyProfileUpdate(user.Profile, update)
+	if err != nil {
+		log.Warn("profile update rejected", "error", err)
+		return models.User{}, err
+	}
+
+	user, err = a.usrSaver.UpdateProfile(ctx, user.ID, profile)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.User{}, ErrInvalidToken
+		}
+		log.Error("failed to update profile", "error", err)
+		return models.User{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("profile updated")
+	return user, nil
+}
+
+// applyProfileUpdate применяет изменения к профилю и проверяет результат.
+func applyProfileUpdate(profile models.Profile, update ProfileUpdate) (models.Profile, error) {
+	verr := &ValidationError{}
+
+	setName := func(field string, dst *string, src *string) {
+		if src == nil {
+			return
+		}
+		if utf8.RuneCountInString(*src) > maxNameLength {
+			verr.Violations = append(verr.Violations, FieldViolation{Field: field, Description: fmt.Sprintf("must be at most %d characters long", maxNameLength)})
+			return
+		}
+		*dst = *src
+	}
+
+	setName("display_name", &profile.DisplayName, update.DisplayName)
+	setName("given_name", &profile.GivenName, update.GivenName)
+	setName("family_name", &profile.FamilyName, update.FamilyName)
+
+	if update.Locale != nil {
+		if *update.Locale == "" {
+			profile.Locale = ""
+		} else if tag, err := language.Parse(*update.Locale); err != nil || len(*update.Locale) > maxLocaleLength || len(tag.String()) > maxLocaleLength {
+			verr.Violations = append(verr.Violations, FieldViolation{Field: "locale", Description: fmt.Sprintf("must be a BCP 47 language tag at most %d characters long", maxLocaleLength)})
+		} else {
+			profile.Locale = tag.String()
+		}
+	}
+
+	if update.Timezone != nil {
+		if *update.Timezone == "" {
+			profile.Timezone = ""
+		} else if _, err := time.LoadLocation(*update.Timezone); err != nil || *update.Timezone == "Local" {
+			verr.Violations = append(verr.Violations, FieldViolation{Field: "timezone", Description: "must be an IANA time zone name"})
+		} else {
+			profile.Timezone = *update.Timezone
+		}
+	}
+
+	if update.AvatarURL != nil {
+		if *update.AvatarURL == "" {
+			profile.AvatarURL = ""
+		} else if !validAvatarURL(*update.AvatarURL) {
+			verr.Violations = append(verr.Violations, FieldViolation{Field: "avatar_url", Description: "must be an absolute https URL"})
+		} else {
+			profile.AvatarURL = *update.AvatarURL
+		}
+	}
+
+	if len(verr.Violations) > 0 {
+		return models.Profile{}, verr
+	}
+
+	return profile, nil
+}
+
+func validAvatarURL(raw string) bool {
+	if len(raw) > maxAvatarURLLength {
+		return false
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+
+	return u.Scheme == "https" && u.Host != "" && u.User == nil
+}
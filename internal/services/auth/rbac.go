@@ -0,0 +1,404 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	jwt "github.com/1abobik1/Single-Sign-On/internal/lib/jwt"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+const (
+	// PermissionAdmin — разрешение администратора. В глобальной роли дает доступ
+	// ко всем административным операциям, в роли приложения — к операциям этого приложения.
+	PermissionAdmin = "sso:admin"
+	// PermissionManageRoles разрешает создавать, удалять и назначать роли.
+	PermissionManageRoles = "sso:roles:manage"
+
+	maxRoleDescriptionLen = 256
+	maxRolePermissions    = 100
+)
+
+var (
+	ErrRoleExists   = errors.New("role already exists")
+	ErrRoleNotFound = errors.New("role not found")
+)
+
+var (
+	roleNamePattern       = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+	permissionNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.:-]{0,127}$`)
+	// Разрешение роли может быть ограничено ресурсом: "docs:read@folder/42"
+	resourcePattern = regexp.MustCompile(`^[A-Za-z0-9_.:/-]{1,128}$`)
+)
+
+// CreateRole создает роль в приложении role.AppID (0 — глобальная роль).
+// Разрешения, которых еще нет в приложении, создаются. Вызывающий должен сам
+// обладать всеми разрешениями роли.
+func (a *Auth) CreateRole(ctx context.Context, accessToken string, role models.Role) (models.Role, error) {
+	const op = "Auth.CreateRole"
+
+	log := a.log.With(
+		"op", op,
+		"appID", role.AppID,
+		"name", role.Name,
+	)
+
+	callerID, err := a.authorize(ctx, accessToken, role.AppID, PermissionManageRoles)
+	if err != nil {
+		log.Warn("role creation denied", "error", err)
+		return models.Role{}, err
+	}
+
+	role.Name = strings.TrimSpace(role.Name)
+	role.Description = strings.TrimSpace(role.Description)
+	role.Permissions = normalizePermissions(role.Permissions)
+	if err := validateRole(role); err != nil {
+		return models.Role{}, err
+	}
+
+	if err := a.authorizeGrant(ctx, callerID, role.AppID, role.Permissions); err != nil {
+		log.Warn("role creation denied", "callerID", callerID, "error", err)
+		return models.Role{}, err
+	}
+
+	role, err = a.roleStorage.CreateRole(ctx, role)
+	if err != nil {
+		if errors.Is(err, storage.ErrRoleExists) {
+			log.Warn("role already exists")
+			return models.Role{}, ErrRoleExists
+		}
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found")
+			return models.Role{}, storage.ErrAppNotFound
+		}
+		log.Error("failed to create role", "error", err)
+		return models.Role{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("role created", "roleID", role.ID, "callerID", callerID)
+	return role, nil
+}
+
+// DeleteRole удаляет роль и снимает ее со всех пользователей.
+func (a *Auth) DeleteRole(ctx context.Context, accessToken string, roleID int64) error {
+	const op = "Auth.DeleteRole"
+
+	log := a.log.With(
+		"op", op,
+		"roleID", roleID,
+	)
+
+	role, callerID, err := a.authorizeRole(ctx, accessToken, roleID)
+	if err != nil {
+		log.Warn("role deletion denied", "error", err)
+		return err
+	}
+
+	// Нельзя лишить себя административного доступа, удалив свою роль
+	if slices.Contains(role.Permissions, PermissionAdmin) && role.Global() {
+		return &ValidationError{Violations: []FieldViolation{{Field: "role_id", Description: "global admin role cannot be deleted"}}}
+	}
+
+	if err := a.roleStorage.DeleteRole(ctx, roleID); err != nil {
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return ErrRoleNotFound
+		}
+		log.Error("failed to delete role", "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("role deleted", "callerID", callerID)
+	return nil
+}
+
+// ListRoles возвращает роли приложения appID; appID = 0 — глобальные роли.
+func (a *Auth) ListRoles(ctx context.Context, accessToken string, appID int) ([]models.Role, error) {
+	const op = "Auth.ListRoles"
+
+	if _, err := a.authorize(ctx, accessToken, appID, PermissionManageRoles); err != nil {
+		return nil, err
+	}
+
+	roles, err := a.roleStorage.Roles(ctx, appID)
+	if err != nil {
+		a.log.Error("failed to list roles", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return roles, nil
+}
+
+// AssignRole назначает роль пользователю. Вызывающий должен сам обладать
+// всеми разрешениями роли.
+func (a *Auth) AssignRole(ctx context.Context, accessToken string, userID int64, roleID int64) error {
+	const op = "Auth.AssignRole"
+
+	log := a.log.With(
+		"op", op,
+		"userID", userID,
+		"roleID", roleID,
+	)
+
+	role, callerID, err := a.authorizeRole(ctx, accessToken, roleID)
+	if err != nil {
+		log.Warn("role assignment denied", "error", err)
+		return err
+	}
+
+	if err := a.authorizeGrant(ctx, callerID, role.AppID, role.Permissions); err != nil {
+		log.Warn("role assignment denied", "callerID", callerID, "error", err)
+		return err
+	}
+
+	if err := a.roleStorage.AssignRole(ctx, userID, roleID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return storage.ErrUserNotFound
+		}
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return ErrRoleNotFound
+		}
+		log.Error("failed to assign role", "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("role assigned", "callerID", callerID)
+	return nil
+}
+
+// UnassignRole снимает роль с пользователя.
+func (a *Auth) UnassignRole(ctx context.Context, accessToken string, userID int64, roleID int64) error {
+	const op = "Auth.UnassignRole"
+
+	log := a.log.With(
+		"op", op,
+		"userID", userID,
+		"roleID", roleID,
+	)
+
+	role, callerID, err := a.authorizeRole(ctx, accessToken, roleID)
+	if err != nil {
+		log.Warn("role unassignment denied", "error", err)
+		return err
+	}
+
+	if callerID == userID && role.Global() && slices.Contains(role.Permissions, PermissionAdmin) {
+		return &ValidationError{Violations: []FieldViolation{{Field: "user_id", Description: "admins cannot revoke their own admin role"}}}
+	}
+
+	if err := a.roleStorage.UnassignRole(ctx, userID, roleID); err != nil {
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return ErrRoleNotFound
+		}
+		log.Error("failed to unassign role", "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("role unassigned", "callerID", callerID)
+	return nil
+}
+
+// ListUserRoles возвращает роли пользователя, действующие в приложении appID.
+// Свои роли пользователь видит всегда, чужие — с разрешением PermissionManageRoles.
+func (a *Auth) ListUserRoles(ctx context.Context, accessToken string, userID int64, appID int) ([]models.Role, error) {
+	const op = "Auth.ListUserRoles"
+
+	callerID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if callerID != userID {
+		if _, err := a.authorize(ctx, accessToken, appID, PermissionManageRoles); err != nil {
+			return nil, err
+		}
+	}
+
+	roles, err := a.roleStorage.UserRoles(ctx, userID, appID)
+	if err != nil {
+		a.log.Error("failed to list user roles", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return roles, nil
+}
+
+// authorize проверяет, что у владельца access токена есть разрешение permission
+// в приложении appID, и возвращает его ID. PermissionAdmin заменяет любое разрешение.
+//
+// Access токен подписан секретом приложения, поэтому приложение может выпустить
+// себе токен от имени любого пользователя. Поэтому токен недоверенного
+// приложения действует только в этом приложении, а глобальные операции
+// (appID = 0) доступны только по токенам доверенных приложений.
+func (a *Auth) authorize(ctx context.Context, accessToken string, appID int, permission string) (int64, error) {
+	const op = "Auth.authorize"
+
+	claims, err := a.authenticateClaims(ctx, accessToken)
+	if err != nil {
+		return 0, err
+	}
+	callerID := claims.userID
+
+	app, err := a.appProvider.App(ctx, claims.appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return 0, ErrInvalidToken
+		}
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+	if err := authorizeLookup(app, appID); err != nil {
+		a.log.Warn("access token of untrusted app used outside the app",
+			"op", op, "userID", callerID, "tokenAppID", app.ID, "appID", appID)
+		return 0, err
+	}
+
+	ok, err := a.roleStorage.HasPermission(ctx, callerID, appID, permission, PermissionAdmin)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return 0, ErrInvalidToken
+		}
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+	if !ok {
+		return 0, ErrPermissionDenied
+	}
+
+	return callerID, nil
+}
+
+// authorizeRole загружает роль и проверяет право управлять ролями ее приложения.
+func (a *Auth) authorizeRole(ctx context.Context, accessToken string, roleID int64) (models.Role, int64, error) {
+	const op = "Auth.authorizeRole"
+
+	// Сначала аутентификация: без токена нельзя узнать, существует ли роль
+	if _, err := a.authenticate(ctx, accessToken); err != nil {
+		return models.Role{}, 0, err
+	}
+
+	role, err := a.roleStorage.Role(ctx, roleID)
+	if err != nil {
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return models.Role{}, 0, ErrRoleNotFound
+		}
+		return models.Role{}, 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	callerID, err := a.authorize(ctx, accessToken, role.AppID, PermissionManageRoles)
+	if err != nil {
+		return models.Role{}, 0, err
+	}
+
+	return role, callerID, nil
+}
+
+// authorizeGrant проверяет, что вызывающий сам обладает в приложении appID
+// всеми разрешениями permissions: иначе право управлять ролями позволяло бы
+// выдать себе или другим больше, чем есть у него. Разрешение, ограниченное
+// ресурсом, может выдать и обладатель неограниченного. Роль с PermissionAdmin
+// может выдать только администратор.
+func (a *Auth) authorizeGrant(ctx context.Context, callerID int64, appID int, permissions []string) error {
+	const op = "Auth.authorizeGrant"
+
+	roles, err := a.roleStorage.UserRoles(ctx, callerID, appID)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	held := make(map[string]struct{})
+	for _, role := range roles {
+		for _, p := range role.Permissions {
+			held[p] = struct{}{}
+		}
+	}
+
+	if _, ok := held[PermissionAdmin]; ok {
+		return nil
+	}
+
+	for _, p := range permissions {
+		if _, ok := held[p]; ok {
+			continue
+		}
+		name, _, _ := strings.Cut(p, resourceSeparator)
+		if _, ok := held[name]; ok {
+			continue
+		}
+		return ErrPermissionDenied
+	}
+
+	return nil
+}
+
+// grants собирает роли и разрешения пользователя в приложении для access токена.
+func (a *Auth) grants(ctx context.Context, userID int64, appID int) (jwt.Grants, error) {
+	roles, err := a.roleStorage.UserRoles(ctx, userID, appID)
+	if err != nil {
+		return jwt.Grants{}, err
+	}
+
+	var grants jwt.Grants
+	for _, role := range roles {
+		grants.Roles = append(grants.Roles, role.Name)
+		grants.Permissions = append(grants.Permissions, role.Permissions...)
+	}
+	slices.Sort(grants.Permissions)
+	grants.Permissions = slices.Compact(grants.Permissions)
+
+	return grants, nil
+}
+
+// normalizePermissions удаляет пробелы, пустые значения и дубликаты.
+func normalizePermissions(permissions []string) []string {
+	out := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	slices.Sort(out)
+
+	return slices.Compact(out)
+}
+
+func validateRole(role models.Role) error {
+	verr := &ValidationError{}
+
+	if !roleNamePattern.MatchString(role.Name) {
+		verr.Violations = append(verr.Violations, FieldViolation{
+			Field:       "name",
+			Description: "must be 1-64 lowercase letters, digits, '_', '.' or '-'",
+		})
+	}
+	if utf8.RuneCountInString(role.Description) > maxRoleDescriptionLen {
+		verr.Violations = append(verr.Violations, FieldViolation{
+			Field:       "description",
+			Description: fmt.Sprintf("must be at most %d characters", maxRoleDescriptionLen),
+		})
+	}
+	if len(role.Permissions) > maxRolePermissions {
+		verr.Violations = append(verr.Violations, FieldViolation{
+			Field:       "permissions",
+			Description: fmt.Sprintf("must contain at most %d permissions", maxRolePermissions),
+		})
+	}
+	for _, p := range role.Permissions {
+		name, resource, scoped := strings.Cut(p, resourceSeparator)
+		if !permissionNamePattern.MatchString(name) || (scoped && !resourcePattern.MatchString(resource)) {
+			verr.Violations = append(verr.Violations, FieldViolation{
+				Field: "permissions",
+				Description: fmt.Sprintf("%q must be 1-128 lowercase letters, digits, '_', '.', ':' or '-', "+
+					"optionally followed by '@' and a resource", p),
+			})
+		}
+	}
+
+	if len(verr.Violations) > 0 {
+		return verr
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/notify"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/secret"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+// amrRecoveryCode — вход по коду восстановления вместо второго фактора.
+const amrRecoveryCode = "rcode"
+
+const (
+	// Без похожих символов: 0/o, 1/l/i.
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	recoveryCodeLength   = 10
+)
+
+// generateRecoveryCodes генерирует n кодов вида "xxxxx-xxxxx" и их хеши.
+func generateRecoveryCodes(n int) ([]string, [][]byte, error) {
+	codes := make([]string, 0, n)
+	hashes := make([][]byte, 0, n)
+
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := 0; i < n; i++ {
+		var b strings.Builder
+		for j := 0; j < recoveryCodeLength; j++ {
+			if j == recoveryCodeLength/2 {
+				b.WriteByte('-')
+			}
+			k, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, nil, err
+			}
+			b.WriteByte(recoveryCodeAlphabet[k.Int64()])
+		}
+
+		code := b.String()
+		codes = append(codes, code)
+		hashes = append(hashes, secret.Hash(normalizeRecoveryCode(code)))
+	}
+
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode убирает разделители и приводит код к нижнему регистру.
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+}
+
+// isTOTPCode сообщает, похож ли код на код TOTP, а не на код восстановления.
+func isTOTPCode(code string) bool {
+	code = strings.TrimSpace(code)
+	if len(code) != 6 {
+		return false
+	}
+
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// issueRecoveryCodes создает новый набор кодов восстановления взамен прежнего.
+func (a *Auth) issueRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes(a.mfa.RecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.mfaStorage.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// useRecoveryCode проверяет и погашает код восстановления. Если кодов осталось мало,
+// пользователь получает уведомление.
+func (a *Auth) useRecoveryCode(ctx context.Context, user models.User, code string) error {
+	const op = "Auth.useRecoveryCode"
+
+	ok, remaining, err := a.mfaStorage.UseRecoveryCode(ctx, user.ID, secret.Hash(normalizeRecoveryCode(code)))
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	a.log.Info("recovery code used", "userID", user.ID, "remaining", remaining)
+
+	if remaining <= a.mfa.RecoveryCodesLow {
+		a.log.Warn("few recovery codes remaining", "userID", user.ID, "remaining", remaining)
+
+		err := a.sender.Send(ctx, notify.Message{
+			Channel: notify.ChannelEmail,
+			To:      user.Email,
+			Subject: "Few recovery codes remaining",
+			Body: fmt.Sprintf(
+				"A recovery code was just used to sign in to your account. You have %d recovery codes left. "+
+					"Generate a new set in your security settings.", remaining,
+			),
+		})
+		if err != nil {
+			// Уведомление не должно мешать входу
+			a.log.Error("failed to send recovery codes alert", "userID", user.ID, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes заменяет коды восстановления владельца access токена.
+// Требуется действующий код TOTP или один из прежних кодов восстановления;
+// неверные коды учитываются в блокировке аккаунта так же, как в VerifyMFA.
+func (a *Auth) RegenerateRecoveryCodes(ctx context.Context, accessToken string, code string) ([]string, error) {
+	const op = "Auth.RegenerateRecoveryCodes"
+
+	user, err := a.GetMe(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	userID := user.ID
+
+	t, err := a.mfaStorage.TOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFANotFound) {
+			return nil, ErrMFANotEnabled
+		}
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	if !t.Confirmed() {
+		return nil, ErrMFANotEnabled
+	}
+
+	if err := a.checkMFACode(ctx, t, user, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			a.log.Warn("invalid mfa code", "op", op, "userID", userID)
+			return nil, a.registerFailedMFA(ctx, user)
+		}
+		return nil, err
+	}
+
+	codes, err := a.issueRecoveryCodes(ctx, userID)
+	if err != nil {
+		a.log.Error("failed to regenerate recovery codes", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	a.log.Info("recovery codes regenerated", "op", op, "userID", userID)
+	return codes, nil
+}
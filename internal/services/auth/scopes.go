@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+// PermissionManageApps разрешает управлять настройками приложения, в том числе его scope.
+const PermissionManageApps = "sso:apps:manage"
+
+const (
+	maxScopeDescriptionLen = 256
+	maxRequestedScopes     = 50
+)
+
+var (
+	ErrScopeExists   = errors.New("scope already exists")
+	ErrScopeNotFound = errors.New("scope not found")
+	ErrInvalidScope  = errors.New("invalid scope")
+)
+
+// RFC 6749: scope не содержит пробелов, кавычек и обратной косой черты
+var scopeNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.:/-]{0,127}$`)
+
+// ScopeError возвращается, когда приложение запросило scope, которые ему не разрешены.
+type ScopeError struct {
+	Denied []string
+}
+
+func (e *ScopeError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrInvalidScope, strings.Join(e.Denied, " "))
+}
+
+func (e *ScopeError) Unwrap() error {
+	return ErrInvalidScope
+}
+
+// DefineScope регистрирует scope, который определяет приложение scope.AppID,
+// или обновляет его описание.
+func (a *Auth) DefineScope(ctx context.Context, accessToken string, scope models.Scope) (models.Scope, error) {
+	const op = "Auth.DefineScope"
+
+	log := a.log.With(
+		"op", op,
+		"appID", scope.AppID,
+		"scope", scope.Name,
+	)
+
+	callerID, err := a.authorize(ctx, accessToken, scope.AppID, PermissionManageApps)
+	if err != nil {
+		log.Warn("scope definition denied", "error", err)
+		return models.Scope{}, err
+	}
+
+	scope.Name = strings.TrimSpace(scope.Name)
+	scope.Description = strings.TrimSpace(scope.Description)
+
+	verr := &ValidationError{}
+	if !scopeNamePattern.MatchString(scope.Name) {
+		verr.Violations = append(verr.Violations, FieldViolation{
+			Field:       "name",
+			Description: "must be 1-128 lowercase letters, digits, '_', '.', ':', '/' or '-'",
+		})
+	}
+	if utf8.RuneCountInString(scope.Description) > maxScopeDescriptionLen {
+		verr.Violations = append(verr.Violations, FieldViolation{
+			Field:       "description",
+			Description: fmt.Sprintf("must be at most %d characters", maxScopeDescriptionLen),
+		})
+	}
+	if len(verr.Violations) > 0 {
+		return models.Scope{}, verr
+	}
+
+	scope, err = a.scopeStorage.DefineScope(ctx, scope)
+	if err != nil {
+		if errors.Is(err, storage.ErrScopeExists) {
+			log.Warn("scope is defined by another app")
+			return models.Scope{}, ErrScopeExists
+		}
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.Scope{}, storage.ErrAppNotFound
+		}
+		log.Error("failed to define scope", "error", err)
+		return models.Scope{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("scope defined", "callerID", callerID)
+	return scope, nil
+}
+
+// DeleteScope удаляет scope приложения. Уже выданные токены сохраняют его
+// до истечения, при обновлении access токена он отбрасывается.
+func (a *Auth) DeleteScope(ctx context.Context, accessToken string, appID int, name string) error {
+	const op = "Auth.DeleteScope"
+
+	log := a.log.With(
+		"op", op,
+		"appID", appID,
+		"scope", name,
+	)
+
+	callerID, err := a.authorize(ctx, accessToken, appID, PermissionManageApps)
+	if err != nil {
+		log.Warn("scope deletion denied", "error", err)
+		return err
+	}
+
+	if err := a.scopeStorage.DeleteScope(ctx, appID, name); err != nil {
+		if errors.Is(err, storage.ErrScopeNotFound) {
+			return ErrScopeNotFound
+		}
+		log.Error("failed to delete scope", "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("scope deleted", "callerID", callerID)
+	return nil
+}
+
+// ListScopes возвращает scope, определенные приложением.
+func (a *Auth) ListScopes(ctx context.Context, accessToken string, appID int) ([]models.Scope, error) {
+	const op = "Auth.ListScopes"
+
+	if _, err := a.authorize(ctx, accessToken, appID, PermissionManageApps); err != nil {
+		return nil, err
+	}
+
+	scopes, err := a.scopeStorage.Scopes(ctx, appID)
+	if err != nil {
+		a.log.Error("failed to list scopes", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return scopes, nil
+}
+
+// SetAllowedScopes задает scope, которые приложение appID может запрашивать.
+// Для scope другого приложения нужно право управлять и этим приложением.
+func (a *Auth) SetAllowedScopes(ctx context.Context, accessToken string, appID int, names []string) ([]models.Scope, error) {
+	const op = "Auth.SetAllowedScopes"
+
+	log := a.log.With(
+		"op", op,
+		"appID", appID,
+	)
+
+	callerID, err := a.authorize(ctx, accessToken, appID, PermissionManageApps)
+	if err != nil {
+		log.Warn("allowed scopes change denied", "error", err)
+		return nil, err
+	}
+
+	names = normalizeScope(names)
+	scopes, err := a.scopeStorage.ScopesByName(ctx, names)
+	if err != nil {
+		log.Error("failed to retrieve scopes", "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	if len(scopes) != len(names) {
+		return nil, ErrScopeNotFound
+	}
+
+	ids := make([]int64, 0, len(scopes))
+	checked := map[int]bool{appID: true}
+	for _, scope := range scopes {
+		if !checked[scope.AppID] {
+			if _, err := a.authorize(ctx, accessToken, scope.AppID, PermissionManageApps); err != nil {
+				log.Warn("allowed scopes change denied for scope owner", "ownerAppID", scope.AppID, "error", err)
+				return nil, err
+			}
+			checked[scope.AppID] = true
+		}
+		ids = append(ids, scope.ID)
+	}
+
+	if err := a.scopeStorage.SetAllowedScopes(ctx, appID, ids); err != nil {
+		if errors.Is(err, storage.ErrScopeNotFound) {
+			return nil, ErrScopeNotFound
+		}
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return nil, storage.ErrAppNotFound
+		}
+		log.Error("failed to set allowed scopes", "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("allowed scopes changed", "callerID", callerID, "scopes", names)
+	return scopes, nil
+}
+
+// ListAllowedScopes возвращает scope, которые приложение может запрашивать.
+func (a *Auth) ListAllowedScopes(ctx context.Context, accessToken string, appID int) ([]models.Scope, error) {
+	const op = "Auth.ListAllowedScopes"
+
+	if _, err := a.authorize(ctx, accessToken, appID, PermissionManageApps); err != nil {
+		return nil, err
+	}
+
+	scopes, err := a.scopeStorage.AllowedScopes(ctx, appID)
+	if err != nil {
+		a.log.Error("failed to list allowed scopes", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return scopes, nil
+}
+
+// grantScope проверяет, что приложению разрешены все запрошенные scope, и
+// возвращает их. Если запрошен хотя бы один неразрешенный scope, возвращает ScopeError.
+func (a *Auth) grantScope(ctx context.Context, appID int, requested []string) ([]string, error) {
+	requested = normalizeScope(requested)
+	if len(requested) == 0 {
+		return nil, nil
+	}
+
+	allowed, err := a.allowedScopeNames(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+
+	var denied []string
+	for _, s := range requested {
+		if !slices.Contains(allowed, s) {
+			denied = append(denied, s)
+		}
+	}
+	if len(denied) > 0 {
+		return nil, &ScopeError{Denied: denied}
+	}
+
+	return requested, nil
+}
+
+// refreshScope определяет scope нового access токена. Запрошенные scope должны
+// входить в scope сессии. Без запроса сохраняются scope сессии, которые
+// приложению по-прежнему разрешены.
+func (a *Auth) refreshScope(ctx context.Context, appID int, session []string, requested []string) ([]string, error) {
+	requested = normalizeScope(requested)
+	if len(requested) > 0 {
+		var denied []string
+		for _, s := range requested {
+			if !slices.Contains(session, s) {
+				denied = append(denied, s)
+			}
+		}
+		if len(denied) > 0 {
+			return nil, &ScopeError{Denied: denied}
+		}
+
+		return a.grantScope(ctx, appID, requested)
+	}
+
+	if len(session) == 0 {
+		return nil, nil
+	}
+
+	allowed, err := a.allowedScopeNames(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(slices.Clone(session), func(s string) bool {
+		return !slices.Contains(allowed, s)
+	}), nil
+}
+
+func (a *Auth) allowedScopeNames(ctx context.Context, appID int) ([]string, error) {
+	scopes, err := a.scopeStorage.AllowedScopes(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		names = append(names, scope.Name)
+	}
+
+	return names, nil
+}
+
+// normalizeScope удаляет пустые значения и дубликаты, сохраняя порядок запроса.
+func normalizeScope(scope []string) []string {
+	res := make([]string, 0, len(scope))
+	for _, s := range scope {
+		if s = strings.TrimSpace(s); s != "" && !slices.Contains(res, s) {
+			res = append(res, s)
+		}
+	}
+
+	return res
+}
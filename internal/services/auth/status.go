@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+var (
+	ErrAccountDisabled  = errors.New("account disabled")
+	ErrAccountPending   = errors.New("account pending approval")
+	ErrAccountSuspended = errors.New("account suspended")
+)
+
+// SuspendedError возвращается при попытке входа в приостановленный аккаунт.
+// Нулевой Until означает приостановку без срока.
+type SuspendedError struct {
+	Until time.Time
+}
+
+func (e *SuspendedError) Error() string {
+	if e.Until.IsZero() {
+		return ErrAccountSuspended.Error()
+	}
+
+	return fmt.Sprintf("%v until %s", ErrAccountSuspended, e.Until.Format(time.RFC3339))
+}
+
+func (e *SuspendedError) Unwrap() error {
+	return ErrAccountSuspended
+}
+
+// checkStatus проверяет, что пользователю разрешено получать токены.
+func checkStatus(user models.User) error {
+	switch user.EffectiveStatus(time.Now()) {
+	case models.UserActive:
+		return nil
+	case models.UserDisabled:
+		return ErrAccountDisabled
+	case models.UserSuspended:
+		return &SuspendedError{Until: user.SuspendedUntil}
+	case models.UserPendingApproval:
+		return ErrAccountPending
+	}
+
+	return ErrAccountDisabled
+}
+
+// SetUserStatus меняет статус пользователя. Доступно только администраторам.
+// suspendedUntil учитывается только для статуса suspended; нулевое значение — бессрочно.
+// Блокировка и приостановка завершают сессии пользователя: refresh токен
+// отзывается, а выданные access токены перестают приниматься (см. authenticateClaims).
+func (a *Auth) SetUserStatus(
+	ctx context.Context,
+	accessToken string,
+	userID int64,
+	status models.UserStatus,
+	suspendedUntil time.Time,
+	reason string,
+) (models.User, error) {
+	const op = "Auth.SetUserStatus"
+
+	log := a.log.With(
+		"op", op,
+		"userID", userID,
+		"status", status,
+	)
+
+	adminID, err := a.requireAdmin(ctx, accessToken)
+	if err != nil {
+		log.Warn("status change denied", "error", err)
+		return models.User{}, err
+	}
+
+	verr := &ValidationError{}
+	switch status {
+	case models.UserActive, models.UserDisabled, models.UserPendingApproval:
+		suspendedUntil = time.Time{}
+	case models.UserSuspended:
+		if !suspendedUntil.IsZero() && !suspendedUntil.After(time.Now()) {
+			verr.Violations = append(verr.Violations, FieldViolation{Field: "suspended_until", Description: "must be in the future"})
+		}
+	default:
+		verr.Violations = append(verr.Violations, FieldViolation{Field: "status", Description: "must be one of active, disabled, suspended, pending_approval"})
+	}
+	if status != models.UserActive && reason == "" {
+		verr.Violations = append(verr.Violations, FieldViolation{Field: "reason", Description: "is required"})
+	}
+	if len(verr.Violations) > 0 {
+		return models.User{}, verr
+	}
+
+	if adminID == userID && status != models.UserActive {
+		return models.User{}, &ValidationError{Violations: []FieldViolation{{Field: "user_id", Description: "admins cannot deactivate themselves"}}}
+	}
+
+	user, err := a.usrSaver.SetUserStatus(ctx, userID, status, suspendedUntil, reason)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return models.User{}, storage.ErrUserNotFound
+		}
+		log.Error("failed to set user status", "error", err)
+		return models.User{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("user status changed", "adminID", adminID, "reason", reason)
+	return user, nil
+}
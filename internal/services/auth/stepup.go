@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	jwt "github.com/1abobik1/Single-Sign-On/internal/lib/jwt"
+)
+
+// Уровни аутентификации для claim acr (NIST SP 800-63B).
+const (
+	// ACRSingleFactor — один фактор: пароль или код из письма.
+	ACRSingleFactor = "aal1"
+	// ACRMultiFactor — два фактора.
+	ACRMultiFactor = "aal2"
+	// ACRPhishingResistant — два фактора, один из которых ключ WebAuthn.
+	ACRPhishingResistant = "aal3"
+)
+
+var acrLevels = map[string]int{
+	ACRSingleFactor:      1,
+	ACRMultiFactor:       2,
+	ACRPhishingResistant: 3,
+}
+
+// recentAuthMaxAge — действия, меняющие защиту аккаунта (второй фактор,
+// доверенные устройства), доступны только сразу после входа.
+const recentAuthMaxAge = 10 * time.Minute
+
+var (
+	// ErrReauthenticationRequired — сессия слишком старая, пользователь должен войти заново.
+	ErrReauthenticationRequired = errors.New("re-authentication required")
+	// ErrInsufficientACR — у пользователя нет факторов, дающих требуемый уровень.
+	ErrInsufficientACR = errors.New("required authentication level not available")
+)
+
+// requireRecentAuth проверяет, что вход, которым получен access токен, был не
+// раньше recentAuthMaxAge назад. Если mfa установлен, вход должен включать второй фактор.
+func requireRecentAuth(info jwt.AuthInfo, mfa bool) error {
+	if mfa && !slices.Contains(info.AMR, amrMFA) {
+		return ErrInsufficientACR
+	}
+	if info.AuthTime.IsZero() || time.Since(info.AuthTime) > recentAuthMaxAge {
+		return ErrReauthenticationRequired
+	}
+
+	return nil
+}
+
+// AuthRequirements — требования приложения к аутентификации, после которой выдается
+// токен, и запрошенный им доступ.
+type AuthRequirements struct {
+	// MinACR — минимальный уровень аутентификации. Пустое значение — любой.
+	MinACR string
+	// MaxAge — максимальное время с момента аутентификации. 0 — без ограничения.
+	MaxAge time.Duration
+	// Scope — запрошенные scope OAuth. Пустой список — токен без scope.
+	Scope []string
+}
+
+func (r AuthRequirements) validate() error {
+	verr := &ValidationError{}
+
+	if _, ok := acrLevels[r.MinACR]; r.MinACR != "" && !ok {
+		verr.Violations = append(verr.Violations, FieldViolation{Field: "acr_values", Description: "must be one of aal1, aal2, aal3"})
+	}
+	if r.MaxAge < 0 {
+		verr.Violations = append(verr.Violations, FieldViolation{Field: "max_age", Description: "must not be negative"})
+	}
+	if len(r.Scope) > maxRequestedScopes {
+		verr.Violations = append(verr.Violations, FieldViolation{Field: "scope", Description: fmt.Sprintf("must contain at most %d values", maxRequestedScopes)})
+	}
+	for _, s := range r.Scope {
+		if !scopeNamePattern.MatchString(s) {
+			verr.Violations = append(verr.Violations, FieldViolation{Field: "scope", Description: fmt.Sprintf("%q is not a valid scope", s)})
+		}
+	}
+
+	if len(verr.Violations) > 0 {
+		return verr
+	}
+
+	return nil
+}
+
+// satisfiedBy сообщает, достаточен ли уровень acr.
+func (r AuthRequirements) satisfiedBy(acr string) bool {
+	return acrLevels[acr] >= acrLevels[r.MinACR]
+}
+
+// acrFor определяет уровень аутентификации по ее методам.
+func acrFor(amr []string) string {
+	switch {
+	case slices.Contains(amr, amrMFA) && slices.Contains(amr, amrHardwareKey):
+		return ACRPhishingResistant
+	case slices.Contains(amr, amrMFA):
+		return ACRMultiFactor
+	}
+
+	return ACRSingleFactor
+}
+
+// newAuthInfo описывает только что завершенную аутентификацию методами amr.
+func newAuthInfo(amr ...string) jwt.AuthInfo {
+	return jwt.AuthInfo{AMR: amr, AuthTime: time.Now(), ACR: acrFor(amr)}
+}
+
+// withSecondFactor дополняет аутентификацию вторым фактором method. Выданные scope сохраняются.
+func withSecondFactor(info jwt.AuthInfo, method string) jwt.AuthInfo {
+	amr := slices.Clone(info.AMR)
+	for _, m := range []string{method, amrMFA} {
+		if !slices.Contains(amr, m) {
+			amr = append(amr, m)
+		}
+	}
+
+	res := newAuthInfo(amr...)
+	res.Scope = info.Scope
+
+	return res
+}
+
+// sessionAuth возвращает сведения об аутентификации из токена сессии. В токенах,
+// выпущенных до появления acr, уровень определяется по amr.
+func sessionAuth(info jwt.AuthInfo) jwt.AuthInfo {
+	if info.ACR == "" {
+		info.ACR = acrFor(info.AMR)
+	}
+
+	return info
+}
+
+// stepUpMethods оставляет вторые факторы, которые после первого фактора дают уровень minACR.
+func stepUpMethods(methods []string, info jwt.AuthInfo, minACR string) []string {
+	required := AuthRequirements{MinACR: minACR}
+
+	res := make([]string, 0, len(methods))
+	for _, m := range methods {
+		if required.satisfiedBy(withSecondFactor(info, m).ACR) {
+			res = append(res, m)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,588 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/webauthn"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+// amrHardwareKey — вход ключом WebAuthn (RFC 8176).
+const amrHardwareKey = "hwk"
+
+const (
+	defaultCredentialName = "Security key"
+	maxCredentialNameLen  = 64
+)
+
+var (
+	ErrInvalidWebAuthnResponse  = errors.New("invalid webauthn response")
+	ErrWebAuthnCredentialExists = errors.New("webauthn credential already registered")
+	ErrWebAuthnNotFound         = errors.New("webauthn credential not found")
+)
+
+// WebAuthnPolicy задает параметры WebAuthn.
+type WebAuthnPolicy struct {
+	RP           webauthn.RelyingParty
+	ChallengeTTL time.Duration
+}
+
+// userHandle — идентификатор пользователя, который хранится в ключе.
+// Для него используется ID пользователя: в нем нет персональных данных.
+func userHandle(userID int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userID))
+}
+
+// newWebAuthnChallenge генерирует и сохраняет challenge церемонии вида kind.
+func (a *Auth) newWebAuthnChallenge(ctx context.Context, kind string, userID int64, appID int) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.webAuthnStorage.SaveWebAuthnChallenge(ctx, models.WebAuthnChallenge{
+		Challenge: challenge,
+		Kind:      kind,
+		UserID:    userID,
+		AppID:     appID,
+		ExpiresAt: time.Now().Add(a.webAuthn.ChallengeTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// consumeWebAuthnChallenge находит и погашает challenge, на который отвечает клиент.
+func (a *Auth) consumeWebAuthnChallenge(ctx context.Context, challenge []byte, kind string) (models.WebAuthnChallenge, error) {
+	const op = "Auth.consumeWebAuthnChallenge"
+
+	ch, err := a.webAuthnStorage.ConsumeWebAuthnChallenge(ctx, challenge, kind)
+	if err != nil {
+		if errors.Is(err, storage.ErrChallengeNotFound) {
+			return models.WebAuthnChallenge{}, ErrInvalidWebAuthnResponse
+		}
+		return models.WebAuthnChallenge{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return ch, nil
+}
+
+// credentialIDs возвращает идентификаторы ключей пользователя.
+func (a *Auth) credentialIDs(ctx context.Context, userID int64) ([][]byte, error) {
+	creds, err := a.webAuthnStorage.WebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([][]byte, 0, len(creds))
+	for _, cred := range creds {
+		ids = append(ids, cred.CredentialID)
+	}
+
+	return ids, nil
+}
+
+// dummyCredentialID возвращает фиктивный ID ключа для login. Он постоянен для
+// одного login, как настоящие ключи, и не вычисляется без секрета приложения.
+func dummyCredentialID(app models.App, login string) []byte {
+	mac := hmac.New(sha256.New, []byte(app.Secret))
+	mac.Write([]byte("webauthn.login:" + strings.ToLower(strings.TrimSpace(login))))
+	return mac.Sum(nil)
+}
+
+// BeginWebAuthnRegistration начинает регистрацию ключа для владельца access токена
+// и возвращает JSON PublicKeyCredentialCreationOptions. Требования к входу — как
+// в requireRegistrationAuth.
+func (a *Auth) BeginWebAuthnRegistration(ctx context.Context, accessToken string) ([]byte, error) {
+	const op = "Auth.BeginWebAuthnRegistration"
+
+	claims, err := a.authenticateClaims(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	user := claims.user
+
+	if err := a.requireRegistrationAuth(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	exclude, err := a.credentialIDs(ctx, user.ID)
+	if err != nil {
+		a.log.Error("failed to retrieve webauthn credentials", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	challenge, err := a.newWebAuthnChallenge(ctx, models.WebAuthnRegistration, user.ID, claims.appID)
+	if err != nil {
+		a.log.Error("failed to save webauthn challenge", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	displayName := user.DisplayName
+	if displayName == "" {
+		displayName = user.Email
+	}
+
+	options, err := a.webAuthn.RP.CreationOptions(challenge, webauthn.User{
+		Handle:      userHandle(user.ID),
+		Name:        user.Email,
+		DisplayName: displayName,
+	}, exclude, a.webAuthn.ChallengeTTL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	a.log.Info("webauthn registration started", "op", op, "userID", user.ID)
+	return options, nil
+}
+
+// requireRegistrationAuth проверяет вход перед регистрацией ключа WebAuthn так же,
+// как TrustDevice: access токен получен не раньше recentAuthMaxAge назад, и, если
+// у пользователя уже есть второй фактор, вход включал его. Иначе украденный
+// токен позволил бы добавить свой ключ и обойти второй фактор.
+func (a *Auth) requireRegistrationAuth(ctx context.Context, claims accessClaims) error {
+	const op = "Auth.requireRegistrationAuth"
+
+	methods, err := a.mfaMethods(ctx, claims.userID)
+	if err != nil {
+		a.log.Error("failed to retrieve mfa methods", "op", op, "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := requireRecentAuth(claims.auth, len(methods) > 0); err != nil {
+		a.log.Warn("webauthn registration requested without recent authentication", "op", op,
+			"userID", claims.userID, "amr", claims.auth.AMR, "authTime", claims.auth.AuthTime)
+		return err
+	}
+
+	return nil
+}
+
+// FinishWebAuthnRegistration проверяет ответ аутентификатора и сохраняет ключ под именем name.
+func (a *Auth) FinishWebAuthnRegistration(ctx context.Context, accessToken string, name string, response []byte) (models.WebAuthnCredential, error) {
+	const op = "Auth.FinishWebAuthnRegistration"
+
+	claims, err := a.authenticateClaims(ctx, accessToken)
+	if err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+	userID := claims.userID
+
+	log := a.log.With(
+		"op", op,
+		"userID", userID,
+	)
+
+	if err := a.requireRegistrationAuth(ctx, claims); err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = defaultCredentialName
+	}
+	if utf8.RuneCountInString(name) > maxCredentialNameLen {
+		return models.WebAuthnCredential{}, &ValidationError{Violations: []FieldViolation{{
+			Field:       "name",
+			Description: fmt.Sprintf("must be at most %d characters", maxCredentialNameLen),
+		}}}
+	}
+
+	resp, err := webauthn.ParseRegistrationResponse(response)
+	if err != nil {
+		return models.WebAuthnCredential{}, ErrInvalidWebAuthnResponse
+	}
+	challenge, err := resp.Challenge()
+	if err != nil {
+		return models.WebAuthnCredential{}, ErrInvalidWebAuthnResponse
+	}
+
+	ch, err := a.consumeWebAuthnChallenge(ctx, challenge, models.WebAuthnRegistration)
+	if err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+	if ch.UserID != userID {
+		log.Warn("webauthn challenge issued to another user")
+		return models.WebAuthnCredential{}, ErrInvalidWebAuthnResponse
+	}
+
+	verified, err := a.webAuthn.RP.VerifyRegistration(resp, ch.Challenge, false)
+	if err != nil {
+		log.Warn("webauthn registration rejected", "error", err)
+		return models.WebAuthnCredential{}, ErrInvalidWebAuthnResponse
+	}
+
+	cred := models.WebAuthnCredential{
+		UserID:       userID,
+		CredentialID: verified.ID,
+		PublicKey:    verified.PublicKey,
+		SignCount:    verified.SignCount,
+		Name:         name,
+		CreatedAt:    time.Now(),
+	}
+
+	cred.ID, err = a.webAuthnStorage.SaveWebAuthnCredential(ctx, cred)
+	if err != nil {
+		if errors.Is(err, storage.ErrCredentialExists) {
+			log.Warn("webauthn credential already registered")
+			return models.WebAuthnCredential{}, ErrWebAuthnCredentialExists
+		}
+		log.Error("failed to save webauthn credential", "error", err)
+		return models.WebAuthnCredential{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("webauthn credential registered", "credentialID", cred.ID)
+	return cred, nil
+}
+
+// ListWebAuthnCredentials возвращает ключи владельца access токена.
+func (a *Auth) ListWebAuthnCredentials(ctx context.Context, accessToken string) ([]models.WebAuthnCredential, error) {
+	const op = "Auth.ListWebAuthnCredentials"
+
+	userID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := a.webAuthnStorage.WebAuthnCredentials(ctx, userID)
+	if err != nil {
+		a.log.Error("failed to retrieve webauthn credentials", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return creds, nil
+}
+
+// RemoveWebAuthnCredential удаляет ключ владельца access токена.
+func (a *Auth) RemoveWebAuthnCredential(ctx context.Context, accessToken string, credentialID int64) error {
+	const op = "Auth.RemoveWebAuthnCredential"
+
+	userID, err := a.authenticate(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+
+	if err := a.webAuthnStorage.DeleteWebAuthnCredential(ctx, userID, credentialID); err != nil {
+		if errors.Is(err, storage.ErrCredentialNotFound) {
+			return ErrWebAuthnNotFound
+		}
+		a.log.Error("failed to delete webauthn credential", "op", op, "error", err)
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	a.log.Info("webauthn credential removed", "op", op, "userID", userID, "credentialID", credentialID)
+	return nil
+}
+
+// BeginWebAuthnLogin начинает вход ключом без пароля и возвращает JSON
+// PublicKeyCredentialRequestOptions. Если login пуст, подойдет любой discoverable
+// ключ (passkey), и пользователь определится по ответу аутентификатора.
+// Для неизвестного пользователя и пользователя без ключей возвращается такой же
+// ответ с фиктивным ключом, чтобы по нему нельзя было проверить наличие аккаунта.
+func (a *Auth) BeginWebAuthnLogin(ctx context.Context, login string, appID int) ([]byte, error) {
+	const op = "Auth.BeginWebAuthnLogin"
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return nil, storage.ErrAppNotFound
+		}
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	var (
+		userID int64
+		allow  [][]byte
+	)
+	if login != "" {
+		user, err := a.userByLogin(ctx, login, app)
+		switch {
+		case err == nil:
+			if allow, err = a.credentialIDs(ctx, user.ID); err != nil {
+				return nil, fmt.Errorf("%s: %v", op, err)
+			}
+			if len(allow) > 0 {
+				userID = user.ID
+			}
+		case errors.Is(err, storage.ErrUserNotFound):
+		default:
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+
+		if len(allow) == 0 {
+			allow = [][]byte{dummyCredentialID(app, login)}
+		}
+	}
+
+	challenge, err := a.newWebAuthnChallenge(ctx, models.WebAuthnLogin, userID, app.ID)
+	if err != nil {
+		a.log.Error("failed to save webauthn challenge", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	// Без пароля ключ должен проверить пользователя (PIN или биометрия)
+	options, err := a.webAuthn.RP.RequestOptions(challenge, allow, webauthn.UVRequired, a.webAuthn.ChallengeTTL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return options, nil
+}
+
+// FinishWebAuthnLogin проверяет ответ аутентификатора и выпускает токены.
+// Ключ с проверкой пользователя сам является многофакторным, поэтому второй
+// фактор после него не запрашивается. Из req учитываются только запрошенные scope.
+// Неудачные проверки ключа учитываются в блокировке аккаунта.
+func (a *Auth) FinishWebAuthnLogin(ctx context.Context, response []byte, appID int, req AuthRequirements) (string, string, error) {
+	const op = "Auth.FinishWebAuthnLogin"
+
+	if err := req.validate(); err != nil {
+		return "", "", err
+	}
+
+	// Scope проверяются до того, как будет погашен одноразовый запрос входа
+	scope, err := a.grantScope(ctx, appID, req.Scope)
+	if err != nil {
+		if errors.Is(err, ErrInvalidScope) {
+			a.log.Warn("requested scope not allowed", "op", op, "error", err)
+			return "", "", err
+		}
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	resp, err := webauthn.ParseAssertionResponse(response)
+	if err != nil {
+		return "", "", ErrInvalidWebAuthnResponse
+	}
+	challenge, err := resp.Challenge()
+	if err != nil {
+		return "", "", ErrInvalidWebAuthnResponse
+	}
+
+	ch, err := a.consumeWebAuthnChallenge(ctx, challenge, models.WebAuthnLogin)
+	if err != nil {
+		return "", "", err
+	}
+	if ch.AppID != appID {
+		return "", "", ErrInvalidWebAuthnResponse
+	}
+
+	cred, err := a.webAuthnStorage.WebAuthnCredential(ctx, resp.CredentialID)
+	if err != nil {
+		if errors.Is(err, storage.ErrCredentialNotFound) {
+			a.log.Warn("unknown webauthn credential", "op", op)
+			return "", "", ErrInvalidCredentials
+		}
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	log := a.log.With(
+		"op", op,
+		"userID", cred.UserID,
+	)
+
+	if ch.UserID != 0 && ch.UserID != cred.UserID {
+		log.Warn("webauthn credential belongs to another user")
+		return "", "", ErrInvalidCredentials
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, cred.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", "", ErrInvalidCredentials
+		}
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	if now := time.Now(); user.LockedUntil.After(now) {
+		log.Warn("account is locked", "lockedUntil", user.LockedUntil)
+		return "", "", &LockedError{RetryAfter: user.LockedUntil.Sub(now)}
+	}
+
+	if len(resp.UserHandle) > 0 && !bytes.Equal(resp.UserHandle, userHandle(cred.UserID)) {
+		log.Warn("webauthn user handle mismatch")
+		return "", "", a.registerFailedLogin(ctx, user)
+	}
+	if err := a.checkWebAuthnAssertion(ctx, cred, resp, ch.Challenge, true); err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			return "", "", a.registerFailedLogin(ctx, user)
+		}
+		return "", "", err
+	}
+
+	if user.FailedLoginAttempts > 0 || user.LockoutCount > 0 {
+		if err := a.loginAttempts.ResetLoginAttempts(ctx, user.ID); err != nil {
+			log.Error("failed to reset login attempts", "error", err)
+			return "", "", fmt.Errorf("%s: %v", op, err)
+		}
+	}
+
+	if err := checkStatus(user); err != nil {
+		log.Warn("login rejected by account status", "status", user.Status)
+		return "", "", err
+	}
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	authInfo := newAuthInfo(amrHardwareKey, amrMFA)
+	authInfo.Scope = scope
+
+	accessToken, refreshToken, err := a.issueTokens(ctx, user, app, authInfo)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("user logged in with webauthn")
+	return accessToken, refreshToken, nil
+}
+
+// BeginWebAuthnMFA начинает проверку второго фактора ключом WebAuthn после входа
+// по паролю и возвращает JSON PublicKeyCredentialRequestOptions.
+func (a *Auth) BeginWebAuthnMFA(ctx context.Context, challengeToken string) ([]byte, error) {
+	const op = "Auth.BeginWebAuthnMFA"
+
+	mfaChallenge, err := a.mfaChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	user := mfaChallenge.user
+
+	allow, err := a.credentialIDs(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	if len(allow) == 0 {
+		return nil, ErrMFANotEnabled
+	}
+
+	challenge, err := a.newWebAuthnChallenge(ctx, models.WebAuthnMFA, user.ID, mfaChallenge.app.ID)
+	if err != nil {
+		a.log.Error("failed to save webauthn challenge", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	options, err := a.webAuthn.RP.RequestOptions(challenge, allow, webauthn.UVDiscouraged, a.webAuthn.ChallengeTTL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return options, nil
+}
+
+// FinishWebAuthnMFA завершает вход вторым фактором WebAuthn и выпускает токены.
+// Неудачные проверки учитываются в блокировке аккаунта, как и неверные коды.
+func (a *Auth) FinishWebAuthnMFA(ctx context.Context, challengeToken string, response []byte) (string, string, error) {
+	const op = "Auth.FinishWebAuthnMFA"
+
+	mfaChallenge, err := a.mfaChallenge(ctx, challengeToken)
+	if err != nil {
+		return "", "", err
+	}
+	user := mfaChallenge.user
+
+	log := a.log.With(
+		"op", op,
+		"userID", user.ID,
+	)
+
+	authInfo, err := mfaChallenge.complete(amrHardwareKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	resp, err := webauthn.ParseAssertionResponse(response)
+	if err != nil {
+		return "", "", ErrInvalidWebAuthnResponse
+	}
+	challenge, err := resp.Challenge()
+	if err != nil {
+		return "", "", ErrInvalidWebAuthnResponse
+	}
+
+	ch, err := a.consumeWebAuthnChallenge(ctx, challenge, models.WebAuthnMFA)
+	if err != nil {
+		return "", "", err
+	}
+	if ch.UserID != user.ID {
+		log.Warn("webauthn challenge issued to another user")
+		return "", "", ErrInvalidWebAuthnResponse
+	}
+
+	cred, err := a.webAuthnStorage.WebAuthnCredential(ctx, resp.CredentialID)
+	if err != nil && !errors.Is(err, storage.ErrCredentialNotFound) {
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+	if err == nil && cred.UserID == user.ID {
+		err = a.checkWebAuthnAssertion(ctx, cred, resp, ch.Challenge, false)
+	} else {
+		err = ErrInvalidCredentials
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			log.Warn("webauthn second factor rejected")
+			return "", "", a.registerFailedMFA(ctx, user)
+		}
+		return "", "", err
+	}
+
+	accessToken, refreshToken, err := a.issueTokens(ctx, user, mfaChallenge.app, authInfo)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	log.Info("webauthn mfa verified, user logged in")
+	return accessToken, refreshToken, nil
+}
+
+// checkWebAuthnAssertion проверяет подпись ключа и сохраняет новый счетчик подписей.
+// Счетчик, который не вырос, означает, что ключ мог быть скопирован: вход отклоняется.
+func (a *Auth) checkWebAuthnAssertion(ctx context.Context, cred models.WebAuthnCredential, resp webauthn.AssertionResponse, challenge []byte, requireUV bool) error {
+	const op = "Auth.checkWebAuthnAssertion"
+
+	log := a.log.With(
+		"op", op,
+		"userID", cred.UserID,
+		"credentialID", cred.ID,
+	)
+
+	res, err := a.webAuthn.RP.VerifyAssertion(resp, challenge, cred.PublicKey, cred.SignCount, requireUV)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrCounterRegression) {
+			log.Error("webauthn sign counter did not increase, authenticator may be cloned",
+				"stored", cred.SignCount)
+		} else {
+			log.Warn("webauthn assertion rejected", "error", err)
+		}
+		return ErrInvalidCredentials
+	}
+
+	fresh, err := a.webAuthnStorage.UpdateWebAuthnSignCount(ctx, cred.ID, res.SignCount)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if !fresh {
+		log.Error("webauthn sign counter already used, authenticator may be cloned", "signCount", res.SignCount)
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
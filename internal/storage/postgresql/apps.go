@@ -0,0 +1,239 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/envelope"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+// CreateApp добавляет приложение и возвращает его с присвоенным ID.
+func (s *Storage) CreateApp(ctx context.Context, app models.App) (models.App, error) {
+	const op = "storage.postgresql.CreateApp"
+
+	// ID нужен до вставки: зашифрованный секрет привязан к строке приложения
+	err := s.db.QueryRowContext(ctx, "SELECT nextval(pg_get_serial_sequence('apps', 'id'))").Scan(&app.ID)
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	encrypted, err := s.encryptAppSecret(app.ID, app.Secret)
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		"INSERT INTO apps(id, name, secret, trusted) VALUES($1, $2, $3, $4)",
+		app.ID, app.Name, encrypted, app.Trusted,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.App{}, fmt.Errorf("%s: %w", op, storage.ErrAppExists)
+		}
+		return models.App{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return app, nil
+}
+
+// Apps возвращает все приложения в порядке ID. Секреты не загружаются.
+func (s *Storage) Apps(ctx context.Context) ([]models.App, error) {
+	const op = "storage.postgresql.Apps"
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name, trusted FROM apps ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var apps []models.App
+	for rows.Next() {
+		var app models.App
+		if err := rows.Scan(&app.ID, &app.Name, &app.Trusted); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		apps = append(apps, app)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return apps, nil
+}
+
+// UpdateApp сохраняет название и настройки приложения. Секрет не меняется.
+func (s *Storage) UpdateApp(ctx context.Context, app models.App) error {
+	const op = "storage.postgresql.UpdateApp"
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE apps SET name = $2, trusted = $3 WHERE id = $1",
+		app.ID, app.Name, app.Trusted,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%s: %w", op, storage.ErrAppExists)
+		}
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return checkAppAffected(op, res)
+}
+
+// SetAppSecret заменяет секрет приложения.
+func (s *Storage) SetAppSecret(ctx context.Context, appID int, secret string) error {
+	const op = "storage.postgresql.SetAppSecret"
+
+	encrypted, err := s.encryptAppSecret(appID, secret)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	res, err := s.db.ExecContext(ctx, "UPDATE apps SET secret = $2 WHERE id = $1", appID, encrypted)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return checkAppAffected(op, res)
+}
+
+// DeleteApp удаляет приложение вместе с его ролями, scope, политиками и приглашениями.
+func (s *Storage) DeleteApp(ctx context.Context, appID int) error {
+	const op = "storage.postgresql.DeleteApp"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM apps WHERE id = $1", appID)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return checkAppAffected(op, res)
+}
+
+// ReencryptAppSecrets перешифровывает текущим мастер-ключом секреты,
+// зашифрованные старыми ключами или хранящиеся открытым текстом, и возвращает
+// их число. После этого старые ключи можно убрать из конфигурации.
+func (s *Storage) ReencryptAppSecrets(ctx context.Context) (int, error) {
+	const op = "storage.postgresql.ReencryptAppSecrets"
+
+	if s.secrets == nil {
+		return 0, fmt.Errorf("%s: app secrets keyring is not configured", op)
+	}
+
+	n, err := s.reencryptAppSecrets(ctx, s.secrets.NeedsReencrypt)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return n, nil
+}
+
+// reencryptAppSecrets перешифровывает текущим мастер-ключом секреты, для
+// которых stale возвращает true.
+func (s *Storage) reencryptAppSecrets(ctx context.Context, stale func(stored string) bool) (int, error) {
+	const op = "storage.postgresql.reencryptAppSecrets"
+
+	if s.secrets == nil {
+		return 0, fmt.Errorf("%s: app secrets keyring is not configured", op)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, secret FROM apps ORDER BY id FOR UPDATE")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	found := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var stored string
+		if err := rows.Scan(&id, &stored); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%s: %v", op, err)
+		}
+		if stale(stored) {
+			found[id] = stored
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	for id, stored := range found {
+		secret := stored
+		if envelope.Encrypted(stored) {
+			secret, err = s.decryptAppSecret(id, stored)
+			if err != nil {
+				return 0, fmt.Errorf("%s: app %d: %v", op, id, err)
+			}
+		}
+
+		encrypted, err := s.encryptAppSecret(id, secret)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", op, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE apps SET secret = $2 WHERE id = $1", id, encrypted); err != nil {
+			return 0, fmt.Errorf("%s: %v", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return len(found), nil
+}
+
+// encryptAppSecret шифрует секрет приложения для хранения в apps.secret.
+func (s *Storage) encryptAppSecret(appID int, secret string) (string, error) {
+	if s.secrets == nil {
+		return "", errors.New("app secrets keyring is not configured")
+	}
+
+	return s.secrets.Encrypt([]byte(secret), appSecretAAD(appID))
+}
+
+// decryptAppSecret расшифровывает apps.secret. Секреты открытым текстом
+// отвергаются: их шифрует EncryptPlaintextSecrets при запуске сервера.
+func (s *Storage) decryptAppSecret(appID int, stored string) (string, error) {
+	if !envelope.Encrypted(stored) {
+		return "", errPlaintextSecret
+	}
+	if s.secrets == nil {
+		return "", errors.New("app secrets keyring is not configured")
+	}
+
+	secret, err := s.secrets.Decrypt(stored, appSecretAAD(appID))
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret), nil
+}
+
+func appSecretAAD(appID int) string {
+	return "apps.secret:" + strconv.Itoa(appID)
+}
+
+// checkAppAffected возвращает storage.ErrAppNotFound, если запрос не затронул ни одной строки.
+func checkAppAffected(op string, res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+
+	return nil
+}
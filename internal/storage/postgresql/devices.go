@@ -0,0 +1,115 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+// SaveTrustedDevice сохраняет доверенное устройство и удаляет просроченные устройства пользователя.
+func (s *Storage) SaveTrustedDevice(ctx context.Context, device models.TrustedDevice, tokenHash []byte) (int64, error) {
+	const op = "storage.postgresql.SaveTrustedDevice"
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM trusted_devices WHERE user_id = $1 AND expires_at < now()", device.UserID); err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	var id int64
+	err := s.db.QueryRowContext(ctx,
+		"INSERT INTO trusted_devices(user_id, token_hash, name, expires_at) VALUES($1, $2, $3, $4) RETURNING id",
+		device.UserID, tokenHash, device.Name, device.ExpiresAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return id, nil
+}
+
+// UseTrustedDevice проверяет, что токен принадлежит действующему доверенному
+// устройству пользователя, и запоминает время использования.
+func (s *Storage) UseTrustedDevice(ctx context.Context, userID int64, tokenHash []byte) (bool, error) {
+	const op = "storage.postgresql.UseTrustedDevice"
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE trusted_devices SET last_used_at = now() WHERE user_id = $1 AND token_hash = $2 AND expires_at > now()",
+		userID, tokenHash,
+	)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return n > 0, nil
+}
+
+// TrustedDevices возвращает действующие доверенные устройства пользователя.
+func (s *Storage) TrustedDevices(ctx context.Context, userID int64) ([]models.TrustedDevice, error) {
+	const op = "storage.postgresql.TrustedDevices"
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, name, expires_at, created_at, last_used_at
+		FROM trusted_devices WHERE user_id = $1 AND expires_at > now() ORDER BY id`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var devices []models.TrustedDevice
+	for rows.Next() {
+		var (
+			device     models.TrustedDevice
+			lastUsedAt sql.NullTime
+		)
+		if err := rows.Scan(&device.ID, &device.UserID, &device.Name, &device.ExpiresAt, &device.CreatedAt, &lastUsedAt); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		device.LastUsedAt = lastUsedAt.Time
+		devices = append(devices, device)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return devices, nil
+}
+
+// DeleteTrustedDevice отзывает доверенное устройство пользователя.
+func (s *Storage) DeleteTrustedDevice(ctx context.Context, userID int64, id int64) error {
+	const op = "storage.postgresql.DeleteTrustedDevice"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM trusted_devices WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrDeviceNotFound)
+	}
+
+	return nil
+}
+
+// DeleteTrustedDevices отзывает все доверенные устройства пользователя.
+func (s *Storage) DeleteTrustedDevices(ctx context.Context, userID int64) error {
+	const op = "storage.postgresql.DeleteTrustedDevices"
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM trusted_devices WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
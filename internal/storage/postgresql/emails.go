@@ -0,0 +1,76 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+// UsersWithNonASCIIEmail возвращает пользователей, у которых email содержит
+// символы вне ASCII — обычно интернационализированный домен, еще не переведенный
+// в punycode. Загружаются только ID и email.
+func (s *Storage) UsersWithNonASCIIEmail(ctx context.Context) ([]models.User, error) {
+	const op = "storage.postgresql.UsersWithNonASCIIEmail"
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id, email FROM users WHERE email ~ '[^\\x01-\\x7f]' ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Email); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return users, nil
+}
+
+// UpdateUserEmail заменяет email пользователя и его email-идентификатор.
+// Если email уже занят другим пользователем, возвращает storage.ErrUserExists.
+func (s *Storage) UpdateUserEmail(ctx context.Context, userID int64, email string) error {
+	const op = "storage.postgresql.UpdateUserEmail"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE users SET email = $2, updated_at = now() WHERE id = $1", userID, email)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if err := checkUserAffected(op, res); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE user_identifiers SET value = $3 WHERE user_id = $1 AND kind = $2",
+		userID, models.IdentifierEmail, email,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+// Identifier ищет идентификатор по виду и нормализованному значению. Значение
+// могут заявить несколько пользователей, пока никто его не подтвердил; тогда
+// возвращается подтвержденный идентификатор или самая ранняя заявка.
+func (s *Storage) Identifier(ctx context.Context, kind models.IdentifierKind, value string) (models.Identifier, error) {
+	const op = "storage.postgresql.Identifier"
+
+	var (
+		ident      models.Identifier
+		verifiedAt sql.NullTime
+	)
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, user_id, kind, value, verified_at FROM user_identifiers WHERE kind = $1 AND value = $2 ORDER BY verified_at IS NULL, id LIMIT 1",
+		kind, value,
+	).Scan(&ident.ID, &ident.UserID, &ident.Kind, &ident.Value, &verifiedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Identifier{}, fmt.Errorf("%s: %w", op, storage.ErrIdentifierNotFound)
+		}
+		return models.Identifier{}, fmt.Errorf("%s: %v", op, err)
+	}
+	if verifiedAt.Valid {
+		ident.VerifiedAt = verifiedAt.Time
+	}
+
+	return ident, nil
+}
+
+// Identifiers возвращает все идентификаторы пользователя.
+func (s *Storage) Identifiers(ctx context.Context, userID int64) ([]models.Identifier, error) {
+	const op = "storage.postgresql.Identifiers"
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, user_id, kind, value, verified_at FROM user_identifiers WHERE user_id = $1 ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var idents []models.Identifier
+	for rows.Next() {
+		var (
+			ident      models.Identifier
+			verifiedAt sql.NullTime
+		)
+		if err := rows.Scan(&ident.ID, &ident.UserID, &ident.Kind, &ident.Value, &verifiedAt); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		if verifiedAt.Valid {
+			ident.VerifiedAt = verifiedAt.Time
+		}
+		idents = append(idents, ident)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return idents, nil
+}
+
+// SaveIdentifier добавляет идентификатор пользователю. Если codeHash не пуст,
+// идентификатор ожидает подтверждения кодом до expiresAt, а отправка кода
+// учитывается в CountIdentifierCodeSends.
+func (s *Storage) SaveIdentifier(ctx context.Context, ident models.Identifier, codeHash []byte, expiresAt time.Time) (int64, error) {
+	const op = "storage.postgresql.SaveIdentifier"
+
+	var verifiedAt, codeExpiresAt sql.NullTime
+	if ident.Verified() {
+		verifiedAt = sql.NullTime{Time: ident.VerifiedAt, Valid: true}
+	}
+	if len(codeHash) > 0 {
+		codeExpiresAt = sql.NullTime{Time: expiresAt, Valid: true}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO user_identifiers(user_id, kind, value, verified_at, verification_code_hash, verification_expires_at)
+		VALUES($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		ident.UserID, ident.Kind, ident.Value, verifiedAt, codeHash, codeExpiresAt,
+	).Scan(&id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrIdentifierExists)
+		}
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if len(codeHash) > 0 {
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO identifier_code_sends(user_id, kind, value) VALUES($1, $2, $3)",
+			ident.UserID, ident.Kind, ident.Value,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return id, nil
+}
+
+// SetIdentifierCode назначает неподтвержденному идентификатору пользователя новый
+// код подтверждения до expiresAt и сбрасывает счетчик попыток. Отправка кода
+// учитывается в CountIdentifierCodeSends. Если неподтвержденного идентификатора
+// нет, возвращает storage.ErrIdentifierNotFound.
+func (s *Storage) SetIdentifierCode(ctx context.Context, userID int64, kind models.IdentifierKind, codeHash []byte, expiresAt time.Time) error {
+	const op = "storage.postgresql.SetIdentifierCode"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	var value string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE user_identifiers
+		SET verification_code_hash = $3, verification_expires_at = $4, verification_attempts = 0
+		WHERE user_id = $1 AND kind = $2 AND verified_at IS NULL
+		RETURNING value`,
+		userID, kind, codeHash, expiresAt,
+	).Scan(&value)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrIdentifierNotFound)
+		}
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO identifier_code_sends(user_id, kind, value) VALUES($1, $2, $3)",
+		userID, kind, value,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+// CountIdentifierCodeSends возвращает число кодов подтверждения, отправленных с
+// момента since пользователю userID (на любые адреса) и на адрес value (любыми пользователями).
+func (s *Storage) CountIdentifierCodeSends(ctx context.Context, userID int64, kind models.IdentifierKind, value string, since time.Time) (int, int, error) {
+	const op = "storage.postgresql.CountIdentifierCodeSends"
+
+	var byUser, byValue int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT count(*) FILTER (WHERE user_id = $1), count(*) FILTER (WHERE kind = $2 AND value = $3)
+		FROM identifier_code_sends
+		WHERE sent_at > $4 AND (user_id = $1 OR (kind = $2 AND value = $3))`,
+		userID, kind, value, since,
+	).Scan(&byUser, &byValue)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return byUser, byValue, nil
+}
+
+// ConfirmIdentifier подтверждает идентификатор пользователя, если codeHash совпадает
+// с сохраненным, код не истек и число попыток меньше maxAttempts.
+// Неудачная попытка увеличивает счетчик попыток. Заявки других пользователей
+// на то же значение удаляются; если значение уже подтвердил другой
+// пользователь, возвращается storage.ErrIdentifierExists.
+func (s *Storage) ConfirmIdentifier(ctx context.Context, userID int64, kind models.IdentifierKind, codeHash []byte, maxAttempts int) (bool, error) {
+	const op = "storage.postgresql.ConfirmIdentifier"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	var value string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE user_identifiers
+		SET verified_at = now(), verification_code_hash = NULL, verification_expires_at = NULL, verification_attempts = 0
+		WHERE user_id = $1 AND kind = $2 AND verified_at IS NULL
+		  AND verification_code_hash = $3 AND verification_expires_at > now() AND verification_attempts < $4
+		RETURNING value`,
+		userID, kind, codeHash, maxAttempts,
+	).Scan(&value)
+	switch {
+	case err == nil:
+		_, err = tx.ExecContext(ctx,
+			"DELETE FROM user_identifiers WHERE kind = $1 AND value = $2 AND verified_at IS NULL",
+			kind, value,
+		)
+		if err != nil {
+			return false, fmt.Errorf("%s: %v", op, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return false, fmt.Errorf("%s: %v", op, err)
+		}
+		return true, nil
+	case isUniqueViolation(err):
+		return false, fmt.Errorf("%s: %w", op, storage.ErrIdentifierExists)
+	case !errors.Is(err, sql.ErrNoRows):
+		return false, fmt.Errorf("%s: %v", op, err)
+	}
+	res, err := tx.ExecContext(ctx,
+		"UPDATE user_identifiers SET verification_attempts = verification_attempts + 1 WHERE user_id = $1 AND kind = $2 AND verified_at IS NULL",
+		userID, kind,
+	)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", op, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, fmt.Errorf("%s: %v", op, err)
+	} else if n == 0 {
+		return false, fmt.Errorf("%s: %w", op, storage.ErrIdentifierNotFound)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return false, nil
+}
+
+// DeleteIdentifier удаляет идентификатор пользователя указанного вида.
+func (s *Storage) DeleteIdentifier(ctx context.Context, userID int64, kind models.IdentifierKind) error {
+	const op = "storage.postgresql.DeleteIdentifier"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM user_identifiers WHERE user_id = $1 AND kind = $2", userID, kind)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrIdentifierNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/lib/pq"
+)
+
+// SaveImportedUsers добавляет пачку пользователей одной транзакцией и возвращает
+// индексы в users тех, кто не был добавлен, потому что уже существует (в базе
+// или ранее в пачке) или его email занят идентификатором другого пользователя.
+// Email должен быть нормализован.
+func (s *Storage) SaveImportedUsers(ctx context.Context, users []models.User) ([]int, error) {
+	const op = "storage.postgresql.SaveImportedUsers"
+
+	emails := make([]string, len(users))
+	hashes := make([][]byte, len(users))
+	for i, u := range users {
+		emails[i] = u.Email
+		hashes[i] = u.PassHash
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		INSERT INTO users(email, pass_hash)
+		SELECT * FROM unnest($1::TEXT[], $2::BYTEA[])
+		ON CONFLICT ((lower(email))) DO NOTHING
+		RETURNING id, email`,
+		pq.Array(emails), pq.ByteaArray(hashes),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	inserted := make(map[string]struct{}, len(users))
+	var (
+		ids            []int64
+		insertedEmails []string
+	)
+	for rows.Next() {
+		var (
+			id    int64
+			email string
+		)
+		if err := rows.Scan(&id, &email); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		inserted[email] = struct{}{}
+		ids = append(ids, id)
+		insertedEmails = append(insertedEmails, email)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	rows.Close()
+
+	// Email может быть уже занят идентификатором другого пользователя: без
+	// идентификатора войти нельзя, поэтому такие пользователи не добавляются
+	// и попадают в дубликаты
+	rows, err = tx.QueryContext(ctx, `
+		INSERT INTO user_identifiers(user_id, kind, value)
+		SELECT id, $3, email FROM unnest($1::INTEGER[], $2::TEXT[]) AS t(id, email)
+		ON CONFLICT DO NOTHING
+		RETURNING user_id`,
+		pq.Array(ids), pq.Array(insertedEmails), models.IdentifierEmail,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	withIdentifier := make(map[int64]struct{}, len(ids))
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		withIdentifier[id] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	rows.Close()
+
+	var conflicting []int64
+	for i, id := range ids {
+		if _, ok := withIdentifier[id]; !ok {
+			conflicting = append(conflicting, id)
+			delete(inserted, insertedEmails[i])
+		}
+	}
+	if len(conflicting) > 0 {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = ANY($1)", pq.Array(conflicting)); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	var duplicates []int
+	for i, email := range emails {
+		if _, ok := inserted[email]; ok {
+			// Повторы внутри пачки тоже дубликаты: добавлен только первый
+			delete(inserted, email)
+			continue
+		}
+		duplicates = append(duplicates, i)
+	}
+
+	return duplicates, nil
+}
@@ -0,0 +1,190 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+const invitationColumns = "id, org_id, app_id, email, role, invited_by, expires_at, created_at, accepted_at, accepted_by"
+
+func scanInvitation(row rowScanner) (models.Invitation, error) {
+	var (
+		inv        models.Invitation
+		invitedBy  sql.NullInt64
+		acceptedAt sql.NullTime
+		acceptedBy sql.NullInt64
+	)
+	err := row.Scan(&inv.ID, &inv.OrgID, &inv.AppID, &inv.Email, &inv.Role, &invitedBy, &inv.ExpiresAt, &inv.CreatedAt, &acceptedAt, &acceptedBy)
+	if err != nil {
+		return models.Invitation{}, err
+	}
+	inv.InvitedBy = invitedBy.Int64
+	inv.AcceptedAt = acceptedAt.Time
+	inv.AcceptedBy = acceptedBy.Int64
+
+	return inv, nil
+}
+
+// SaveInvitation сохраняет приглашение. Прежние непринятые приглашения того же
+// email в организацию удаляются, чтобы действовала только последняя ссылка.
+func (s *Storage) SaveInvitation(ctx context.Context, inv models.Invitation) (models.Invitation, error) {
+	const op = "storage.postgresql.SaveInvitation"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM org_invitations WHERE org_id = $1 AND lower(email) = lower($2) AND accepted_at IS NULL",
+		inv.OrgID, inv.Email,
+	)
+	if err != nil {
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	inv, err = scanInvitation(tx.QueryRowContext(ctx, `
+		INSERT INTO org_invitations(id, org_id, app_id, email, role, invited_by, expires_at)
+		VALUES($1, $2, $3, $4, $5, NULLIF($6, 0), $7)
+		RETURNING `+invitationColumns,
+		inv.ID, inv.OrgID, inv.AppID, inv.Email, inv.Role, inv.InvitedBy, inv.ExpiresAt,
+	))
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return models.Invitation{}, fmt.Errorf("%s: %w", op, storage.ErrOrgNotFound)
+		}
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return inv, nil
+}
+
+// Invitation возвращает действующее приглашение: не принятое и не просроченное.
+func (s *Storage) Invitation(ctx context.Context, id string) (models.Invitation, error) {
+	const op = "storage.postgresql.Invitation"
+
+	inv, err := scanInvitation(s.db.QueryRowContext(ctx,
+		"SELECT "+invitationColumns+" FROM org_invitations WHERE id = $1 AND accepted_at IS NULL AND expires_at > now()",
+		id,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Invitation{}, fmt.Errorf("%s: %w", op, storage.ErrInvitationNotFound)
+		}
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return inv, nil
+}
+
+// Invitations возвращает действующие приглашения организации.
+func (s *Storage) Invitations(ctx context.Context, orgID int64) ([]models.Invitation, error) {
+	const op = "storage.postgresql.Invitations"
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+invitationColumns+` FROM org_invitations
+		WHERE org_id = $1 AND accepted_at IS NULL AND expires_at > now()
+		ORDER BY created_at`,
+		orgID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var invitations []models.Invitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		invitations = append(invitations, inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return invitations, nil
+}
+
+// DeleteInvitation отзывает непринятое приглашение организации.
+func (s *Storage) DeleteInvitation(ctx context.Context, orgID int64, id string) error {
+	const op = "storage.postgresql.DeleteInvitation"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM org_invitations WHERE id = $1 AND org_id = $2 AND accepted_at IS NULL", id, orgID)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrInvitationNotFound)
+	}
+
+	return nil
+}
+
+// AcceptInvitation погашает приглашение и добавляет пользователя в организацию
+// с ролью из приглашения. Если email пользователя совпадает с адресом приглашения,
+// он считается подтвержденным: ссылка пришла на этот адрес.
+func (s *Storage) AcceptInvitation(ctx context.Context, id string, userID int64) (models.Invitation, error) {
+	const op = "storage.postgresql.AcceptInvitation"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	inv, err := scanInvitation(tx.QueryRowContext(ctx, `
+		UPDATE org_invitations SET accepted_at = now(), accepted_by = $2
+		WHERE id = $1 AND accepted_at IS NULL AND expires_at > now()
+		RETURNING `+invitationColumns,
+		id, userID,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Invitation{}, fmt.Errorf("%s: %w", op, storage.ErrInvitationNotFound)
+		}
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO org_members(org_id, user_id, role) VALUES($1, $2, $3)", inv.OrgID, userID, inv.Role)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.Invitation{}, fmt.Errorf("%s: %w", op, storage.ErrMemberExists)
+		}
+		if isForeignKeyViolation(err) {
+			return models.Invitation{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE user_identifiers SET verified_at = now()
+		WHERE user_id = $1 AND kind = $2 AND lower(value) = lower($3) AND verified_at IS NULL`,
+		userID, models.IdentifierEmail, inv.Email,
+	)
+	if err != nil {
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Invitation{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return inv, nil
+}
@@ -0,0 +1,335 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/envelope"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+	"github.com/lib/pq"
+)
+
+// SaveTOTPSecret сохраняет новый неподтвержденный секрет TOTP, заменяя прежний
+// неподтвержденный. Если TOTP уже подключен, возвращает storage.ErrMFAAlreadyEnabled.
+func (s *Storage) SaveTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	const op = "storage.postgresql.SaveTOTPSecret"
+
+	encrypted, err := s.encryptTOTPSecret(userID, secret)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_totp(user_id, secret) VALUES($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, confirmed_at = NULL, last_used_step = NULL, created_at = now()
+		WHERE user_totp.confirmed_at IS NULL`,
+		userID, encrypted,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMFAAlreadyEnabled)
+	}
+
+	return nil
+}
+
+// TOTP возвращает секрет TOTP пользователя.
+func (s *Storage) TOTP(ctx context.Context, userID int64) (models.TOTP, error) {
+	const op = "storage.postgresql.TOTP"
+
+	var (
+		totp         models.TOTP
+		confirmedAt  sql.NullTime
+		lastUsedStep sql.NullInt64
+	)
+	err := s.db.QueryRowContext(ctx,
+		"SELECT user_id, secret, confirmed_at, last_used_step FROM user_totp WHERE user_id = $1",
+		userID,
+	).Scan(&totp.UserID, &totp.Secret, &confirmedAt, &lastUsedStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.TOTP{}, fmt.Errorf("%s: %w", op, storage.ErrMFANotFound)
+		}
+		return models.TOTP{}, fmt.Errorf("%s: %v", op, err)
+	}
+	totp.ConfirmedAt = confirmedAt.Time
+	totp.LastUsedStep = lastUsedStep.Int64
+
+	totp.Secret, err = s.decryptTOTPSecret(userID, totp.Secret)
+	if err != nil {
+		return models.TOTP{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return totp, nil
+}
+
+// UseTOTPStep запоминает принятый временной шаг и подтверждает подключение TOTP.
+// Возвращает false, если этот или более поздний шаг уже использован.
+func (s *Storage) UseTOTPStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	const op = "storage.postgresql.UseTOTPStep"
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE user_totp
+		SET last_used_step = $2, confirmed_at = COALESCE(confirmed_at, now())
+		WHERE user_id = $1 AND (last_used_step IS NULL OR last_used_step < $2)`,
+		userID, step,
+	)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return n > 0, nil
+}
+
+// DeleteTOTP отключает TOTP пользователя вместе с кодами восстановления.
+func (s *Storage) DeleteTOTP(ctx context.Context, userID int64) error {
+	const op = "storage.postgresql.DeleteTOTP"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMFANotFound)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+// ResetMFA удаляет все вторые факторы пользователя: TOTP, коды восстановления,
+// ключи WebAuthn и доверенные устройства.
+func (s *Storage) ResetMFA(ctx context.Context, userID int64) error {
+	const op = "storage.postgresql.ResetMFA"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if !exists {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	for _, table := range []string{"user_totp", "mfa_recovery_codes", "webauthn_credentials", "trusted_devices"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE user_id = $1", userID); err != nil {
+			return fmt.Errorf("%s: %v", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes заменяет коды восстановления пользователя новыми.
+func (s *Storage) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes [][]byte) error {
+	const op = "storage.postgresql.ReplaceRecoveryCodes"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO mfa_recovery_codes(user_id, code_hash) SELECT $1, unnest($2::BYTEA[])",
+		userID, pq.ByteaArray(codeHashes),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode помечает код восстановления использованным. Возвращает false,
+// если такого неиспользованного кода нет, и число оставшихся кодов.
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID int64, codeHash []byte) (bool, int, error) {
+	const op = "storage.postgresql.UseRecoveryCode"
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE mfa_recovery_codes SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		userID, codeHash,
+	)
+	if err != nil {
+		return false, 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	var remaining int
+	err = s.db.QueryRowContext(ctx,
+		"SELECT count(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL",
+		userID,
+	).Scan(&remaining)
+	if err != nil {
+		return false, 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return n > 0, remaining, nil
+}
+
+// ReencryptTOTPSecrets перешифровывает текущим мастер-ключом секреты TOTP,
+// зашифрованные старыми ключами или хранящиеся открытым текстом, и возвращает их число.
+func (s *Storage) ReencryptTOTPSecrets(ctx context.Context) (int, error) {
+	const op = "storage.postgresql.ReencryptTOTPSecrets"
+
+	if s.secrets == nil {
+		return 0, fmt.Errorf("%s: secrets keyring is not configured", op)
+	}
+
+	n, err := s.reencryptTOTPSecrets(ctx, s.secrets.NeedsReencrypt)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return n, nil
+}
+
+// reencryptTOTPSecrets перешифровывает текущим мастер-ключом секреты TOTP, для
+// которых stale возвращает true.
+func (s *Storage) reencryptTOTPSecrets(ctx context.Context, stale func(stored string) bool) (int, error) {
+	const op = "storage.postgresql.reencryptTOTPSecrets"
+
+	if s.secrets == nil {
+		return 0, fmt.Errorf("%s: secrets keyring is not configured", op)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT user_id, secret FROM user_totp ORDER BY user_id FOR UPDATE")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	found := make(map[int64]string)
+	for rows.Next() {
+		var userID int64
+		var stored string
+		if err := rows.Scan(&userID, &stored); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%s: %v", op, err)
+		}
+		if stale(stored) {
+			found[userID] = stored
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	for userID, stored := range found {
+		secret := stored
+		if envelope.Encrypted(stored) {
+			secret, err = s.decryptTOTPSecret(userID, stored)
+			if err != nil {
+				return 0, fmt.Errorf("%s: user %d: %v", op, userID, err)
+			}
+		}
+
+		encrypted, err := s.encryptTOTPSecret(userID, secret)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", op, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE user_totp SET secret = $2 WHERE user_id = $1", userID, encrypted); err != nil {
+			return 0, fmt.Errorf("%s: %v", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return len(found), nil
+}
+
+// encryptTOTPSecret шифрует секрет TOTP для хранения в user_totp.secret.
+func (s *Storage) encryptTOTPSecret(userID int64, secret string) (string, error) {
+	if s.secrets == nil {
+		return "", errors.New("secrets keyring is not configured")
+	}
+
+	return s.secrets.Encrypt([]byte(secret), totpSecretAAD(userID))
+}
+
+// decryptTOTPSecret расшифровывает user_totp.secret. Секреты открытым текстом
+// отвергаются: их шифрует EncryptPlaintextSecrets при запуске сервера.
+func (s *Storage) decryptTOTPSecret(userID int64, stored string) (string, error) {
+	if !envelope.Encrypted(stored) {
+		return "", errPlaintextSecret
+	}
+	if s.secrets == nil {
+		return "", errors.New("secrets keyring is not configured")
+	}
+
+	secret, err := s.secrets.Decrypt(stored, totpSecretAAD(userID))
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret), nil
+}
+
+func totpSecretAAD(userID int64) string {
+	return "user_totp.secret:" + strconv.FormatInt(userID, 10)
+}
@@ -0,0 +1,255 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+	"github.com/lib/pq"
+)
+
+// Все запросы к участникам ограничены org_id: данные одной организации
+// недоступны через идентификаторы другой.
+
+// CreateOrganization создает организацию и делает ownerID ее владельцем.
+func (s *Storage) CreateOrganization(ctx context.Context, org models.Organization, ownerID int64) (models.Organization, error) {
+	const op = "storage.postgresql.CreateOrganization"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Organization{}, fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO organizations(name, slug) VALUES($1, $2) RETURNING id, created_at",
+		org.Name, org.Slug,
+	).Scan(&org.ID, &org.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.Organization{}, fmt.Errorf("%s: %w", op, storage.ErrOrgExists)
+		}
+		return models.Organization{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO org_members(org_id, user_id, role) VALUES($1, $2, $3)",
+		org.ID, ownerID, models.OrgRoleOwner,
+	)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return models.Organization{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return models.Organization{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Organization{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return org, nil
+}
+
+// Organization ищет организацию по ID.
+func (s *Storage) Organization(ctx context.Context, orgID int64) (models.Organization, error) {
+	const op = "storage.postgresql.Organization"
+
+	var org models.Organization
+	err := s.db.QueryRowContext(ctx, "SELECT id, name, slug, created_at FROM organizations WHERE id = $1", orgID).
+		Scan(&org.ID, &org.Name, &org.Slug, &org.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Organization{}, fmt.Errorf("%s: %w", op, storage.ErrOrgNotFound)
+		}
+		return models.Organization{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return org, nil
+}
+
+// OrgMember возвращает участника организации.
+func (s *Storage) OrgMember(ctx context.Context, orgID int64, userID int64) (models.OrgMember, error) {
+	const op = "storage.postgresql.OrgMember"
+
+	member, err := scanOrgMember(s.db.QueryRowContext(ctx, `
+		SELECT m.org_id, m.user_id, u.email, m.role, m.created_at
+		FROM org_members m JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1 AND m.user_id = $2`,
+		orgID, userID,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.OrgMember{}, fmt.Errorf("%s: %w", op, storage.ErrMemberNotFound)
+		}
+		return models.OrgMember{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return member, nil
+}
+
+// OrgMembers возвращает участников организации.
+func (s *Storage) OrgMembers(ctx context.Context, orgID int64) ([]models.OrgMember, error) {
+	const op = "storage.postgresql.OrgMembers"
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT m.org_id, m.user_id, u.email, m.role, m.created_at
+		FROM org_members m JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1 ORDER BY m.created_at, m.user_id`,
+		orgID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var members []models.OrgMember
+	for rows.Next() {
+		member, err := scanOrgMember(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return members, nil
+}
+
+// UserOrganizations возвращает организации, в которых состоит пользователь.
+func (s *Storage) UserOrganizations(ctx context.Context, userID int64) ([]models.Membership, error) {
+	const op = "storage.postgresql.UserOrganizations"
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT o.id, o.name, o.slug, o.created_at, m.role, m.created_at
+		FROM org_members m JOIN organizations o ON o.id = m.org_id
+		WHERE m.user_id = $1 ORDER BY o.name`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var memberships []models.Membership
+	for rows.Next() {
+		var m models.Membership
+		if err := rows.Scan(&m.Organization.ID, &m.Organization.Name, &m.Organization.Slug, &m.Organization.CreatedAt, &m.Role, &m.JoinedAt); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		memberships = append(memberships, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return memberships, nil
+}
+
+// AddOrgMember добавляет пользователя в организацию.
+func (s *Storage) AddOrgMember(ctx context.Context, orgID int64, userID int64, role models.OrgRole) error {
+	const op = "storage.postgresql.AddOrgMember"
+
+	_, err := s.db.ExecContext(ctx, "INSERT INTO org_members(org_id, user_id, role) VALUES($1, $2, $3)", orgID, userID, role)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%s: %w", op, storage.ErrMemberExists)
+		}
+		if isForeignKeyViolation(err) {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Constraint == "org_members_org_id_fkey" {
+				return fmt.Errorf("%s: %w", op, storage.ErrOrgNotFound)
+			}
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+// UpdateOrgMemberRole меняет роль участника. Последнего владельца понизить нельзя.
+func (s *Storage) UpdateOrgMemberRole(ctx context.Context, orgID int64, userID int64, role models.OrgRole) error {
+	const op = "storage.postgresql.UpdateOrgMemberRole"
+
+	err := s.changeOrgMember(ctx, orgID, userID, role != models.OrgRoleOwner, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE org_members SET role = $1 WHERE org_id = $2 AND user_id = $3", role, orgID, userID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RemoveOrgMember удаляет участника из организации. Последнего владельца удалить нельзя.
+func (s *Storage) RemoveOrgMember(ctx context.Context, orgID int64, userID int64) error {
+	const op = "storage.postgresql.RemoveOrgMember"
+
+	err := s.changeOrgMember(ctx, orgID, userID, true, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM org_members WHERE org_id = $1 AND user_id = $2", orgID, userID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// changeOrgMember выполняет change для существующего участника. Если losesOwner и
+// участник — единственный владелец, возвращает storage.ErrLastOwner. Строка
+// организации блокируется, чтобы два запроса не удалили последних владельцев одновременно.
+func (s *Storage) changeOrgMember(ctx context.Context, orgID int64, userID int64, losesOwner bool, change func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	if err := tx.QueryRowContext(ctx, "SELECT id FROM organizations WHERE id = $1 FOR UPDATE", orgID).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrOrgNotFound
+		}
+		return err
+	}
+
+	var (
+		role   models.OrgRole
+		owners int
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT role, (SELECT count(*) FROM org_members WHERE org_id = $1 AND role = 'owner')
+		FROM org_members WHERE org_id = $1 AND user_id = $2`,
+		orgID, userID,
+	).Scan(&role, &owners)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrMemberNotFound
+		}
+		return err
+	}
+
+	if losesOwner && role == models.OrgRoleOwner && owners <= 1 {
+		return storage.ErrLastOwner
+	}
+
+	if err := change(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func scanOrgMember(row rowScanner) (models.OrgMember, error) {
+	var member models.OrgMember
+	err := row.Scan(&member.OrgID, &member.UserID, &member.Email, &member.Role, &member.CreatedAt)
+
+	return member, err
+}
@@ -0,0 +1,92 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+// SavePasswordlessLogin сохраняет запрос входа без пароля и удаляет устаревшие запросы.
+func (s *Storage) SavePasswordlessLogin(ctx context.Context, login models.PasswordlessLogin, codeHash []byte) error {
+	const op = "storage.postgresql.SavePasswordlessLogin"
+
+	// Запросы хранятся сутки: по ним считается ограничение частоты
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM passwordless_logins WHERE expires_at < now() - interval '1 day'"); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO passwordless_logins(id, user_id, app_id, code_hash, expires_at) VALUES($1, $2, $3, $4, $5)",
+		login.ID, login.UserID, login.AppID, codeHash, login.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+// CountPasswordlessLogins возвращает число запросов входа без пароля пользователя с момента since.
+func (s *Storage) CountPasswordlessLogins(ctx context.Context, userID int64, since time.Time) (int, error) {
+	const op = "storage.postgresql.CountPasswordlessLogins"
+
+	var n int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT count(*) FROM passwordless_logins WHERE user_id = $1 AND created_at > $2",
+		userID, since,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return n, nil
+}
+
+// ConsumePasswordlessLogin погашает запрос входа. Если codeHash не пуст, он должен
+// совпасть с кодом из письма; неверный код увеличивает счетчик попыток, и после
+// maxAttempts запрос больше не принимается. Пустой codeHash используется для ссылки,
+// подлинность которой уже проверена по подписи. Возвращает false, если запрос не принят.
+func (s *Storage) ConsumePasswordlessLogin(ctx context.Context, id string, codeHash []byte, maxAttempts int) (models.PasswordlessLogin, bool, error) {
+	const op = "storage.postgresql.ConsumePasswordlessLogin"
+
+	// nil []byte драйвер передает как пустую строку, а не NULL
+	var hash sql.Null[[]byte]
+	if len(codeHash) > 0 {
+		hash = sql.Null[[]byte]{V: codeHash, Valid: true}
+	}
+
+	login := models.PasswordlessLogin{ID: id}
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE passwordless_logins SET consumed_at = now()
+		WHERE id = $1 AND consumed_at IS NULL AND expires_at > now() AND attempts < $3
+		  AND ($2::BYTEA IS NULL OR code_hash = $2)
+		RETURNING user_id, app_id, expires_at`,
+		id, hash, maxAttempts,
+	).Scan(&login.UserID, &login.AppID, &login.ExpiresAt)
+	if err == nil {
+		return login, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.PasswordlessLogin{}, false, fmt.Errorf("%s: %v", op, err)
+	}
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE passwordless_logins SET attempts = attempts + 1 WHERE id = $1 AND consumed_at IS NULL",
+		id,
+	)
+	if err != nil {
+		return models.PasswordlessLogin{}, false, fmt.Errorf("%s: %v", op, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return models.PasswordlessLogin{}, false, fmt.Errorf("%s: %v", op, err)
+	} else if n == 0 {
+		return models.PasswordlessLogin{}, false, fmt.Errorf("%s: %w", op, storage.ErrPasswordlessLoginNotFound)
+	}
+
+	return models.PasswordlessLogin{}, false, nil
+}
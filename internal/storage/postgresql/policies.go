@@ -0,0 +1,83 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+const policyColumns = "id, app_id, name, document, created_at, updated_at"
+
+func scanPolicy(row rowScanner) (models.Policy, error) {
+	var p models.Policy
+	err := row.Scan(&p.ID, &p.AppID, &p.Name, &p.Document, &p.CreatedAt, &p.UpdatedAt)
+
+	return p, err
+}
+
+// SavePolicy создает политику приложения или заменяет документ политики с тем же именем.
+func (s *Storage) SavePolicy(ctx context.Context, p models.Policy) (models.Policy, error) {
+	const op = "storage.postgresql.SavePolicy"
+
+	p, err := scanPolicy(s.db.QueryRowContext(ctx, `
+		INSERT INTO policies(app_id, name, document) VALUES($1, $2, $3)
+		ON CONFLICT (app_id, name) DO UPDATE SET document = EXCLUDED.document, updated_at = now()
+		RETURNING `+policyColumns,
+		p.AppID, p.Name, p.Document,
+	))
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return models.Policy{}, fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+		return models.Policy{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return p, nil
+}
+
+// DeletePolicy удаляет политику приложения.
+func (s *Storage) DeletePolicy(ctx context.Context, appID int, name string) error {
+	const op = "storage.postgresql.DeletePolicy"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM policies WHERE app_id = $1 AND name = $2", appID, name)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrPolicyNotFound)
+	}
+
+	return nil
+}
+
+// Policies возвращает политики приложения.
+func (s *Storage) Policies(ctx context.Context, appID int) ([]models.Policy, error) {
+	const op = "storage.postgresql.Policies"
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+policyColumns+" FROM policies WHERE app_id = $1 ORDER BY name", appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var policies []models.Policy
+	for rows.Next() {
+		p, err := scanPolicy(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		policies = append(policies, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return policies, nil
+}
@@ -3,20 +3,26 @@ package postgresql
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/lib/envelope"
 	"github.com/1abobik1/Single-Sign-On/internal/storage"
 	"github.com/lib/pq" // Регистрация драйвера PostgreSQL
 )
 
 type Storage struct {
-	db *sql.DB
+	db      *sql.DB
+	secrets *envelope.Keyring
 }
 
-// New создает новое подключение к базе данных PostgreSQL.
-func New(storagePath string) (*Storage, error) {
+// New создает новое подключение к базе данных PostgreSQL. secrets шифрует
+// секреты приложений и TOTP; может быть nil, если хранилище не работает с ними.
+func New(storagePath string, secrets *envelope.Keyring) (*Storage, error) {
 	const op = "storage.postresql.New"
 
 	db, err := sql.Open("postgres", storagePath)
@@ -24,7 +30,7 @@ func New(storagePath string) (*Storage, error) {
 		return nil, fmt.Errorf("%s: %v", op, err)
 	}
 
-	return &Storage{db: db}, nil
+	return &Storage{db: db, secrets: secrets}, nil
 }
 
 // Stop закрывает подключение к базе данных.
@@ -32,19 +38,64 @@ func (s *Storage) Stop() error {
 	return s.db.Close()
 }
 
+// errPlaintextSecret возвращается при чтении секрета, сохраненного до
+// включения шифрования и еще не зашифрованного EncryptPlaintextSecrets.
+var errPlaintextSecret = errors.New("secret is stored in plaintext")
+
+// EncryptPlaintextSecrets шифрует текущим мастер-ключом секреты приложений и
+// TOTP, сохраненные открытым текстом до включения шифрования, и возвращает их
+// число. Вызывается при запуске сервера: секреты открытым текстом при чтении
+// отвергаются.
+func (s *Storage) EncryptPlaintextSecrets(ctx context.Context) (int, error) {
+	const op = "storage.postgresql.EncryptPlaintextSecrets"
+
+	plaintext := func(stored string) bool { return !envelope.Encrypted(stored) }
+
+	apps, err := s.reencryptAppSecrets(ctx, plaintext)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	totp, err := s.reencryptTOTPSecrets(ctx, plaintext)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return apps + totp, nil
+}
+
 // SaveUser добавляет пользователя в таблицу users и возвращает его ID.
 func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (int64, error) {
 	const op = "storage.postgresql.SaveUser"
 
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
 	var id int64
-	err := s.db.QueryRowContext(ctx, "INSERT INTO users(email, pass_hash) VALUES($1, $2) RETURNING id", email, passHash).Scan(&id)
+	err = tx.QueryRowContext(ctx, "INSERT INTO users(email, pass_hash) VALUES($1, $2) RETURNING id", email, passHash).Scan(&id)
 	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" { // 23505 - уникальное ограничение
-			return 0, fmt.Errorf("%s: %v", op, storage.ErrUserExists)
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
 		}
 		return 0, fmt.Errorf("%s: %v", op, err)
 	}
 
+	// Email пользователя — его основной идентификатор для входа
+	_, err = tx.ExecContext(ctx, "INSERT INTO user_identifiers(user_id, kind, value) VALUES($1, $2, $3)", id, models.IdentifierEmail, email)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
 	return id, nil
 }
 
@@ -52,7 +103,7 @@ func (s *Storage) SaveRefreshToken(ctx context.Context, userID int64, refreshTok
 	const op = "storage.postgresql.SaveRefreshToken"
 
 	// Обновляем refresh токен для существующего пользователя
-	_, err := s.db.ExecContext(ctx, "UPDATE users SET refresh_token = $1 WHERE id = $2", refreshToken, userID)
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET refresh_token = NULLIF($1, '') WHERE id = $2", refreshToken, userID)
 	if err != nil {
 		return fmt.Errorf("%s: %v", op, err)
 	}
@@ -60,16 +111,49 @@ func (s *Storage) SaveRefreshToken(ctx context.Context, userID int64, refreshTok
 	return nil
 }
 
-// User ищет пользователя по email.
+const userColumns = "id, email, pass_hash, failed_login_attempts, lockout_count, locked_until, " +
+	"display_name, given_name, family_name, locale, timezone, avatar_url, created_at, updated_at, " +
+	"refresh_token, status, suspended_until, status_reason, status_changed_at, attributes"
+
+// scanUser читает строку таблицы users в порядке userColumns.
+func scanUser(row rowScanner) (models.User, error) {
+	var (
+		user            models.User
+		lockedUntil     sql.NullTime
+		refreshToken    sql.NullString
+		suspendedUntil  sql.NullTime
+		statusChangedAt sql.NullTime
+		attributes      []byte
+	)
+
+	err := row.Scan(
+		&user.ID, &user.Email, &user.PassHash, &user.FailedLoginAttempts, &user.LockoutCount, &lockedUntil,
+		&user.DisplayName, &user.GivenName, &user.FamilyName, &user.Locale, &user.Timezone, &user.AvatarURL,
+		&user.CreatedAt, &user.UpdatedAt,
+		&refreshToken, &user.Status, &suspendedUntil, &user.StatusReason, &statusChangedAt, &attributes,
+	)
+	if err != nil {
+		return models.User{}, err
+	}
+	if err := json.Unmarshal(attributes, &user.Attributes); err != nil {
+		return models.User{}, err
+	}
+	user.LockedUntil = lockedUntil.Time
+	user.RefreshToken = refreshToken.String
+	user.SuspendedUntil = suspendedUntil.Time
+	user.StatusChangedAt = statusChangedAt.Time
+
+	return user, nil
+}
+
+// User ищет пользователя по email без учета регистра.
 func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
 	const op = "storage.postgresql.User"
 
-	var user models.User
-	err := s.db.QueryRowContext(ctx, "SELECT id, email, pass_hash FROM users WHERE email = $1", email).
-		Scan(&user.ID, &user.Email, &user.PassHash)
+	user, err := scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE lower(email) = lower($1)", email))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return models.User{}, fmt.Errorf("%s: %v", op, storage.ErrUserNotFound)
+			return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
 		}
 		return models.User{}, fmt.Errorf("%s: %v", op, err)
 	}
@@ -77,35 +161,282 @@ func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
 	return user, nil
 }
 
-// App ищет приложение по ID.
-func (s *Storage) App(ctx context.Context, id int) (models.App, error) {
-	const op = "storage.postgresql.App"
+// UserByID ищет пользователя по ID.
+func (s *Storage) UserByID(ctx context.Context, userID int64) (models.User, error) {
+	const op = "storage.postgresql.UserByID"
 
-	var app models.App
-	err := s.db.QueryRowContext(ctx, "SELECT id, name, secret FROM apps WHERE id = $1", id).
-		Scan(&app.ID, &app.Name, &app.Secret)
+	user, err := scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", userID))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return models.App{}, fmt.Errorf("%s: %v", op, storage.ErrAppNotFound)
+			return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
 		}
-		return models.App{}, fmt.Errorf("%s: %v", op, err)
+		return models.User{}, fmt.Errorf("%s: %v", op, err)
 	}
 
-	return app, nil
+	return user, nil
+}
+
+// ListUsers возвращает до limit пользователей с ID больше afterID, подходящих
+// под filter, в порядке ID.
+func (s *Storage) ListUsers(ctx context.Context, filter models.UserFilter, afterID int64, limit int) ([]models.User, error) {
+	const op = "storage.postgresql.ListUsers"
+
+	where := []string{"id > $1"}
+	args := []interface{}{afterID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.EmailPrefix != "" {
+		where = append(where, "lower(email) LIKE "+arg(likePrefix(strings.ToLower(filter.EmailPrefix))))
+	}
+	if filter.Status != "" {
+		where = append(where, "status = "+arg(filter.Status))
+	}
+	if filter.RoleID != 0 {
+		where = append(where, "EXISTS (SELECT 1 FROM user_roles ur WHERE ur.user_id = users.id AND ur.role_id = "+arg(filter.RoleID)+")")
+	}
+	if !filter.CreatedAfter.IsZero() {
+		where = append(where, "created_at >= "+arg(filter.CreatedAfter))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		where = append(where, "created_at < "+arg(filter.CreatedBefore))
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE "+strings.Join(where, " AND ")+" ORDER BY id LIMIT "+arg(limit),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return users, nil
+}
+
+// likePrefix экранирует спецсимволы LIKE и добавляет "%" для поиска по префиксу.
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
+}
+
+// UpdatePasswordHash заменяет хеш пароля пользователя.
+func (s *Storage) UpdatePasswordHash(ctx context.Context, userID int64, passHash []byte) error {
+	const op = "storage.postgresql.UpdatePasswordHash"
+
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET pass_hash = $1, updated_at = now() WHERE id = $2", passHash, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return checkUserAffected(op, res)
 }
 
-// IsAdmin проверяет, является ли пользователь администратором.
-func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
-	const op = "storage.postgresql.IsAdmin"
+// UpdateProfile сохраняет профиль пользователя и возвращает обновленного пользователя.
+func (s *Storage) UpdateProfile(ctx context.Context, userID int64, profile models.Profile) (models.User, error) {
+	const op = "storage.postgresql.UpdateProfile"
 
-	var isAdmin bool
-	err := s.db.QueryRowContext(ctx, "SELECT is_admin FROM users WHERE id = $1", userID).Scan(&isAdmin)
+	user, err := scanUser(s.db.QueryRowContext(ctx, `
+		UPDATE users
+		SET display_name = $1, given_name = $2, family_name = $3, locale = $4, timezone = $5, avatar_url = $6, updated_at = now()
+		WHERE id = $7
+		RETURNING `+userColumns,
+		profile.DisplayName, profile.GivenName, profile.FamilyName, profile.Locale, profile.Timezone, profile.AvatarURL, userID,
+	))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return false, fmt.Errorf("%s: %v", op, storage.ErrUserNotFound)
+			return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
 		}
-		return false, fmt.Errorf("%s: %v", op, err)
+		return models.User{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return user, nil
+}
+
+// SetUserStatus меняет статус пользователя. Для любого статуса, кроме active,
+// сохраненный refresh токен удаляется, чтобы завершить сессии пользователя.
+func (s *Storage) SetUserStatus(ctx context.Context, userID int64, status models.UserStatus, suspendedUntil time.Time, reason string) (models.User, error) {
+	const op = "storage.postgresql.SetUserStatus"
+
+	var until sql.NullTime
+	if !suspendedUntil.IsZero() {
+		until = sql.NullTime{Time: suspendedUntil, Valid: true}
 	}
 
-	return isAdmin, nil
+	user, err := scanUser(s.db.QueryRowContext(ctx, `
+		UPDATE users
+		SET status = $1, suspended_until = $2, status_reason = $3, status_changed_at = now(), updated_at = now(),
+		    refresh_token = CASE WHEN $1 = 'active' THEN refresh_token END
+		WHERE id = $4
+		RETURNING `+userColumns,
+		status, until, reason, userID,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return models.User{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return user, nil
+}
+
+// SetUserAttributes заменяет атрибуты пользователя и возвращает обновленного пользователя.
+func (s *Storage) SetUserAttributes(ctx context.Context, userID int64, attributes map[string]string) (models.User, error) {
+	const op = "storage.postgresql.SetUserAttributes"
+
+	if attributes == nil {
+		attributes = map[string]string{}
+	}
+	doc, err := json.Marshal(attributes)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	user, err := scanUser(s.db.QueryRowContext(ctx,
+		"UPDATE users SET attributes = $1, updated_at = now() WHERE id = $2 RETURNING "+userColumns,
+		doc, userID,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return models.User{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return user, nil
+}
+
+// IncrementFailedLogins увеличивает счетчик неудачных попыток входа и возвращает новое значение.
+func (s *Storage) IncrementFailedLogins(ctx context.Context, userID int64) (int, error) {
+	const op = "storage.postgresql.IncrementFailedLogins"
+
+	var attempts int
+	err := s.db.QueryRowContext(ctx,
+		"UPDATE users SET failed_login_attempts = failed_login_attempts + 1 WHERE id = $1 RETURNING failed_login_attempts",
+		userID,
+	).Scan(&attempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return attempts, nil
+}
+
+// ReserveLoginAttempt учитывает попытку входа до проверки пароля. Попытка
+// учитывается, только если вход не заблокирован и счетчик меньше maxAttempts;
+// иначе возвращается reserved = false. Блокировка и счетчик проверяются тем же
+// UPDATE, поэтому параллельные запросы не проверят больше maxAttempts паролей.
+func (s *Storage) ReserveLoginAttempt(ctx context.Context, userID int64, maxAttempts int) (int, bool, error) {
+	const op = "storage.postgresql.ReserveLoginAttempt"
+
+	var attempts int
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE users SET failed_login_attempts = failed_login_attempts + 1
+		WHERE id = $1 AND (locked_until IS NULL OR locked_until <= now()) AND failed_login_attempts < $2
+		RETURNING failed_login_attempts`,
+		userID, maxAttempts,
+	).Scan(&attempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return attempts, true, nil
+}
+
+// LockUser блокирует вход до until, сбрасывает счетчик попыток и увеличивает счетчик блокировок.
+func (s *Storage) LockUser(ctx context.Context, userID int64, until time.Time) error {
+	const op = "storage.postgresql.LockUser"
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE users SET locked_until = $1, lockout_count = lockout_count + 1, failed_login_attempts = 0 WHERE id = $2",
+		until, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return checkUserAffected(op, res)
+}
+
+// ResetLoginAttempts снимает блокировку и обнуляет счетчики неудачных попыток и блокировок.
+func (s *Storage) ResetLoginAttempts(ctx context.Context, userID int64) error {
+	const op = "storage.postgresql.ResetLoginAttempts"
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE users SET failed_login_attempts = 0, lockout_count = 0, locked_until = NULL WHERE id = $1",
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return checkUserAffected(op, res)
+}
+
+// isUniqueViolation сообщает, нарушено ли уникальное ограничение.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" // 23505 - уникальное ограничение
+}
+
+// isForeignKeyViolation сообщает, ссылается ли запись на несуществующую строку.
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503" // 23503 - внешний ключ
+}
+
+// checkUserAffected возвращает storage.ErrUserNotFound, если запрос не затронул ни одной строки.
+func checkUserAffected(op string, res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// App ищет приложение по ID.
+func (s *Storage) App(ctx context.Context, id int) (models.App, error) {
+	const op = "storage.postgresql.App"
+
+	var app models.App
+	var stored string
+	err := s.db.QueryRowContext(ctx, "SELECT id, name, secret, trusted FROM apps WHERE id = $1", id).
+		Scan(&app.ID, &app.Name, &stored, &app.Trusted)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.App{}, fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+		return models.App{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	app.Secret, err = s.decryptAppSecret(app.ID, stored)
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return app, nil
 }
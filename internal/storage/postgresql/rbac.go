@@ -0,0 +1,297 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+	"github.com/lib/pq"
+)
+
+// roleColumns выбирает роль r вместе с отсортированными именами ее разрешений.
+const roleColumns = `r.id, COALESCE(r.app_id, 0), r.name, r.description, r.created_at,
+	COALESCE((SELECT array_agg(p.name ORDER BY p.name)
+	          FROM role_permissions rp JOIN permissions p ON p.id = rp.permission_id
+	          WHERE rp.role_id = r.id), '{}')`
+
+func scanRole(row rowScanner) (models.Role, error) {
+	var (
+		role        models.Role
+		permissions pq.StringArray
+	)
+	if err := row.Scan(&role.ID, &role.AppID, &role.Name, &role.Description, &role.CreatedAt, &permissions); err != nil {
+		return models.Role{}, err
+	}
+	role.Permissions = permissions
+
+	return role, nil
+}
+
+// CreateRole сохраняет роль и ее разрешения. Разрешения создаются в области
+// приложения роли, если их еще нет.
+func (s *Storage) CreateRole(ctx context.Context, role models.Role) (models.Role, error) {
+	const op = "storage.postgresql.CreateRole"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Role{}, fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO roles(app_id, name, description) VALUES(NULLIF($1, 0), $2, $3) RETURNING id, created_at",
+		role.AppID, role.Name, role.Description,
+	).Scan(&role.ID, &role.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.Role{}, fmt.Errorf("%s: %w", op, storage.ErrRoleExists)
+		}
+		if isForeignKeyViolation(err) {
+			return models.Role{}, fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+		return models.Role{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	for _, name := range role.Permissions {
+		var permissionID int64
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO permissions(app_id, name) VALUES(NULLIF($1, 0), $2)
+			ON CONFLICT ((COALESCE(app_id, 0)), name) DO UPDATE SET name = EXCLUDED.name
+			RETURNING id`,
+			role.AppID, name,
+		).Scan(&permissionID)
+		if err != nil {
+			return models.Role{}, fmt.Errorf("%s: %v", op, err)
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO role_permissions(role_id, permission_id) VALUES($1, $2) ON CONFLICT DO NOTHING",
+			role.ID, permissionID,
+		)
+		if err != nil {
+			return models.Role{}, fmt.Errorf("%s: %v", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Role{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return role, nil
+}
+
+// DeleteRole удаляет роль вместе с ее назначениями пользователям.
+func (s *Storage) DeleteRole(ctx context.Context, roleID int64) error {
+	const op = "storage.postgresql.DeleteRole"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM roles WHERE id = $1", roleID)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrRoleNotFound)
+	}
+
+	return nil
+}
+
+// Role ищет роль по ID.
+func (s *Storage) Role(ctx context.Context, roleID int64) (models.Role, error) {
+	const op = "storage.postgresql.Role"
+
+	role, err := scanRole(s.db.QueryRowContext(ctx, "SELECT "+roleColumns+" FROM roles r WHERE r.id = $1", roleID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Role{}, fmt.Errorf("%s: %w", op, storage.ErrRoleNotFound)
+		}
+		return models.Role{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return role, nil
+}
+
+// Roles возвращает роли приложения appID; appID = 0 — глобальные роли.
+func (s *Storage) Roles(ctx context.Context, appID int) ([]models.Role, error) {
+	const op = "storage.postgresql.Roles"
+
+	roles, err := s.queryRoles(ctx,
+		"SELECT "+roleColumns+" FROM roles r WHERE COALESCE(r.app_id, 0) = $1 ORDER BY r.name",
+		appID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return roles, nil
+}
+
+// AssignRole назначает роль пользователю. Повторное назначение не является ошибкой.
+func (s *Storage) AssignRole(ctx context.Context, userID int64, roleID int64) error {
+	const op = "storage.postgresql.AssignRole"
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO user_roles(user_id, role_id) VALUES($1, $2) ON CONFLICT DO NOTHING",
+		userID, roleID,
+	)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			// Ссылка нарушается либо на роль, либо на пользователя
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Constraint == "user_roles_role_id_fkey" {
+				return fmt.Errorf("%s: %w", op, storage.ErrRoleNotFound)
+			}
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+// UnassignRole снимает роль с пользователя. Если роль не была назначена,
+// возвращает storage.ErrRoleNotFound.
+func (s *Storage) UnassignRole(ctx context.Context, userID int64, roleID int64) error {
+	const op = "storage.postgresql.UnassignRole"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2", userID, roleID)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrRoleNotFound)
+	}
+
+	return nil
+}
+
+// SetUserRoles заменяет роли пользователя в приложении appID (0 — глобальные роли)
+// на roleIDs. Роли других приложений не меняются. Если какая-то из roleIDs не
+// принадлежит appID, возвращает storage.ErrRoleNotFound.
+func (s *Storage) SetUserRoles(ctx context.Context, userID int64, appID int, roleIDs []int64) error {
+	const op = "storage.postgresql.SetUserRoles"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if !exists {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM user_roles ur USING roles r
+		WHERE r.id = ur.role_id AND ur.user_id = $1 AND COALESCE(r.app_id, 0) = $2`,
+		userID, appID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO user_roles(user_id, role_id)
+		SELECT $1, id FROM roles WHERE id = ANY($2) AND COALESCE(app_id, 0) = $3`,
+		userID, pq.Int64Array(roleIDs), appID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if int(n) != len(roleIDs) {
+		return fmt.Errorf("%s: %w", op, storage.ErrRoleNotFound)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+// UserRoles возвращает роли пользователя, действующие в приложении appID:
+// роли этого приложения и глобальные роли.
+func (s *Storage) UserRoles(ctx context.Context, userID int64, appID int) ([]models.Role, error) {
+	const op = "storage.postgresql.UserRoles"
+
+	roles, err := s.queryRoles(ctx, `
+		SELECT `+roleColumns+`
+		FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id = $1 AND (r.app_id IS NULL OR r.app_id = $2)
+		ORDER BY r.app_id NULLS FIRST, r.name`,
+		userID, appID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return roles, nil
+}
+
+// HasPermission сообщает, дает ли одна из ролей пользователя, действующих в
+// приложении appID, хотя бы одно из разрешений permissions.
+func (s *Storage) HasPermission(ctx context.Context, userID int64, appID int, permissions ...string) (bool, error) {
+	const op = "storage.postgresql.HasPermission"
+
+	var ok sql.NullBool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM user_roles ur
+			JOIN roles r ON r.id = ur.role_id
+			JOIN role_permissions rp ON rp.role_id = r.id
+			JOIN permissions p ON p.id = rp.permission_id
+			WHERE ur.user_id = u.id AND (r.app_id IS NULL OR r.app_id = $2) AND p.name = ANY($3)
+		)
+		FROM users u WHERE u.id = $1`,
+		userID, appID, pq.Array(permissions),
+	).Scan(&ok)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return false, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return ok.Bool, nil
+}
+
+func (s *Storage) queryRoles(ctx context.Context, query string, args ...interface{}) ([]models.Role, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
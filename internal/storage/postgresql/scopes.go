@@ -0,0 +1,163 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+	"github.com/lib/pq"
+)
+
+const scopeColumns = "s.id, s.app_id, s.name, s.description, s.created_at"
+
+func scanScope(row rowScanner) (models.Scope, error) {
+	var scope models.Scope
+	err := row.Scan(&scope.ID, &scope.AppID, &scope.Name, &scope.Description, &scope.CreatedAt)
+
+	return scope, err
+}
+
+// DefineScope создает scope приложения или обновляет описание уже определенного им scope.
+// Если scope с таким именем принадлежит другому приложению, возвращает storage.ErrScopeExists.
+func (s *Storage) DefineScope(ctx context.Context, scope models.Scope) (models.Scope, error) {
+	const op = "storage.postgresql.DefineScope"
+
+	scope, err := scanScope(s.db.QueryRowContext(ctx, `
+		INSERT INTO scopes AS s (app_id, name, description) VALUES($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET description = EXCLUDED.description
+		WHERE s.app_id = EXCLUDED.app_id
+		RETURNING `+scopeColumns,
+		scope.AppID, scope.Name, scope.Description,
+	))
+	if err != nil {
+		// Конфликт с scope другого приложения не возвращает строку
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Scope{}, fmt.Errorf("%s: %w", op, storage.ErrScopeExists)
+		}
+		if isForeignKeyViolation(err) {
+			return models.Scope{}, fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+		return models.Scope{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return scope, nil
+}
+
+// DeleteScope удаляет scope приложения. Scope исчезает из разрешенных scope всех приложений.
+func (s *Storage) DeleteScope(ctx context.Context, appID int, name string) error {
+	const op = "storage.postgresql.DeleteScope"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM scopes WHERE app_id = $1 AND name = $2", appID, name)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrScopeNotFound)
+	}
+
+	return nil
+}
+
+// Scopes возвращает scope, определенные приложением.
+func (s *Storage) Scopes(ctx context.Context, appID int) ([]models.Scope, error) {
+	const op = "storage.postgresql.Scopes"
+
+	scopes, err := s.queryScopes(ctx, "SELECT "+scopeColumns+" FROM scopes s WHERE s.app_id = $1 ORDER BY s.name", appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return scopes, nil
+}
+
+// ScopesByName возвращает scope с указанными именами. Несуществующие имена пропускаются.
+func (s *Storage) ScopesByName(ctx context.Context, names []string) ([]models.Scope, error) {
+	const op = "storage.postgresql.ScopesByName"
+
+	scopes, err := s.queryScopes(ctx, "SELECT "+scopeColumns+" FROM scopes s WHERE s.name = ANY($1) ORDER BY s.name", pq.Array(names))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return scopes, nil
+}
+
+// SetAllowedScopes заменяет список scope, которые приложение может запрашивать.
+func (s *Storage) SetAllowedScopes(ctx context.Context, appID int, scopeIDs []int64) error {
+	const op = "storage.postgresql.SetAllowedScopes"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM app_allowed_scopes WHERE app_id = $1", appID); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO app_allowed_scopes(app_id, scope_id) SELECT $1, unnest($2::integer[])",
+		appID, pq.Array(scopeIDs),
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if isForeignKeyViolation(err) && errors.As(err, &pqErr) && pqErr.Constraint == "app_allowed_scopes_scope_id_fkey" {
+			return fmt.Errorf("%s: %w", op, storage.ErrScopeNotFound)
+		}
+		if isForeignKeyViolation(err) {
+			return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+// AllowedScopes возвращает scope, которые приложение может запрашивать.
+func (s *Storage) AllowedScopes(ctx context.Context, appID int) ([]models.Scope, error) {
+	const op = "storage.postgresql.AllowedScopes"
+
+	scopes, err := s.queryScopes(ctx, `
+		SELECT `+scopeColumns+`
+		FROM app_allowed_scopes a JOIN scopes s ON s.id = a.scope_id
+		WHERE a.app_id = $1 ORDER BY s.name`,
+		appID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return scopes, nil
+}
+
+func (s *Storage) queryScopes(ctx context.Context, query string, args ...interface{}) ([]models.Scope, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scopes []models.Scope
+	for rows.Next() {
+		scope, err := scanScope(rows)
+		if err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, scope)
+	}
+
+	return scopes, rows.Err()
+}
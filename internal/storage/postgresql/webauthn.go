@@ -0,0 +1,191 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/1abobik1/Single-Sign-On/internal/domain/models"
+	"github.com/1abobik1/Single-Sign-On/internal/storage"
+)
+
+const webAuthnCredentialColumns = "id, user_id, credential_id, public_key, sign_count, name, created_at, last_used_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWebAuthnCredential(row rowScanner) (models.WebAuthnCredential, error) {
+	var (
+		cred       models.WebAuthnCredential
+		signCount  int64
+		lastUsedAt sql.NullTime
+	)
+	err := row.Scan(&cred.ID, &cred.UserID, &cred.CredentialID, &cred.PublicKey, &signCount, &cred.Name, &cred.CreatedAt, &lastUsedAt)
+	if err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+	cred.SignCount = uint32(signCount)
+	cred.LastUsedAt = lastUsedAt.Time
+
+	return cred, nil
+}
+
+// SaveWebAuthnChallenge сохраняет challenge начатой церемонии и удаляет просроченные.
+func (s *Storage) SaveWebAuthnChallenge(ctx context.Context, challenge models.WebAuthnChallenge) error {
+	const op = "storage.postgresql.SaveWebAuthnChallenge"
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM webauthn_challenges WHERE expires_at < now()"); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	var userID sql.NullInt64
+	if challenge.UserID != 0 {
+		userID = sql.NullInt64{Int64: challenge.UserID, Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO webauthn_challenges(challenge, kind, user_id, app_id, expires_at) VALUES($1, $2, $3, $4, $5)",
+		challenge.Challenge, challenge.Kind, userID, challenge.AppID, challenge.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeWebAuthnChallenge удаляет и возвращает действующий challenge вида kind.
+// Каждый challenge можно использовать только один раз.
+func (s *Storage) ConsumeWebAuthnChallenge(ctx context.Context, challenge []byte, kind string) (models.WebAuthnChallenge, error) {
+	const op = "storage.postgresql.ConsumeWebAuthnChallenge"
+
+	var (
+		res    models.WebAuthnChallenge
+		userID sql.NullInt64
+	)
+	err := s.db.QueryRowContext(ctx, `
+		DELETE FROM webauthn_challenges
+		WHERE challenge = $1 AND kind = $2 AND expires_at > now()
+		RETURNING challenge, kind, user_id, app_id, expires_at`,
+		challenge, kind,
+	).Scan(&res.Challenge, &res.Kind, &userID, &res.AppID, &res.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.WebAuthnChallenge{}, fmt.Errorf("%s: %w", op, storage.ErrChallengeNotFound)
+		}
+		return models.WebAuthnChallenge{}, fmt.Errorf("%s: %v", op, err)
+	}
+	res.UserID = userID.Int64
+
+	return res, nil
+}
+
+// SaveWebAuthnCredential сохраняет новый ключ пользователя.
+func (s *Storage) SaveWebAuthnCredential(ctx context.Context, cred models.WebAuthnCredential) (int64, error) {
+	const op = "storage.postgresql.SaveWebAuthnCredential"
+
+	var id int64
+	err := s.db.QueryRowContext(ctx,
+		"INSERT INTO webauthn_credentials(user_id, credential_id, public_key, sign_count, name) VALUES($1, $2, $3, $4, $5) RETURNING id",
+		cred.UserID, cred.CredentialID, cred.PublicKey, int64(cred.SignCount), cred.Name,
+	).Scan(&id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrCredentialExists)
+		}
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return id, nil
+}
+
+// WebAuthnCredential ищет ключ по идентификатору, выданному аутентификатором.
+func (s *Storage) WebAuthnCredential(ctx context.Context, credentialID []byte) (models.WebAuthnCredential, error) {
+	const op = "storage.postgresql.WebAuthnCredential"
+
+	cred, err := scanWebAuthnCredential(s.db.QueryRowContext(ctx,
+		"SELECT "+webAuthnCredentialColumns+" FROM webauthn_credentials WHERE credential_id = $1",
+		credentialID,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.WebAuthnCredential{}, fmt.Errorf("%s: %w", op, storage.ErrCredentialNotFound)
+		}
+		return models.WebAuthnCredential{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return cred, nil
+}
+
+// WebAuthnCredentials возвращает все ключи пользователя.
+func (s *Storage) WebAuthnCredentials(ctx context.Context, userID int64) ([]models.WebAuthnCredential, error) {
+	const op = "storage.postgresql.WebAuthnCredentials"
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+webAuthnCredentialColumns+" FROM webauthn_credentials WHERE user_id = $1 ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var creds []models.WebAuthnCredential
+	for rows.Next() {
+		cred, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		creds = append(creds, cred)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return creds, nil
+}
+
+// UpdateWebAuthnSignCount сохраняет счетчик подписей после успешного входа.
+// Возвращает false, если за это время счетчик уже обновился до того же или
+// большего значения параллельным входом.
+func (s *Storage) UpdateWebAuthnSignCount(ctx context.Context, id int64, signCount uint32) (bool, error) {
+	const op = "storage.postgresql.UpdateWebAuthnSignCount"
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE webauthn_credentials SET sign_count = $2, last_used_at = now()
+		WHERE id = $1 AND (sign_count < $2 OR $2 = 0)`,
+		id, int64(signCount),
+	)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return n > 0, nil
+}
+
+// DeleteWebAuthnCredential удаляет ключ пользователя.
+func (s *Storage) DeleteWebAuthnCredential(ctx context.Context, userID int64, id int64) error {
+	const op = "storage.postgresql.DeleteWebAuthnCredential"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrCredentialNotFound)
+	}
+
+	return nil
+}
@@ -6,4 +6,35 @@ var (
 	ErrUserExists   = errors.New("user already exists")
 	ErrUserNotFound = errors.New("user not found")
 	ErrAppNotFound  = errors.New("app not found")
+	ErrAppExists    = errors.New("app already exists")
+
+	ErrIdentifierExists   = errors.New("identifier already exists")
+	ErrIdentifierNotFound = errors.New("identifier not found")
+
+	ErrMFAAlreadyEnabled = errors.New("mfa already enabled")
+	ErrMFANotFound       = errors.New("mfa not found")
+
+	ErrCredentialExists   = errors.New("webauthn credential already exists")
+	ErrCredentialNotFound = errors.New("webauthn credential not found")
+	ErrChallengeNotFound  = errors.New("webauthn challenge not found")
+
+	ErrPasswordlessLoginNotFound = errors.New("passwordless login not found")
+
+	ErrDeviceNotFound = errors.New("trusted device not found")
+
+	ErrRoleExists   = errors.New("role already exists")
+	ErrRoleNotFound = errors.New("role not found")
+
+	ErrScopeExists   = errors.New("scope already exists")
+	ErrScopeNotFound = errors.New("scope not found")
+
+	ErrOrgExists      = errors.New("organization already exists")
+	ErrOrgNotFound    = errors.New("organization not found")
+	ErrMemberExists   = errors.New("user is already a member of the organization")
+	ErrMemberNotFound = errors.New("user is not a member of the organization")
+	ErrLastOwner      = errors.New("organization must keep at least one owner")
+
+	ErrInvitationNotFound = errors.New("invitation not found")
+
+	ErrPolicyNotFound = errors.New("policy not found")
 )
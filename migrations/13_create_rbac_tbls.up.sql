@@ -0,0 +1,53 @@
+-- Роли и разрешения задаются в рамках приложения. app_id = NULL — глобальные
+-- роли и разрешения, действующие во всех приложениях.
+CREATE TABLE IF NOT EXISTS roles (
+    id SERIAL PRIMARY KEY,
+    app_id INTEGER REFERENCES apps (id) ON DELETE CASCADE,
+    name VARCHAR(64) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS roles_app_id_name_idx ON roles (COALESCE(app_id, 0), name);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id SERIAL PRIMARY KEY,
+    app_id INTEGER REFERENCES apps (id) ON DELETE CASCADE,
+    name VARCHAR(128) NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS permissions_app_id_name_idx ON permissions (COALESCE(app_id, 0), name);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions (id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role_id INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_roles_role_id_idx ON user_roles (role_id);
+
+-- Флаг is_admin заменяется глобальной ролью admin с разрешением sso:admin
+INSERT INTO permissions (app_id, name) VALUES (NULL, 'sso:admin')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO roles (app_id, name, description) VALUES (NULL, 'admin', 'SSO administrator')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.app_id IS NULL AND r.name = 'admin' AND p.app_id IS NULL AND p.name = 'sso:admin'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.id, r.id FROM users u, roles r
+WHERE u.is_admin AND r.app_id IS NULL AND r.name = 'admin'
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
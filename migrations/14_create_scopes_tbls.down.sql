@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS app_allowed_scopes;
+DROP TABLE IF EXISTS scopes;
@@ -0,0 +1,17 @@
+-- Scope определяет приложение, которому принадлежат защищенные им ресурсы
+CREATE TABLE IF NOT EXISTS scopes (
+    id SERIAL PRIMARY KEY,
+    app_id INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    name VARCHAR(128) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS scopes_app_id_idx ON scopes (app_id);
+
+-- Scope, которые приложение может запрашивать в токенах
+CREATE TABLE IF NOT EXISTS app_allowed_scopes (
+    app_id INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    scope_id INTEGER NOT NULL REFERENCES scopes (id) ON DELETE CASCADE,
+    PRIMARY KEY (app_id, scope_id)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS org_invitations (
+    id VARCHAR(64) PRIMARY KEY,
+    org_id INTEGER NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    -- Приложение, ключом которого подписан токен приглашения
+    app_id INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('owner', 'admin', 'member')),
+    invited_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    accepted_at TIMESTAMPTZ,
+    accepted_by INTEGER REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS org_invitations_org_id_idx ON org_invitations (org_id);
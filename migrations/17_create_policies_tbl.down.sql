@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS policies;
+
+ALTER TABLE users DROP COLUMN IF EXISTS attributes;
@@ -0,0 +1,3 @@
+-- Доверенные приложения могут проверять роли и разрешения пользователей
+-- в других приложениях и вызывать IsAdmin.
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS trusted BOOLEAN NOT NULL DEFAULT false;
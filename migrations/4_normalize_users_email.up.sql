@@ -0,0 +1,28 @@
+-- Здесь email только обрезается и переводится в нижний регистр: в SQL нет
+-- IDNA, поэтому интернационализированные домены в punycode переводит команда
+-- cmd/emailnorm, которую нужно выполнить после миграций.
+-- Миграция не выполняется, если после нормализации email совпадет у нескольких пользователей:
+-- такие аккаунты нужно объединить или переименовать вручную.
+DO $$
+DECLARE
+    collisions TEXT;
+BEGIN
+    SELECT string_agg(normalized || ' (ids: ' || ids || ')', '; ')
+    INTO collisions
+    FROM (
+        SELECT lower(trim(email)) AS normalized, string_agg(id::TEXT, ', ' ORDER BY id) AS ids
+        FROM users
+        GROUP BY lower(trim(email))
+        HAVING count(*) > 1
+    ) dup;
+
+    IF collisions IS NOT NULL THEN
+        RAISE EXCEPTION 'case-insensitive email collisions in users: %', collisions;
+    END IF;
+END $$;
+
+UPDATE users SET email = lower(trim(email)) WHERE email <> lower(trim(email));
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+DROP INDEX IF EXISTS idx_email;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_key ON users (lower(email));
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS identifier_code_sends;
+DROP TABLE IF EXISTS user_identifiers;
@@ -0,0 +1,37 @@
+DROP TABLE IF EXISTS user_identifiers;
+CREATE TABLE IF NOT EXISTS user_identifiers (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('email', 'username', 'phone')),
+    value VARCHAR(255) NOT NULL,
+    verified_at TIMESTAMPTZ,
+    verification_code_hash BYTEA,
+    verification_expires_at TIMESTAMPTZ,
+    verification_attempts INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, kind)
+);
+
+-- Значение занимает только подтвержденный идентификатор: неподтвержденная заявка
+-- на чужой номер не мешает владельцу его подтвердить. Email уникален всегда —
+-- он совпадает с users.email.
+CREATE UNIQUE INDEX IF NOT EXISTS user_identifiers_kind_value_key
+    ON user_identifiers (kind, value)
+    WHERE verified_at IS NOT NULL OR kind = 'email';
+
+-- Отправленные коды подтверждения: число отправок ограничено для пользователя
+-- и для адреса получателя.
+CREATE TABLE IF NOT EXISTS identifier_code_sends (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL,
+    value VARCHAR(255) NOT NULL,
+    sent_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS identifier_code_sends_user_idx ON identifier_code_sends (user_id, sent_at);
+CREATE INDEX IF NOT EXISTS identifier_code_sends_value_idx ON identifier_code_sends (kind, value, sent_at);
+
+INSERT INTO user_identifiers (user_id, kind, value)
+SELECT id, 'email', lower(email) FROM users
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,9 @@
+ALTER TABLE users
+    DROP COLUMN display_name,
+    DROP COLUMN given_name,
+    DROP COLUMN family_name,
+    DROP COLUMN locale,
+    DROP COLUMN timezone,
+    DROP COLUMN avatar_url,
+    DROP COLUMN created_at,
+    DROP COLUMN updated_at;
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    DROP COLUMN status,
+    DROP COLUMN suspended_until,
+    DROP COLUMN status_reason,
+    DROP COLUMN status_changed_at;
@@ -0,0 +1,7 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS refresh_token TEXT,
+    ADD COLUMN status VARCHAR(32) NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'disabled', 'suspended', 'pending_approval')),
+    ADD COLUMN suspended_until TIMESTAMPTZ,
+    ADD COLUMN status_reason TEXT NOT NULL DEFAULT '',
+    ADD COLUMN status_changed_at TIMESTAMPTZ;
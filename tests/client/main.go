@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"testing"
 	"time"
@@ -11,9 +12,12 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/thanhpk/randstr"
+
+	sso "github.com/1abobik1/Single-Sign-On/protos/gen/go/sso"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 type Client struct {
@@ -53,6 +57,7 @@ func (c *Client) RegisterUser(ctx context.Context, email, password string) {
 	response, err := c.api.Register(ctx, &sso.RegisterRequest{
 		Email:    email,
 		Password: password,
+		AppId:    1,
 	})
 	if err != nil {
 		c.log.Errorf("Failed to register user: %v", err)
@@ -71,10 +76,13 @@ func (c *Client) LoginUser(ctx context.Context, email, password string, appId in
 		c.log.Errorf("Failed to login user: %v", err)
 		return
 	}
-	c.log.Infof("User logged in with token: %s", response.Token)
+	c.log.Infof("User logged in with token: %s", response.AccessToken)
 }
 
 func (c *Client) CheckAdminStatus(ctx context.Context, userID int64) (status bool) {
+	// IsAdmin доступен только доверенным приложениям
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("1:test-secret")))
+
 	response, err := c.api.IsAdmin(ctx, &sso.IsAdminRequest{
 		UserId: userID,
 	})
@@ -88,7 +96,7 @@ func (c *Client) CheckAdminStatus(ctx context.Context, userID int64) (status boo
 }
 
 func (c *Client) GetUserID(ctx context.Context, email string, password string) (UserID int64) {
-	registerResponse, err := c.api.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	registerResponse, err := c.api.Register(ctx, &sso.RegisterRequest{Email: email, Password: password, AppId: 1})
 	if err != nil {
 		c.log.Fatalf("Failed to register user: %v", err)
 	}
@@ -114,7 +122,7 @@ func TestGRPCClient(t *testing.T) {
 		if err != nil {
 			t.Fatal("bad req")
 		}
-		assert.NotEmpty(t, response.Token, "Expected token to be not empty")
+		assert.NotEmpty(t, response.AccessToken, "Expected token to be not empty")
 
 		// Тест статуса администратора
 		checkAdminEmail := randstr.Hex(8) + "@example.com"